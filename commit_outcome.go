@@ -0,0 +1,211 @@
+package gormkratos
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"net"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yyle88/erero"
+	"gorm.io/gorm"
+)
+
+// CommitError is the error of a failed COMMIT of the outermost transaction
+// OutcomeUnknown means the connection broke during COMMIT, the transaction may have committed
+// Reconcile unknown outcomes instead of retrying, retrying may apply the transaction twice
+//
+// CommitError 是最外层事务提交 (COMMIT) 失败的错误
+// OutcomeUnknown 表示提交时连接断开, 事务可能已经提交
+// 结果未知时应核对数据而不是重试, 重试可能使事务执行两次
+type CommitError struct {
+	Err            error // Error returned by COMMIT // COMMIT 返回的错误
+	OutcomeUnknown bool  // Whether the transaction may have committed // 事务是否可能已经提交
+}
+
+// Error returns the error message
+// Error 返回错误消息
+func (e *CommitError) Error() string {
+	if e.OutcomeUnknown {
+		return "commit outcome unknown: " + e.Err.Error()
+	}
+	return "commit failed: " + e.Err.Error()
+}
+
+// Unwrap returns the error returned by COMMIT
+// Unwrap 返回 COMMIT 返回的错误
+func (e *CommitError) Unwrap() error {
+	return e.Err
+}
+
+// IsCommitOutcomeUnknown checks whether err means the transaction may have committed
+//
+// IsCommitOutcomeUnknown 检查 err 是否表示事务可能已经提交
+func IsCommitOutcomeUnknown(err error) bool {
+	var commitErr *CommitError
+	return erero.As(err, &commitErr) && commitErr.OutcomeUnknown
+}
+
+// isConnectionBroken checks whether err means the connection broke, so the server may have run the command
+// Context errors are definite, database/sql rolls back before reporting them
+//
+// isConnectionBroken 检查 err 是否表示连接断开, 此时服务端可能已执行该命令
+// 上下文错误是确定的, database/sql 会先回滚再报告
+func isConnectionBroken(err error) bool {
+	var netErr net.Error
+	switch {
+	case erero.Is(err, context.Canceled), erero.Is(err, context.DeadlineExceeded), erero.Is(err, sql.ErrTxDone):
+		return false // context.DeadlineExceeded is also net.Error // context.DeadlineExceeded 也是 net.Error
+	case erero.Is(err, driver.ErrBadConn), erero.Is(err, io.EOF), erero.Is(err, io.ErrUnexpectedEOF):
+		return true
+	case erero.As(err, &netErr):
+		return true
+	default:
+		return ClassifyDbError(err) == DbErrorConnectionLost
+	}
+}
+
+// CommitMarkerPluginName is the GORM plugin name of the commit marker plugin
+// CommitMarkerPluginName 是提交标记插件的 GORM 插件名
+const CommitMarkerPluginName = "gormkratos:commit_marker"
+
+// CommitMarker is one row written inside each outermost transaction, committed together with the data
+// When the commit outcome is unknown, finding the row proves the transaction committed
+//
+// CommitMarker 是在每个最外层事务中写入的一行, 与数据一起提交
+// 当提交结果未知时, 找到该行即证明事务已提交
+type CommitMarker struct {
+	ID        string    `gorm:"primaryKey;size:36"` // Random UUID of the transaction // 事务的随机 UUID
+	CreatedAt time.Time `gorm:"index"`              // Time written in UTC // 写入时间 (UTC)
+}
+
+// TableName returns the table name of commit markers
+// TableName 返回提交标记的表名
+func (CommitMarker) TableName() string {
+	return "gormkratos_commit_markers"
+}
+
+// CommitMarkerConfig configures the commit marker plugin
+//
+// CommitMarkerConfig 配置提交标记插件
+type CommitMarkerConfig struct {
+	ResolveTimeout time.Duration // Timeout of the query resolving unknown outcomes // 查询未知结果的超时时间
+}
+
+// NewCommitMarkerConfig creates commit marker config with 5s resolve timeout
+//
+// NewCommitMarkerConfig 创建解析超时为 5s 的提交标记配置
+func NewCommitMarkerConfig() *CommitMarkerConfig {
+	return &CommitMarkerConfig{ResolveTimeout: 5 * time.Second}
+}
+
+// WithResolveTimeout sets the timeout of the query resolving unknown outcomes
+// WithResolveTimeout 设置查询未知结果的超时时间
+func (c *CommitMarkerConfig) WithResolveTimeout(timeout time.Duration) *CommitMarkerConfig {
+	c.ResolveTimeout = timeout
+	return c
+}
+
+// CommitMarkerPlugin resolves unknown commit outcomes of Transaction with commit markers
+// Register it with db.Use(gormkratos.NewCommitMarkerPlugin(config)), which migrates the marker table
+// Each outermost transaction writes one marker, purge old markers with PurgeCommitMarkers
+//
+// CommitMarkerPlugin 通过提交标记解析 Transaction 未知的提交结果
+// 通过 db.Use(gormkratos.NewCommitMarkerPlugin(config)) 注册, 注册时迁移标记表
+// 每个最外层事务写入一个标记, 通过 PurgeCommitMarkers 清理旧标记
+type CommitMarkerPlugin struct {
+	resolveTimeout time.Duration
+}
+
+var _ gorm.Plugin = &CommitMarkerPlugin{}
+
+// NewCommitMarkerPlugin creates commit marker plugin
+//
+// NewCommitMarkerPlugin 创建提交标记插件
+func NewCommitMarkerPlugin(config *CommitMarkerConfig) *CommitMarkerPlugin {
+	return &CommitMarkerPlugin{resolveTimeout: config.ResolveTimeout}
+}
+
+// Name returns the GORM plugin name
+// Name 返回 GORM 插件名
+func (p *CommitMarkerPlugin) Name() string {
+	return CommitMarkerPluginName
+}
+
+// Initialize migrates the marker table
+// Initialize 迁移标记表
+func (p *CommitMarkerPlugin) Initialize(db *gorm.DB) error {
+	return db.AutoMigrate(&CommitMarker{})
+}
+
+// commitMarkerOf returns the commit marker plugin registered on db, nil when not registered
+// commitMarkerOf 返回 db 上注册的提交标记插件, 未注册时为 nil
+func commitMarkerOf(db *gorm.DB) *CommitMarkerPlugin {
+	if plugin, ok := db.Config.Plugins[CommitMarkerPluginName].(*CommitMarkerPlugin); ok {
+		return plugin
+	}
+	return nil
+}
+
+// mark writes a new marker in the transaction and returns its ID
+// mark 在事务中写入新标记并返回其 ID
+func (p *CommitMarkerPlugin) mark(tx *gorm.DB) (string, error) {
+	marker := &CommitMarker{ID: uuid.New().String(), CreatedAt: time.Now().UTC()}
+	if err := tx.Create(marker).Error; err != nil {
+		return "", erero.Wro(err)
+	}
+	return marker.ID, nil
+}
+
+// resolve checks whether the marker was committed, on a fresh session not bound to the canceled ctx
+// resolve 在不受已取消 ctx 影响的新会话中检查标记是否已提交
+func (p *CommitMarkerPlugin) resolve(ctx context.Context, db *gorm.DB, markerID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), p.resolveTimeout)
+	defer cancel()
+
+	var count int64
+	if err := db.Session(&gorm.Session{NewDB: true, Context: ctx}).Model(&CommitMarker{}).Where("id = ?", markerID).Count(&count).Error; err != nil {
+		return false, erero.Wro(err)
+	}
+	return count > 0, nil
+}
+
+// PurgeCommitMarkers deletes markers written before the time, returns the count deleted
+// Markers are only read when resolving the outcome right after COMMIT, purge them once they are older than that
+//
+// PurgeCommitMarkers 删除在该时间之前写入的标记, 返回删除的数量
+// 标记只在 COMMIT 之后立即解析结果时读取, 超过该时间后即可清理
+func PurgeCommitMarkers(ctx context.Context, db *gorm.DB, before time.Time) (int64, error) {
+	result := db.WithContext(ctx).Where("created_at < ?", before.UTC()).Delete(&CommitMarker{})
+	if result.Error != nil {
+		return 0, erero.Wro(result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// newCommitError converts the error of COMMIT into CommitError
+// When the outcome is unknown and a marker was written, resolves the outcome with the marker
+// Returns nil when the marker proves the transaction committed
+//
+// newCommitError 将 COMMIT 的错误转换为 CommitError
+// 当结果未知且写入了标记时, 通过标记解析结果
+// 当标记证明事务已提交时返回 nil
+func newCommitError(ctx context.Context, db *gorm.DB, marker *CommitMarkerPlugin, markerID string, err error) error {
+	if !isConnectionBroken(err) {
+		return &CommitError{Err: err}
+	}
+	if marker == nil || markerID == "" {
+		return &CommitError{Err: err, OutcomeUnknown: true}
+	}
+	committed, resolveErr := marker.resolve(ctx, db, markerID)
+	switch {
+	case resolveErr != nil:
+		return &CommitError{Err: erero.Join(err, resolveErr), OutcomeUnknown: true}
+	case committed:
+		return nil
+	default:
+		return &CommitError{Err: err}
+	}
+}
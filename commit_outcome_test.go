@@ -0,0 +1,175 @@
+package gormkratos_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/orzkratos/gormkratos"
+	"github.com/orzkratos/gormkratos/api/dberrors/v1"
+	"github.com/orzkratos/gormkratos/gormkratostest"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/erero"
+	"gorm.io/gorm"
+)
+
+// Transfer is the model written in commit outcome tests
+// Transfer 是提交结果测试中写入的模型
+type Transfer struct {
+	ID     uint `gorm:"primaryKey"`
+	Amount int
+}
+
+// createTransfer creates transfer in the transaction
+// createTransfer 在事务中创建转账
+func createTransfer(db *gorm.DB) *errors.Error {
+	if err := db.Create(&Transfer{Amount: 100}).Error; err != nil {
+		return dberrors.ErrorServerDbError("create failed: %v", err)
+	}
+	return nil
+}
+
+// countTransfers counts the committed transfers
+// countTransfers 统计已提交的转账数量
+func countTransfers(t *testing.T, db *gorm.DB) int64 {
+	var count int64
+	require.NoError(t, db.Model(&Transfer{}).Count(&count).Error)
+	return count
+}
+
+// TestCommitOutcomeUnknown tests broken connections during COMMIT return unknown outcomes
+// TestCommitOutcomeUnknown 测试提交时连接断开返回未知结果
+func TestCommitOutcomeUnknown(t *testing.T) {
+	db, faults := gormkratostest.NewFaultDB(t, &Transfer{})
+	faults.FailCommit(driver.ErrBadConn)
+
+	erk, err := gormkratos.Transaction(context.Background(), db, createTransfer)
+	require.Nil(t, erk)
+	require.Error(t, err)
+	require.ErrorIs(t, err, driver.ErrBadConn)
+	require.True(t, gormkratos.IsCommitOutcomeUnknown(err))
+	require.Equal(t, gormkratos.DbErrorCommitOutcomeUnknown, gormkratos.ClassifyDbError(err))
+	require.False(t, gormkratos.IsRetryableError(err))
+	require.Equal(t, gormkratos.TxOutcomeCommitUnknown, gormkratos.ClassifyTxOutcome(context.Background(), erk, err))
+	require.True(t, dberrors.IsServerDbCommitOutcomeUnknown(gormkratos.TranslateDbError(err)))
+
+	faults.FailCommit(driver.ErrBadConn)
+	erk = gormkratos.TransactionErk(context.Background(), db, createTransfer)
+	require.True(t, dberrors.IsServerDbCommitOutcomeUnknown(erk))
+}
+
+// TestCommitOutcomeDefinite tests other COMMIT failures are definite, nothing committed
+// TestCommitOutcomeDefinite 测试其他提交失败是确定的, 没有数据提交
+func TestCommitOutcomeDefinite(t *testing.T) {
+	db, faults := gormkratostest.NewFaultDB(t, &Transfer{})
+	cause := erero.New("constraint check failed on commit")
+	faults.FailCommit(cause)
+
+	erk, err := gormkratos.Transaction(context.Background(), db, createTransfer)
+	require.Nil(t, erk)
+	require.ErrorIs(t, err, cause)
+	require.False(t, gormkratos.IsCommitOutcomeUnknown(err))
+
+	var commitErr *gormkratos.CommitError
+	require.ErrorAs(t, err, &commitErr)
+	require.False(t, commitErr.OutcomeUnknown)
+	require.Equal(t, gormkratos.TxOutcomeDbError, gormkratos.ClassifyTxOutcome(context.Background(), erk, err))
+	require.Equal(t, int64(0), countTransfers(t, db))
+}
+
+// TestCommitOutcomeRetry tests TransactionRetry does not run unknown outcomes again
+// TestCommitOutcomeRetry 测试 TransactionRetry 不会重新执行结果未知的事务
+func TestCommitOutcomeRetry(t *testing.T) {
+	db, faults := gormkratostest.NewFaultDB(t, &Transfer{})
+	faults.FailCommitApplied(driver.ErrBadConn)
+
+	var attempts int
+	retry := gormkratos.NewRetryConfig().WithBackoff(time.Millisecond, time.Millisecond, 1).WithIsRetryable(func(err error) bool {
+		return true
+	})
+	erk, err := gormkratos.TransactionRetry(context.Background(), db, retry, func(db *gorm.DB) *errors.Error {
+		attempts++
+		return createTransfer(db)
+	})
+	require.Nil(t, erk)
+	require.True(t, gormkratos.IsCommitOutcomeUnknown(err))
+	require.Equal(t, 1, attempts)
+	require.Equal(t, int64(1), countTransfers(t, db))
+}
+
+// TestCommitMarkerResolvesCommitted tests the marker turns applied commits into success
+// TestCommitMarkerResolvesCommitted 测试标记将已生效的提交转为成功
+func TestCommitMarkerResolvesCommitted(t *testing.T) {
+	db, faults := gormkratostest.NewFaultDB(t, &Transfer{})
+	require.NoError(t, db.Use(gormkratos.NewCommitMarkerPlugin(gormkratos.NewCommitMarkerConfig())))
+	faults.FailCommitApplied(driver.ErrBadConn)
+
+	var committed bool
+	erk, err := gormkratos.Transaction(context.Background(), db, func(db *gorm.DB) *errors.Error {
+		gormkratos.AfterCommit(db.Statement.Context, func(ctx context.Context) {
+			committed = true
+		})
+		return createTransfer(db)
+	})
+	gormkratostest.RequireCommitted(t, erk, err)
+	require.True(t, committed)
+	require.Equal(t, int64(1), countTransfers(t, db))
+}
+
+// TestCommitMarkerResolvesRolledBack tests the marker turns not applied commits into definite failures
+// TestCommitMarkerResolvesRolledBack 测试标记将未生效的提交转为确定的失败
+func TestCommitMarkerResolvesRolledBack(t *testing.T) {
+	db, faults := gormkratostest.NewFaultDB(t, &Transfer{})
+	require.NoError(t, db.Use(gormkratos.NewCommitMarkerPlugin(gormkratos.NewCommitMarkerConfig())))
+	faults.FailCommit(driver.ErrBadConn)
+
+	erk, err := gormkratos.Transaction(context.Background(), db, createTransfer)
+	require.Nil(t, erk)
+	require.ErrorIs(t, err, driver.ErrBadConn)
+	require.False(t, gormkratos.IsCommitOutcomeUnknown(err))
+
+	var commitErr *gormkratos.CommitError
+	require.ErrorAs(t, err, &commitErr)
+	require.True(t, dberrors.IsServerDbCommitFailed(gormkratos.GetErkTranslator()(err)))
+	require.Equal(t, int64(0), countTransfers(t, db))
+}
+
+// TestCommitMarkerNested tests nested transactions write no marker of their own
+// TestCommitMarkerNested 测试嵌套事务不单独写入标记
+func TestCommitMarkerNested(t *testing.T) {
+	db, _ := gormkratostest.NewFaultDB(t, &Transfer{})
+	require.NoError(t, db.Use(gormkratos.NewCommitMarkerPlugin(gormkratos.NewCommitMarkerConfig())))
+
+	erk, err := gormkratos.Transaction(context.Background(), db, func(db *gorm.DB) *errors.Error {
+		erk, err := gormkratos.Transaction(db.Statement.Context, db, createTransfer)
+		gormkratostest.RequireCommitted(t, erk, err)
+		return nil
+	})
+	gormkratostest.RequireCommitted(t, erk, err)
+
+	var count int64
+	require.NoError(t, db.Model(&gormkratos.CommitMarker{}).Count(&count).Error)
+	require.Equal(t, int64(1), count)
+}
+
+// TestPurgeCommitMarkers tests purging deletes markers written before the time
+// TestPurgeCommitMarkers 测试清理删除该时间之前写入的标记
+func TestPurgeCommitMarkers(t *testing.T) {
+	db, _ := gormkratostest.NewFaultDB(t, &Transfer{})
+	require.NoError(t, db.Use(gormkratos.NewCommitMarkerPlugin(gormkratos.NewCommitMarkerConfig())))
+
+	for range 3 {
+		erk, err := gormkratos.Transaction(context.Background(), db, createTransfer)
+		gormkratostest.RequireCommitted(t, erk, err)
+	}
+
+	count, err := gormkratos.PurgeCommitMarkers(context.Background(), db, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, int64(0), count)
+
+	count, err = gormkratos.PurgeCommitMarkers(context.Background(), db, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	require.Equal(t, int64(3), count)
+}
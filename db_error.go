@@ -0,0 +1,252 @@
+package gormkratos
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/orzkratos/gormkratos/api/dberrors/v1"
+	"github.com/yyle88/erero"
+	"gorm.io/gorm"
+)
+
+// DbErrorCategory is the category of database errors, independent of the driver
+//
+// DbErrorCategory 是数据库错误的类别, 与驱动无关
+type DbErrorCategory string
+
+const (
+	DbErrorUnknown             DbErrorCategory = "unknown"               // Not classified // 未分类
+	DbErrorNotFound            DbErrorCategory = "not_found"             // Record not found // 记录不存在
+	DbErrorUniqueViolation     DbErrorCategory = "unique_violation"      // Unique constraint violated // 违反唯一约束
+	DbErrorForeignKeyViolation DbErrorCategory = "foreign_key_violation" // Foreign key constraint violated // 违反外键约束
+	DbErrorNotNullViolation    DbErrorCategory = "not_null_violation"    // Not-null constraint violated // 违反非空约束
+	DbErrorCheckViolation      DbErrorCategory = "check_violation"       // Check constraint violated // 违反检查约束
+	DbErrorDeadlock            DbErrorCategory = "deadlock"              // Deadlock detected // 检测到死锁
+	DbErrorLockTimeout         DbErrorCategory = "lock_timeout"          // Lock wait timeout or NOWAIT lock not available // 锁等待超时或 NOWAIT 无法获取锁
+	DbErrorSerialization       DbErrorCategory = "serialization"         // Serialization failure // 串行化失败
+	DbErrorTimeout             DbErrorCategory = "timeout"               // Deadline exceeded or statement timeout // 超时或语句超时
+	DbErrorCanceled            DbErrorCategory = "canceled"              // Context canceled // 上下文被取消
+	DbErrorConnectionLost      DbErrorCategory = "connection_lost"       // Connection lost or closed // 连接断开或已关闭
+
+	DbErrorCommitOutcomeUnknown DbErrorCategory = "commit_outcome_unknown" // Connection broke during COMMIT, see CommitError // 提交时连接断开, 参见 CommitError
+	DbErrorPartialCommit        DbErrorCategory = "partial_commit"         // Some databases of MultiTransaction committed, see PartialCommitError // MultiTransaction 中部分数据库已提交, 参见 PartialCommitError
+)
+
+// Retryable reports whether the whole transaction may succeed when run again
+//
+// Retryable 判断整个事务重新执行时是否可能成功
+func (c DbErrorCategory) Retryable() bool {
+	return c == DbErrorDeadlock || c == DbErrorSerialization || c == DbErrorLockTimeout
+}
+
+// postgresCategories maps SQLSTATE codes (Postgres and drivers exposing SQLState) to categories
+// postgresCategories 将 SQLSTATE 错误码 (Postgres 及提供 SQLState 的驱动) 映射为类别
+var postgresCategories = map[string]DbErrorCategory{
+	"23505": DbErrorUniqueViolation,
+	"23503": DbErrorForeignKeyViolation,
+	"23502": DbErrorNotNullViolation,
+	"23514": DbErrorCheckViolation,
+	"40001": DbErrorSerialization,
+	"40P01": DbErrorDeadlock,
+	"55P03": DbErrorLockTimeout, // lock_not_available, lock_timeout and NOWAIT
+	"57014": DbErrorTimeout,     // query_canceled, such as statement_timeout
+	"57P01": DbErrorConnectionLost,
+	"57P02": DbErrorConnectionLost,
+	"57P03": DbErrorConnectionLost,
+}
+
+// mysqlCategories maps MySQL error numbers to categories
+// mysqlCategories 将 MySQL 错误号映射为类别
+var mysqlCategories = map[int]DbErrorCategory{
+	1062: DbErrorUniqueViolation,     // ER_DUP_ENTRY
+	1586: DbErrorUniqueViolation,     // ER_DUP_ENTRY_WITH_KEY_NAME
+	1216: DbErrorForeignKeyViolation, // ER_NO_REFERENCED_ROW
+	1217: DbErrorForeignKeyViolation, // ER_ROW_IS_REFERENCED
+	1451: DbErrorForeignKeyViolation, // ER_ROW_IS_REFERENCED_2
+	1452: DbErrorForeignKeyViolation, // ER_NO_REFERENCED_ROW_2
+	1048: DbErrorNotNullViolation,    // ER_BAD_NULL_ERROR
+	1364: DbErrorNotNullViolation,    // ER_NO_DEFAULT_FOR_FIELD
+	3819: DbErrorCheckViolation,      // ER_CHECK_CONSTRAINT_VIOLATED
+	1213: DbErrorDeadlock,            // ER_LOCK_DEADLOCK
+	1205: DbErrorLockTimeout,         // ER_LOCK_WAIT_TIMEOUT
+	3572: DbErrorLockTimeout,         // ER_LOCK_NOWAIT
+	3024: DbErrorTimeout,             // ER_QUERY_TIMEOUT
+	2006: DbErrorConnectionLost,      // CR_SERVER_GONE_ERROR
+	2013: DbErrorConnectionLost,      // CR_SERVER_LOST
+}
+
+// mysqlErrorRegexp matches MySQL driver messages such as "Error 1062 (23000): Duplicate entry"
+// mysqlErrorRegexp 匹配 MySQL 驱动的错误消息, 例如 "Error 1062 (23000): Duplicate entry"
+var mysqlErrorRegexp = regexp.MustCompile(`Error (\d{4})\b`)
+
+// messageCategories maps message fragments to categories, covering SQLite and drivers without error codes
+// messageCategories 将消息片段映射为类别, 覆盖 SQLite 及不提供错误码的驱动
+var messageCategories = []struct {
+	pattern  string
+	category DbErrorCategory
+}{
+	{"UNIQUE constraint failed", DbErrorUniqueViolation},
+	{"FOREIGN KEY constraint failed", DbErrorForeignKeyViolation},
+	{"NOT NULL constraint failed", DbErrorNotNullViolation},
+	{"CHECK constraint failed", DbErrorCheckViolation},
+	{"database is locked", DbErrorLockTimeout},       // SQLite busy, the busy timeout ran out
+	{"database table is locked", DbErrorLockTimeout}, // SQLite locked, shared cache tables
+	{"SQLSTATE 40001", DbErrorSerialization},
+	{"SQLSTATE 40P01", DbErrorDeadlock},
+	{"broken pipe", DbErrorConnectionLost},
+	{"connection reset by peer", DbErrorConnectionLost},
+	{"connection refused", DbErrorConnectionLost},
+}
+
+// ClassifyDbError classifies GORM and driver errors into categories
+// Checks GORM errors, context errors, SQLSTATE codes, MySQL error numbers and SQLite messages in turn
+// Returns DbErrorUnknown when err is nil or not recognized
+//
+// ClassifyDbError 将 GORM 和驱动错误分类
+// 依次检查 GORM 错误, 上下文错误, SQLSTATE 错误码, MySQL 错误号和 SQLite 错误消息
+// 当 err 为 nil 或无法识别时返回 DbErrorUnknown
+func ClassifyDbError(err error) DbErrorCategory {
+	switch {
+	case err == nil:
+		return DbErrorUnknown
+	case IsPartialCommit(err):
+		return DbErrorPartialCommit
+	case IsCommitOutcomeUnknown(err):
+		return DbErrorCommitOutcomeUnknown
+	case erero.Is(err, gorm.ErrRecordNotFound):
+		return DbErrorNotFound
+	case erero.Is(err, gorm.ErrDuplicatedKey):
+		return DbErrorUniqueViolation
+	case erero.Is(err, gorm.ErrForeignKeyViolated):
+		return DbErrorForeignKeyViolation
+	case erero.Is(err, gorm.ErrCheckConstraintViolated):
+		return DbErrorCheckViolation
+	case erero.Is(err, context.DeadlineExceeded):
+		return DbErrorTimeout
+	case erero.Is(err, context.Canceled):
+		return DbErrorCanceled
+	case erero.Is(err, driver.ErrBadConn), erero.Is(err, sql.ErrConnDone):
+		return DbErrorConnectionLost
+	}
+
+	var stateErr interface{ SQLState() string }
+	if erero.As(err, &stateErr) {
+		state := stateErr.SQLState()
+		if category, ok := postgresCategories[state]; ok {
+			return category
+		}
+		if strings.HasPrefix(state, "08") { // Class 08 connection exception
+			return DbErrorConnectionLost
+		}
+	}
+
+	message := err.Error()
+	if match := mysqlErrorRegexp.FindStringSubmatch(message); match != nil {
+		number, _ := strconv.Atoi(match[1]) // Four digits matched // 已匹配四位数字
+		if category, ok := mysqlCategories[number]; ok {
+			return category
+		}
+	}
+	for _, item := range messageCategories {
+		if strings.Contains(message, item.pattern) {
+			return item.category
+		}
+	}
+	return DbErrorUnknown
+}
+
+// defaultDbErrorTranslators maps categories to Kratos errors by default
+// defaultDbErrorTranslators 默认将类别映射为 Kratos 错误
+var defaultDbErrorTranslators = map[DbErrorCategory]ErkTranslator{
+	DbErrorNotFound: func(err error) *errors.Error {
+		return dberrors.ErrorDbRecordNotFound("record not found: %v", err)
+	},
+	DbErrorUniqueViolation: func(err error) *errors.Error {
+		return dberrors.ErrorDbUniqueViolation("unique constraint violated: %v", err)
+	},
+	DbErrorForeignKeyViolation: func(err error) *errors.Error {
+		return dberrors.ErrorDbForeignKeyViolation("foreign key constraint violated: %v", err)
+	},
+	DbErrorNotNullViolation: func(err error) *errors.Error {
+		return dberrors.ErrorDbConstraintViolation("not-null constraint violated: %v", err)
+	},
+	DbErrorCheckViolation: func(err error) *errors.Error {
+		return dberrors.ErrorDbConstraintViolation("check constraint violated: %v", err)
+	},
+	DbErrorDeadlock: func(err error) *errors.Error {
+		return dberrors.ErrorServerDbDeadlock("deadlock: %v", err)
+	},
+	DbErrorLockTimeout: func(err error) *errors.Error {
+		return dberrors.ErrorServerDbLockTimeout("lock not available: %v", err)
+	},
+	DbErrorSerialization: func(err error) *errors.Error {
+		return dberrors.ErrorServerDbSerializationFailure("serialization failure: %v", err)
+	},
+	DbErrorTimeout: func(err error) *errors.Error {
+		return dberrors.ErrorServerDbTimeout("database timeout: %v", err)
+	},
+	DbErrorCanceled: func(err error) *errors.Error {
+		return dberrors.ErrorServerDbTimeout("database operation canceled: %v", err)
+	},
+	DbErrorConnectionLost: func(err error) *errors.Error {
+		return dberrors.ErrorServerDbConnectionLost("database connection lost: %v", err)
+	},
+	DbErrorCommitOutcomeUnknown: func(err error) *errors.Error {
+		return dberrors.ErrorServerDbCommitOutcomeUnknown("commit outcome unknown: %v", err)
+	},
+	DbErrorPartialCommit: func(err error) *errors.Error {
+		return newPartialCommitErk("%v", err)
+	},
+	DbErrorUnknown: defaultErkTranslator,
+}
+
+// SetDbErrorTranslator overrides the Kratos error of one category used by TranslateDbError
+// Usually set once on service startup, safe to call concurrently, passing nil restores the default translator of the category
+//
+// SetDbErrorTranslator 覆盖 TranslateDbError 对某个类别使用的 Kratos 错误
+// 通常在服务启动时设置一次, 可并发调用, 传 nil 恢复该类别的默认转换函数
+func SetDbErrorTranslator(category DbErrorCategory, translator ErkTranslator) {
+	defaultConfig.mutex.Lock()
+	defer defaultConfig.mutex.Unlock()
+	if translator == nil {
+		delete(defaultConfig.DbErrorTranslators, category)
+		return
+	}
+	defaultConfig.DbErrorTranslators[category] = translator
+}
+
+// GetDbErrorTranslator returns the translator of the category
+//
+// GetDbErrorTranslator 返回该类别的转换函数
+func GetDbErrorTranslator(category DbErrorCategory) ErkTranslator {
+	defaultConfig.mutex.RLock()
+	translator, ok := defaultConfig.DbErrorTranslators[category]
+	defaultConfig.mutex.RUnlock()
+	if ok {
+		return translator
+	}
+	if translator, ok := defaultDbErrorTranslators[category]; ok {
+		return translator
+	}
+	return defaultDbErrorTranslators[DbErrorUnknown]
+}
+
+// TranslateDbError classifies err and converts it into the Kratos error of its category
+// Defaults: not found 404, unique and foreign key 409, not-null and check 400
+// deadlock, lock timeout, serialization and connection lost 503, timeout and canceled 504
+// commit outcome unknown and partial commit 500, unknown uses the default ErkTranslator
+// Use it as the ErkTranslator with SetErkTranslator(gormkratos.TranslateDbError)
+//
+// TranslateDbError 对 err 分类并转换为该类别的 Kratos 错误
+// 默认: 记录不存在 404, 唯一约束和外键约束 409, 非空约束和检查约束 400
+// 死锁, 锁超时, 串行化失败和连接断开 503, 超时和取消 504
+// 提交结果未知和部分提交 500, 未知类别使用默认的 ErkTranslator
+// 通过 SetErkTranslator(gormkratos.TranslateDbError) 将其作为 ErkTranslator 使用
+func TranslateDbError(err error) *errors.Error {
+	return GetDbErrorTranslator(ClassifyDbError(err))(err)
+}
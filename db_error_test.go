@@ -0,0 +1,167 @@
+package gormkratos_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/google/uuid"
+	"github.com/orzkratos/gormkratos"
+	"github.com/orzkratos/gormkratos/api/dberrors/v1"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/must"
+	"github.com/yyle88/rese"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Customer has unique, not-null and check constraints
+// Customer 带有唯一约束, 非空约束和检查约束
+type Customer struct {
+	ID    uint   `gorm:"primarykey"`
+	Email string `gorm:"uniqueIndex;not null"`
+	Age   int    `gorm:"check:age >= 0"`
+}
+
+// Invoice references Customer with foreign key
+// Invoice 通过外键引用 Customer
+type Invoice struct {
+	ID         uint `gorm:"primarykey"`
+	CustomerID uint
+	Customer   Customer
+}
+
+// stateError mimics driver errors exposing SQLSTATE, such as pgconn.PgError
+// stateError 模拟提供 SQLSTATE 的驱动错误, 例如 pgconn.PgError
+type stateError struct{ state string }
+
+func (e *stateError) Error() string    { return "pg error " + e.state }
+func (e *stateError) SQLState() string { return e.state }
+
+// setupConstraintDB creates in-memory SQLite database enforcing foreign keys
+// setupConstraintDB 创建启用外键约束的内存 SQLite 数据库
+func setupConstraintDB(t *testing.T) *gorm.DB {
+	dsn := fmt.Sprintf("file:db-%s?mode=memory&cache=shared&_foreign_keys=1", uuid.New().String())
+	db := rese.P1(gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Info),
+	}))
+	t.Cleanup(func() {
+		must.Done(rese.P1(db.DB()).Close())
+	})
+	require.NoError(t, db.AutoMigrate(&Customer{}, &Invoice{}))
+	return db
+}
+
+// TestClassifyDbErrorSQLite tests constraint violations reported by SQLite
+// TestClassifyDbErrorSQLite 测试 SQLite 报告的约束违反
+func TestClassifyDbErrorSQLite(t *testing.T) {
+	db := setupConstraintDB(t)
+	require.NoError(t, db.Create(&Customer{Email: "a@example.com"}).Error)
+
+	err := db.Create(&Customer{Email: "a@example.com"}).Error
+	require.Equal(t, gormkratos.DbErrorUniqueViolation, gormkratos.ClassifyDbError(err))
+
+	err = db.Exec("INSERT INTO customers (email, age) VALUES (NULL, 1)").Error
+	require.Equal(t, gormkratos.DbErrorNotNullViolation, gormkratos.ClassifyDbError(err))
+
+	err = db.Create(&Customer{Email: "b@example.com", Age: -1}).Error
+	require.Equal(t, gormkratos.DbErrorCheckViolation, gormkratos.ClassifyDbError(err))
+
+	err = db.Omit("Customer").Create(&Invoice{CustomerID: 100}).Error
+	require.Equal(t, gormkratos.DbErrorForeignKeyViolation, gormkratos.ClassifyDbError(err))
+
+	err = db.First(&Customer{}, 100).Error
+	require.Equal(t, gormkratos.DbErrorNotFound, gormkratos.ClassifyDbError(err))
+}
+
+// TestClassifyDbErrorDrivers tests SQLSTATE codes, MySQL error numbers and Go errors
+// TestClassifyDbErrorDrivers 测试 SQLSTATE 错误码, MySQL 错误号和 Go 错误
+func TestClassifyDbErrorDrivers(t *testing.T) {
+	for _, tc := range []struct {
+		err      error
+		category gormkratos.DbErrorCategory
+	}{
+		{nil, gormkratos.DbErrorUnknown},
+		{erero.New("something else"), gormkratos.DbErrorUnknown},
+		{erero.Wro(&stateError{state: "23505"}), gormkratos.DbErrorUniqueViolation},
+		{&stateError{state: "23503"}, gormkratos.DbErrorForeignKeyViolation},
+		{&stateError{state: "40001"}, gormkratos.DbErrorSerialization},
+		{&stateError{state: "40P01"}, gormkratos.DbErrorDeadlock},
+		{&stateError{state: "55P03"}, gormkratos.DbErrorLockTimeout},
+		{&stateError{state: "57014"}, gormkratos.DbErrorTimeout},
+		{&stateError{state: "08006"}, gormkratos.DbErrorConnectionLost},
+		{erero.New("Error 1062 (23000): Duplicate entry 'a' for key 'email'"), gormkratos.DbErrorUniqueViolation},
+		{erero.New("Error 1452 (23000): Cannot add or update a child row"), gormkratos.DbErrorForeignKeyViolation},
+		{erero.New("Error 1048 (23000): Column 'email' cannot be null"), gormkratos.DbErrorNotNullViolation},
+		{erero.New("Error 1213 (40001): Deadlock found when trying to get lock"), gormkratos.DbErrorDeadlock},
+		{erero.New("Error 1205 (HY000): Lock wait timeout exceeded; try restarting transaction"), gormkratos.DbErrorLockTimeout},
+		{erero.New("Error 3572 (HY000): Statement aborted because lock(s) could not be acquired immediately and NOWAIT is set."), gormkratos.DbErrorLockTimeout},
+		{erero.New("Error 2013: Lost connection to MySQL server during query"), gormkratos.DbErrorConnectionLost},
+		{erero.Wro(gorm.ErrDuplicatedKey), gormkratos.DbErrorUniqueViolation},
+		{erero.Wro(gorm.ErrForeignKeyViolated), gormkratos.DbErrorForeignKeyViolation},
+		{erero.Wro(context.DeadlineExceeded), gormkratos.DbErrorTimeout},
+		{erero.Wro(context.Canceled), gormkratos.DbErrorCanceled},
+		{erero.Wro(driver.ErrBadConn), gormkratos.DbErrorConnectionLost},
+	} {
+		require.Equal(t, tc.category, gormkratos.ClassifyDbError(tc.err), "%v", tc.err)
+	}
+}
+
+// TestTranslateDbError tests the default mapping into Kratos errors
+// TestTranslateDbError 测试默认映射为 Kratos 错误
+func TestTranslateDbError(t *testing.T) {
+	require.True(t, dberrors.IsDbRecordNotFound(gormkratos.TranslateDbError(gorm.ErrRecordNotFound)))
+	require.True(t, dberrors.IsDbUniqueViolation(gormkratos.TranslateDbError(gorm.ErrDuplicatedKey)))
+	require.True(t, dberrors.IsDbConstraintViolation(gormkratos.TranslateDbError(&stateError{state: "23502"})))
+	require.True(t, dberrors.IsServerDbDeadlock(gormkratos.TranslateDbError(&stateError{state: "40P01"})))
+	require.True(t, dberrors.IsServerDbLockTimeout(gormkratos.TranslateDbError(&stateError{state: "55P03"})))
+	require.True(t, dberrors.IsServerDbTimeout(gormkratos.TranslateDbError(context.DeadlineExceeded)))
+	require.True(t, dberrors.IsServerDbTransactionError(gormkratos.TranslateDbError(erero.New("something else"))))
+
+	require.Equal(t, int32(409), gormkratos.TranslateDbError(gorm.ErrForeignKeyViolated).Code)
+	require.Equal(t, int32(400), gormkratos.TranslateDbError(gorm.ErrCheckConstraintViolated).Code)
+	require.Equal(t, int32(503), gormkratos.TranslateDbError(driver.ErrBadConn).Code)
+	require.Equal(t, int32(504), gormkratos.TranslateDbError(context.Canceled).Code)
+}
+
+// TestSetDbErrorTranslator tests overriding the Kratos error of one category
+// TestSetDbErrorTranslator 测试覆盖某个类别的 Kratos 错误
+func TestSetDbErrorTranslator(t *testing.T) {
+	gormkratos.SetDbErrorTranslator(gormkratos.DbErrorUniqueViolation, func(err error) *errors.Error {
+		return errors.Conflict("EMAIL_TAKEN", "email already registered")
+	})
+	t.Cleanup(func() {
+		gormkratos.SetDbErrorTranslator(gormkratos.DbErrorUniqueViolation, nil) // Restore default // 恢复默认
+	})
+
+	require.Equal(t, "EMAIL_TAKEN", gormkratos.TranslateDbError(gorm.ErrDuplicatedKey).Reason)
+	require.True(t, dberrors.IsDbForeignKeyViolation(gormkratos.TranslateDbError(gorm.ErrForeignKeyViolated)))
+}
+
+// TestTransactionErkTranslateDbError tests plugging TranslateDbError in as the ErkTranslator
+// TestTransactionErkTranslateDbError 测试将 TranslateDbError 接入为 ErkTranslator
+func TestTransactionErkTranslateDbError(t *testing.T) {
+	gormkratos.SetErkTranslator(gormkratos.TranslateDbError)
+	t.Cleanup(func() {
+		gormkratos.SetErkTranslator(nil) // Restore default // 恢复默认
+	})
+
+	db := setupConstraintDB(t)
+	erk := gormkratos.TransactionErk(context.Background(), db, func(db *gorm.DB) *errors.Error {
+		return nil
+	})
+	require.Nil(t, erk)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	erk = gormkratos.TransactionErk(ctx, db, func(db *gorm.DB) *errors.Error {
+		time.Sleep(100 * time.Millisecond) // Exceed timeout // 超过超时时间
+		return nil
+	})
+	require.True(t, dberrors.IsServerDbTimeout(erk))
+}
@@ -26,11 +26,15 @@ import (
 // Error combinations:
 // When err != nil:
 // - erk != nil: Business logic error caused rollback
-// - erk == nil: Database commit failed
+// - erk == nil: Database commit failed, see CommitError when COMMIT itself failed
 // When err == nil:
 // - (erk must also be nil) Both succeeded
 //
-// Recommended usage pattern (MUST follow this pattern):
+// Hooks registered with AfterCommit and AfterRollback through db.Statement.Context run once the outcome is known.
+// Neither runs when the COMMIT outcome is unknown, see IsCommitOutcomeUnknown.
+//
+// Use TransactionErk to get a single Kratos error without handling the two errors by hand.
+// When calling Transaction directly, follow this pattern:
 //
 //	erk, err := gormkratos.Transaction(ctx, db, run)
 //	if err != nil {
@@ -52,11 +56,15 @@ import (
 // 错误组合:
 // 当 err != nil:
 // - erk != nil: 业务逻辑错误导致回滚
-// - erk == nil: 数据库提交失败
+// - erk == nil: 数据库提交失败, COMMIT 本身失败时参见 CommitError
 // 当 err == nil:
 // - (erk 也必然是 nil) 两者都成功
 //
-// 推荐用法 (必须遵循此模式):
+// 通过 db.Statement.Context 使用 AfterCommit 和 AfterRollback 注册的钩子在结果确定后执行.
+// COMMIT 结果未知时两者都不执行, 参见 IsCommitOutcomeUnknown.
+//
+// 使用 TransactionErk 可以直接得到单个 Kratos 错误, 无需手动处理两个错误.
+// 直接调用 Transaction 时, 遵循此模式:
 //
 //	erk, err := gormkratos.Transaction(ctx, db, run)
 //	if err != nil {
@@ -71,25 +79,96 @@ func Transaction(
 	run func(db *gorm.DB) *errors.Error,
 	options ...*sql.TxOptions,
 ) (erk *errors.Error, err error) {
+	// Hooks registered inside run, linked to the parent when nested
+	// run 中注册的钩子, 嵌套时关联到父事务
+	hooks := newTxHooks(db)
+
+	// Notify observers registered on db, such as tracing and metrics
+	// 通知 db 上注册的观察者, 例如链路追踪和指标
+	txCtx, finish := observeTx(ctx, db, &TxInfo{
+		Name:    TxNameFromContext(ctx),
+		Options: firstTxOptions(options),
+		Attempt: attemptFromContext(ctx),
+		Depth:   hooks.depth,
+	})
+	defer func() {
+		if value := recover(); value != nil {
+			// GORM rolled back, finish observers then keep panicking
+			// Panics of hooks come after finish, which runs once, so the outcome is kept
+			// GORM 已回滚, 结束观察者后继续 panic
+			// 钩子的 panic 发生在 finish 之后, finish 只执行一次, 因此保留原结果
+			finish(nil, erero.Errorf("transaction panic: %v", value))
+			panic(value)
+		}
+	}()
+
+	// Outermost transactions commit, nested ones release savepoints
+	// Outermost transactions write commit markers when the commit marker plugin is registered, read-only ones write nothing
+	// 最外层事务执行提交, 嵌套事务释放保存点
+	// 注册了提交标记插件时, 最外层事务写入提交标记, 只读事务不写入
+	_, nested := db.Statement.ConnPool.(gorm.TxCommitter)
+	var marker *CommitMarkerPlugin
+	if option := firstTxOptions(options); !nested && (option == nil || !option.ReadOnly) {
+		marker = commitMarkerOf(db)
+	}
+	var markerID string
+	var committing bool
+
 	// Execute transaction with context and options
 	// 使用上下文和选项执行事务
-	if err = db.WithContext(ctx).Transaction(func(db *gorm.DB) error {
+	if err = db.WithContext(hooks.bind(txCtx)).Transaction(func(db *gorm.DB) error {
 		if erk = run(db); erk != nil {
 			return erk // Business errors cause rollback // 业务错误导致回滚
 		}
+		if marker != nil {
+			var err error
+			if markerID, err = marker.mark(db); err != nil {
+				return err
+			}
+		}
+		committing = !nested
 		return nil
 	}, options...); err != nil {
 		if erk != nil {
 			// Business error caused rollback, return both errors
 			// 业务错误导致回滚, 返回两个错误
-			return erk, erero.Wro(err)
+			err = erero.Wro(err)
+			finish(erk, err)
+			hooks.rolledBack(ctx, erk, err)
+			return erk, err
 		}
 		// Database error, wrap and return
+		// database/sql rolls back when ctx is done and then reports sql.ErrTxDone, join ctx.Err() to keep the cause
 		// 数据库错误, 包装后返回
-		return nil, erero.Wro(err)
+		// ctx 结束时 database/sql 会回滚并报告 sql.ErrTxDone, 合并 ctx.Err() 以保留原因
+		if ctxErr := ctx.Err(); ctxErr != nil && !erero.Is(err, ctxErr) {
+			err = erero.Join(err, ctxErr)
+		}
+		if committing {
+			// COMMIT failed, tell unknown outcomes apart, the commit marker may prove it committed
+			// 提交失败, 区分未知结果, 提交标记可能证明其已提交
+			err = newCommitError(ctx, db, marker, markerID, err)
+		}
+		if err != nil {
+			err = erero.Wro(err)
+			finish(nil, err)
+			hooks.rolledBack(ctx, nil, err)
+			return nil, err
+		}
 	}
 
-	// Transaction succeeded
-	// 事务成功
+	// Transaction succeeded, nested hooks are deferred to the outermost commit
+	// 事务成功, 嵌套事务的钩子延迟到最外层提交
+	finish(nil, nil)
+	hooks.committed(ctx)
 	return nil, nil
 }
+
+// firstTxOptions returns the options used by GORM, nil when not set
+// firstTxOptions 返回 GORM 使用的选项, 未设置时为 nil
+func firstTxOptions(options []*sql.TxOptions) *sql.TxOptions {
+	if len(options) > 0 {
+		return options[0]
+	}
+	return nil
+}
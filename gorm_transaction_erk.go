@@ -0,0 +1,110 @@
+package gormkratos
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/orzkratos/gormkratos/api/dberrors/v1"
+	"github.com/yyle88/erero"
+	"gorm.io/gorm"
+)
+
+// ErkTranslator converts database transaction errors (erk == nil, err != nil) into Kratos errors
+// Each service plugs in its own generated ErrorServerDbTransactionError
+//
+// ErkTranslator 将数据库事务错误 (erk == nil, err != nil) 转换为 Kratos 错误
+// 每个服务可以接入自己生成的 ErrorServerDbTransactionError
+type ErkTranslator func(err error) *errors.Error
+
+// config for converting transaction failures into Kratos errors
+// Setters may run while transactions translate errors, the mutex guards the fields
+//
+// config 将事务失败转换为 Kratos 错误的配置
+// 设置函数可能在事务转换错误时执行, 由互斥锁保护各字段
+type config struct {
+	mutex           sync.RWMutex    // Guards the fields below // 保护以下字段
+	ErkTranslator   ErkTranslator   // Translates database errors into Kratos errors // 将数据库错误转换为 Kratos 错误
+	PanicTranslator PanicTranslator // Translates recovered panics into Kratos errors // 将捕获的 panic 转换为 Kratos 错误
+
+	DbErrorTranslators map[DbErrorCategory]ErkTranslator // Overrides used by TranslateDbError // TranslateDbError 使用的覆盖转换函数
+}
+
+var defaultConfig = &config{
+	ErkTranslator:      defaultErkTranslator,
+	PanicTranslator:    defaultPanicTranslator,
+	DbErrorTranslators: map[DbErrorCategory]ErkTranslator{},
+}
+
+// defaultErkTranslator wraps database errors as SERVER_DB_TRANSACTION_ERROR
+// COMMIT failures are SERVER_DB_COMMIT_OUTCOME_UNKNOWN or SERVER_DB_COMMIT_FAILED, see CommitError
+// Partial commits of MultiTransaction are SERVER_DB_PARTIAL_COMMIT, see PartialCommitError
+//
+// defaultErkTranslator 将数据库错误包装为 SERVER_DB_TRANSACTION_ERROR
+// 提交失败为 SERVER_DB_COMMIT_OUTCOME_UNKNOWN 或 SERVER_DB_COMMIT_FAILED, 参见 CommitError
+// MultiTransaction 的部分提交为 SERVER_DB_PARTIAL_COMMIT, 参见 PartialCommitError
+func defaultErkTranslator(err error) *errors.Error {
+	if IsPartialCommit(err) {
+		return newPartialCommitErk("transaction failed: %v", err)
+	}
+	var commitErr *CommitError
+	if erero.As(err, &commitErr) {
+		if commitErr.OutcomeUnknown {
+			return dberrors.ErrorServerDbCommitOutcomeUnknown("transaction failed: %v", err)
+		}
+		return dberrors.ErrorServerDbCommitFailed("transaction failed: %v", err)
+	}
+	return dberrors.ErrorServerDbTransactionError("transaction failed: %v", err)
+}
+
+// SetErkTranslator sets the translator used when the database transaction fails without business errors
+// Usually set once on service startup, safe to call concurrently, passing nil restores the default translator
+//
+// SetErkTranslator 设置数据库事务失败 (无业务错误) 时使用的转换函数
+// 通常在服务启动时设置一次, 可并发调用, 传 nil 恢复默认转换函数
+func SetErkTranslator(translator ErkTranslator) {
+	if translator == nil {
+		translator = defaultErkTranslator
+	}
+	defaultConfig.mutex.Lock()
+	defer defaultConfig.mutex.Unlock()
+	defaultConfig.ErkTranslator = translator
+}
+
+// GetErkTranslator returns the current translator
+//
+// GetErkTranslator 返回当前的转换函数
+func GetErkTranslator() ErkTranslator {
+	defaultConfig.mutex.RLock()
+	defer defaultConfig.mutex.RUnlock()
+	return defaultConfig.ErkTranslator
+}
+
+// TransactionErk executes a function in database transaction and returns a single Kratos error
+// Business errors (erk) are returned as-is, database errors (err) are converted with the ErkTranslator
+// Returns nil when both business logic and database transaction succeeded
+//
+// TransactionErk 在数据库事务中执行函数并返回单个 Kratos 错误
+// 业务错误 (erk) 原样返回, 数据库错误 (err) 通过 ErkTranslator 转换
+// 业务逻辑和数据库事务都成功时返回 nil
+func TransactionErk(
+	ctx context.Context,
+	db *gorm.DB,
+	run func(db *gorm.DB) *errors.Error,
+	options ...*sql.TxOptions,
+) *errors.Error {
+	return mergeErk(Transaction(ctx, db, run, options...))
+}
+
+// mergeErk collapses the two-error-return pattern into one Kratos error
+// mergeErk 将双错误返回模式合并为单个 Kratos 错误
+func mergeErk(erk *errors.Error, err error) *errors.Error {
+	if err != nil {
+		if erk != nil {
+			return erk
+		}
+		return GetErkTranslator()(err)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package gormkratos_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/orzkratos/errkratos/must/erkrequire"
+	"github.com/orzkratos/gormkratos"
+	"github.com/orzkratos/gormkratos/api/dberrors/v1"
+	"github.com/orzkratos/gormkratos/internal/errorspb"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// TestTransactionErkSuccess tests single-error transaction success
+// TestTransactionErkSuccess 测试单错误返回事务成功
+func TestTransactionErkSuccess(t *testing.T) {
+	db := setupTestDB(t)
+
+	// Teacher represents simple test data
+	// Teacher 表示简单的测试数据
+	type Teacher struct {
+		ID   uint   `gorm:"primarykey"`           // Auto-increment PK // 自增PK
+		Name string `gorm:"column:name;not null"` // Teacher name // 教师名称
+	}
+
+	require.NoError(t, db.AutoMigrate(&Teacher{}))
+
+	ctx := context.Background()
+
+	erk := gormkratos.TransactionErk(ctx, db, func(db *gorm.DB) *errors.Error {
+		if err := db.Create(&Teacher{Name: "test-teacher"}).Error; err != nil {
+			return errorspb.ErrorServerDbError("failed to create teacher: %v", err)
+		}
+		return nil
+	})
+	erkrequire.NoError(t, erk)
+
+	var count int64
+	require.NoError(t, db.Model(&Teacher{}).Count(&count).Error)
+	require.Equal(t, int64(1), count)
+}
+
+// TestTransactionErkBusinessError tests business errors are returned as-is
+// TestTransactionErkBusinessError 测试业务错误原样返回
+func TestTransactionErkBusinessError(t *testing.T) {
+	db := setupTestDB(t)
+	ctx := context.Background()
+
+	erk := gormkratos.TransactionErk(ctx, db, func(db *gorm.DB) *errors.Error {
+		return errorspb.ErrorBadRequest("invalid input")
+	})
+	erkrequire.Error(t, erk)
+	require.True(t, errorspb.IsBadRequest(erk))
+}
+
+// TestTransactionErkDatabaseError tests database errors are converted with the default translator
+// TestTransactionErkDatabaseError 测试数据库错误通过默认转换函数转换
+func TestTransactionErkDatabaseError(t *testing.T) {
+	db := setupTestDB(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	erk := gormkratos.TransactionErk(ctx, db, func(db *gorm.DB) *errors.Error {
+		time.Sleep(100 * time.Millisecond) // Exceed timeout // 超过超时时间
+		return nil
+	})
+	erkrequire.Error(t, erk)
+	require.True(t, dberrors.IsServerDbCommitFailed(erk)) // Rolled back at COMMIT // 在提交时回滚
+
+	// Fails before COMMIT, canceled ctx cannot begin
+	// 在提交前失败, 已取消的 ctx 无法开启事务
+	erk = gormkratos.TransactionErk(ctx, db, func(db *gorm.DB) *errors.Error {
+		return nil
+	})
+	require.True(t, dberrors.IsServerDbTransactionError(erk))
+}
+
+// TestSetErkTranslator tests plugging in a custom translator
+// TestSetErkTranslator 测试接入自定义转换函数
+func TestSetErkTranslator(t *testing.T) {
+	gormkratos.SetErkTranslator(func(err error) *errors.Error {
+		return errors.ServiceUnavailable("CUSTOM_TRANSACTION_ERROR", err.Error())
+	})
+	t.Cleanup(func() {
+		gormkratos.SetErkTranslator(nil) // Restore default // 恢复默认
+	})
+
+	db := setupTestDB(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	erk := gormkratos.TransactionErk(ctx, db, func(db *gorm.DB) *errors.Error {
+		time.Sleep(100 * time.Millisecond) // Exceed timeout // 超过超时时间
+		return nil
+	})
+	erkrequire.Error(t, erk)
+	require.Equal(t, "CUSTOM_TRANSACTION_ERROR", erk.Reason)
+	require.Equal(t, int32(503), erk.Code)
+}
+
+// TestSetTranslatorsConcurrent tests the translators can be set while transactions translate errors
+// TestSetTranslatorsConcurrent 测试可以在事务转换错误的同时设置转换函数
+func TestSetTranslatorsConcurrent(t *testing.T) {
+	t.Cleanup(func() {
+		gormkratos.SetErkTranslator(nil)
+		gormkratos.SetPanicTranslator(nil)
+		gormkratos.SetDbErrorTranslator(gormkratos.DbErrorNotFound, nil)
+	})
+
+	var wg sync.WaitGroup
+	for idx := range 4 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			gormkratos.SetErkTranslator(gormkratos.TranslateDbError)
+			gormkratos.SetPanicTranslator(nil)
+			gormkratos.SetDbErrorTranslator(gormkratos.DbErrorNotFound, func(err error) *errors.Error {
+				return errorspb.ErrorBadRequest("missing %d: %v", idx, err)
+			})
+		}()
+		go func() {
+			defer wg.Done()
+			require.NotNil(t, gormkratos.TranslateDbError(gorm.ErrRecordNotFound))
+			require.NotNil(t, gormkratos.GetErkTranslator()(gorm.ErrRecordNotFound))
+			require.NotNil(t, gormkratos.GetPanicTranslator()("boom"))
+		}()
+	}
+	wg.Wait()
+	require.True(t, errorspb.IsBadRequest(gormkratos.TranslateDbError(gorm.ErrRecordNotFound)))
+}
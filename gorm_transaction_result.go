@@ -0,0 +1,34 @@
+package gormkratos
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"gorm.io/gorm"
+)
+
+// TransactionResult executes a function in database transaction and returns the value computed inside it
+// The value is returned only when the transaction commits, else the zero value is returned
+// Returns the same two errors as Transaction
+//
+// TransactionResult 在数据库事务中执行函数并返回其中计算的值
+// 只有事务提交时才返回该值, 否则返回零值
+// 返回与 Transaction 相同的两个错误
+func TransactionResult[T any](
+	ctx context.Context,
+	db *gorm.DB,
+	run func(db *gorm.DB) (T, *errors.Error),
+	options ...*sql.TxOptions,
+) (T, *errors.Error, error) {
+	var res T
+	erk, err := Transaction(ctx, db, func(db *gorm.DB) (erk *errors.Error) {
+		res, erk = run(db)
+		return erk
+	}, options...)
+	if err != nil {
+		var zero T
+		return zero, erk, err
+	}
+	return res, nil, nil
+}
@@ -0,0 +1,61 @@
+package gormkratos_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/orzkratos/errkratos/must/erkrequire"
+	"github.com/orzkratos/gormkratos"
+	"github.com/orzkratos/gormkratos/internal/errorspb"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// TestTransactionResultSuccess tests the value computed inside is returned on commit
+// TestTransactionResultSuccess 测试提交时返回事务中计算的值
+func TestTransactionResultSuccess(t *testing.T) {
+	db, _ := setupOrderRepo(t)
+
+	order, erk, err := gormkratos.TransactionResult(context.Background(), db, func(db *gorm.DB) (*Order, *errors.Error) {
+		order := &Order{Name: "result"}
+		if err := db.Create(order).Error; err != nil {
+			return nil, errorspb.ErrorServerDbError("failed to create order: %v", err)
+		}
+		return order, nil
+	})
+	require.NoError(t, err)
+	erkrequire.NoError(t, erk)
+	require.NotZero(t, order.ID)
+	require.Equal(t, "result", order.Name)
+}
+
+// TestTransactionResultBusinessError tests the zero value is returned on business errors
+// TestTransactionResultBusinessError 测试业务错误时返回零值
+func TestTransactionResultBusinessError(t *testing.T) {
+	db := setupTestDB(t)
+
+	id, erk, err := gormkratos.TransactionResult(context.Background(), db, func(db *gorm.DB) (int, *errors.Error) {
+		return 100, errorspb.ErrorBadRequest("validation failed")
+	})
+	require.Error(t, err)
+	require.True(t, errorspb.IsBadRequest(erk))
+	require.Zero(t, id)
+}
+
+// TestTransactionResultDatabaseError tests the zero value is returned when the transaction fails
+// TestTransactionResultDatabaseError 测试事务失败时返回零值
+func TestTransactionResultDatabaseError(t *testing.T) {
+	db := setupTestDB(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	name, erk, err := gormkratos.TransactionResult(ctx, db, func(db *gorm.DB) (string, *errors.Error) {
+		time.Sleep(100 * time.Millisecond) // Exceed timeout // 超过超时时间
+		return "lost", nil
+	})
+	require.Error(t, err)
+	erkrequire.NoError(t, erk)
+	require.Empty(t, name)
+}
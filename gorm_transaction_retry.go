@@ -0,0 +1,157 @@
+package gormkratos
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/orzkratos/gormkratos/api/dberrors/v1"
+	"github.com/yyle88/erero"
+	"gorm.io/gorm"
+)
+
+// RetryConfig configures transaction retry on transient database failures
+// Only database errors (erk == nil, err != nil) are retried, business errors are never retried unless RetryErk opts in
+//
+// RetryConfig 配置数据库瞬时故障时的事务重试
+// 只重试数据库错误 (erk == nil, err != nil), 除非通过 RetryErk 开启, 业务错误永远不会重试
+type RetryConfig struct {
+	MaxAttempts int                          // Max attempts including the first one // 最大尝试次数, 包含首次
+	BaseDelay   time.Duration                // Delay before the first retry // 首次重试前的等待时间
+	MaxDelay    time.Duration                // Upper bound of the delay // 等待时间上限
+	Multiplier  float64                      // Exponential growth factor of the delay // 等待时间的指数增长因子
+	Jitter      float64                      // Random jitter fraction in [0, 1] // 随机抖动比例, 取值 [0, 1]
+	IsRetryable func(err error) bool         // Classifies retryable database errors, nil uses IsRetryableError // 判断数据库错误是否可重试, nil 时使用 IsRetryableError
+	RetryErk    func(erk *errors.Error) bool // Classifies retryable erks returned by run, nil retries none // 判断 run 返回的 erk 是否可重试, nil 表示都不重试
+}
+
+// NewRetryConfig creates retry config with defaults
+// Default: 3 attempts, 10ms base delay, 1s max delay, x2 growth, 20% jitter, IsRetryableError classifier
+//
+// NewRetryConfig 创建带默认值的重试配置
+// 默认: 3 次尝试, 10ms 基础等待, 1s 最大等待, 2 倍增长, 20% 抖动, IsRetryableError 分类函数
+func NewRetryConfig() *RetryConfig {
+	return &RetryConfig{
+		MaxAttempts: 3,
+		BaseDelay:   10 * time.Millisecond,
+		MaxDelay:    time.Second,
+		Multiplier:  2,
+		Jitter:      0.2,
+		IsRetryable: IsRetryableError,
+	}
+}
+
+// WithMaxAttempts sets the max attempts including the first one
+// WithMaxAttempts 设置最大尝试次数, 包含首次
+func (c *RetryConfig) WithMaxAttempts(maxAttempts int) *RetryConfig {
+	c.MaxAttempts = maxAttempts
+	return c
+}
+
+// WithBackoff sets the base delay, max delay and growth factor
+// WithBackoff 设置基础等待, 最大等待和增长因子
+func (c *RetryConfig) WithBackoff(baseDelay time.Duration, maxDelay time.Duration, multiplier float64) *RetryConfig {
+	c.BaseDelay = baseDelay
+	c.MaxDelay = maxDelay
+	c.Multiplier = multiplier
+	return c
+}
+
+// WithJitter sets the random jitter fraction
+// WithJitter 设置随机抖动比例
+func (c *RetryConfig) WithJitter(jitter float64) *RetryConfig {
+	c.Jitter = jitter
+	return c
+}
+
+// WithIsRetryable sets the retryable error classifier
+// WithIsRetryable 设置可重试错误的分类函数
+func (c *RetryConfig) WithIsRetryable(isRetryable func(err error) bool) *RetryConfig {
+	c.IsRetryable = isRetryable
+	return c
+}
+
+// WithRetryErk opts in to retrying erks returned by run, such as WithRetryErk(gormkratos.IsRetryableErk)
+// WithRetryErk 开启重试 run 返回的 erk, 例如 WithRetryErk(gormkratos.IsRetryableErk)
+func (c *RetryConfig) WithRetryErk(retryErk func(erk *errors.Error) bool) *RetryConfig {
+	c.RetryErk = retryErk
+	return c
+}
+
+// delay computes the wait time before the next attempt
+// delay 计算下次尝试前的等待时间
+func (c *RetryConfig) delay(attempt int) time.Duration {
+	delay := float64(c.BaseDelay) * math.Pow(c.Multiplier, float64(attempt-1))
+	if c.MaxDelay > 0 {
+		delay = min(delay, float64(c.MaxDelay))
+	}
+	if c.Jitter > 0 {
+		delay = delay * (1 - c.Jitter + 2*c.Jitter*rand.Float64())
+	}
+	return time.Duration(delay)
+}
+
+// TransactionRetry executes a function in database transaction and retries on transient database failures
+// Returns the same two errors as Transaction, taken from the last attempt
+// Business errors (erk != nil) and unknown commit outcomes stop the retry at once, see CommitError
+// Erks matching RetryConfig.RetryErk are retried, such as SERVER_DB_LOCK_TIMEOUT with IsRetryableErk
+// A nil retry runs a single attempt
+//
+// TransactionRetry 在数据库事务中执行函数, 遇到数据库瞬时故障时重试
+// 返回与 Transaction 相同的两个错误, 取自最后一次尝试
+// 业务错误 (erk != nil) 和未知的提交结果会立即停止重试, 参见 CommitError
+// 匹配 RetryConfig.RetryErk 的 erk 会被重试, 例如使用 IsRetryableErk 时的 SERVER_DB_LOCK_TIMEOUT
+// retry 为 nil 时只尝试一次
+func TransactionRetry(
+	ctx context.Context,
+	db *gorm.DB,
+	retry *RetryConfig,
+	run func(db *gorm.DB) *errors.Error,
+	options ...*sql.TxOptions,
+) (erk *errors.Error, err error) {
+	if retry == nil {
+		retry = &RetryConfig{MaxAttempts: 1}
+	}
+	isRetryable := retry.IsRetryable
+	if isRetryable == nil {
+		isRetryable = IsRetryableError
+	}
+	for attempt := 1; ; attempt++ {
+		if erk, err = Transaction(contextWithAttempt(ctx, attempt), db, run, options...); err == nil || (erk != nil && (retry.RetryErk == nil || !retry.RetryErk(erk))) {
+			return erk, err
+		}
+		if attempt >= retry.MaxAttempts || IsCommitOutcomeUnknown(err) || (erk == nil && !isRetryable(err)) {
+			return erk, err
+		}
+		// Wait before next attempt, give up when context is done
+		// 下次尝试前等待, 上下文结束时放弃
+		timer := time.NewTimer(retry.delay(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return erk, erero.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// IsRetryableError checks if database errors are transient: serialization failures, deadlocks and lock timeouts
+// Recognizes SQLSTATE 40001, 40P01 and 55P03 (Postgres), MySQL 1213, 1205 and 3572, SQLite busy errors, see ClassifyDbError
+//
+// IsRetryableError 检查数据库错误是否为瞬时错误: 序列化失败, 死锁和锁超时
+// 识别 SQLSTATE 40001, 40P01 和 55P03 (Postgres), MySQL 1213, 1205 和 3572, SQLite 忙错误, 参见 ClassifyDbError
+func IsRetryableError(err error) bool {
+	return ClassifyDbError(err).Retryable()
+}
+
+// IsRetryableErk checks if erks are translated from transient database failures, pass it to RetryConfig.WithRetryErk
+// Matches SERVER_DB_LOCK_TIMEOUT, SERVER_DB_DEADLOCK and SERVER_DB_SERIALIZATION_FAILURE, see TranslateDbError
+//
+// IsRetryableErk 检查 erk 是否由数据库瞬时故障转换而来, 可传给 RetryConfig.WithRetryErk
+// 匹配 SERVER_DB_LOCK_TIMEOUT, SERVER_DB_DEADLOCK 和 SERVER_DB_SERIALIZATION_FAILURE, 参见 TranslateDbError
+func IsRetryableErk(erk *errors.Error) bool {
+	return dberrors.IsServerDbLockTimeout(erk) || dberrors.IsServerDbDeadlock(erk) || dberrors.IsServerDbSerializationFailure(erk)
+}
@@ -0,0 +1,205 @@
+package gormkratos_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/google/uuid"
+	"github.com/orzkratos/errkratos/must/erkrequire"
+	"github.com/orzkratos/gormkratos"
+	"github.com/orzkratos/gormkratos/api/dberrors/v1"
+	"github.com/orzkratos/gormkratos/internal/errorspb"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/must"
+	"github.com/yyle88/rese"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// serializationError simulates driver errors carrying SQLSTATE 40001
+// serializationError 模拟携带 SQLSTATE 40001 的驱动错误
+type serializationError struct{}
+
+func (serializationError) Error() string    { return "could not serialize access" }
+func (serializationError) SQLState() string { return "40001" }
+
+// flakyBeginPool fails the first N BeginTx calls with serialization errors
+// flakyBeginPool 前 N 次 BeginTx 调用返回序列化错误
+type flakyBeginPool struct {
+	*sql.DB
+	failures atomic.Int32
+}
+
+func (p *flakyBeginPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	if p.failures.Add(-1) >= 0 {
+		return nil, serializationError{}
+	}
+	return p.DB.BeginTx(ctx, opts)
+}
+
+// setupFlakyDB creates SQLite database whose first N BeginTx calls fail
+// setupFlakyDB 创建前 N 次 BeginTx 调用失败的 SQLite 数据库
+func setupFlakyDB(t *testing.T, failures int32) *gorm.DB {
+	dsn := fmt.Sprintf("file:db-%s?mode=memory&cache=shared", uuid.New().String())
+	pool := &flakyBeginPool{DB: rese.P1(sql.Open(sqlite.DriverName, dsn))}
+	pool.failures.Store(failures)
+	t.Cleanup(func() {
+		must.Done(pool.DB.Close())
+	})
+	return rese.P1(gorm.Open(sqlite.Dialector{Conn: pool}, &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Info),
+	}))
+}
+
+// newFastRetryConfig creates retry config with short delays to keep tests fast
+// newFastRetryConfig 创建等待时间很短的重试配置, 保持测试快速
+func newFastRetryConfig() *gormkratos.RetryConfig {
+	return gormkratos.NewRetryConfig().WithBackoff(time.Millisecond, 5*time.Millisecond, 2)
+}
+
+// TestTransactionRetrySuccess tests retry succeeds after transient failures
+// TestTransactionRetrySuccess 测试瞬时故障后重试成功
+func TestTransactionRetrySuccess(t *testing.T) {
+	db := setupFlakyDB(t, 2)
+
+	var runs int
+	erk, err := gormkratos.TransactionRetry(context.Background(), db, newFastRetryConfig(), func(db *gorm.DB) *errors.Error {
+		runs++
+		return nil
+	})
+	require.NoError(t, err)
+	erkrequire.NoError(t, erk)
+	require.Equal(t, 1, runs)
+}
+
+// TestTransactionRetryExhausted tests retry gives up after max attempts
+// TestTransactionRetryExhausted 测试达到最大尝试次数后放弃重试
+func TestTransactionRetryExhausted(t *testing.T) {
+	db := setupFlakyDB(t, 10)
+
+	var attempts int
+	retry := newFastRetryConfig().WithMaxAttempts(4).WithIsRetryable(func(err error) bool {
+		attempts++
+		return gormkratos.IsRetryableError(err)
+	})
+
+	erk, err := gormkratos.TransactionRetry(context.Background(), db, retry, func(db *gorm.DB) *errors.Error {
+		return nil
+	})
+	require.Error(t, err)
+	erkrequire.NoError(t, erk)
+	require.Equal(t, 3, attempts) // The last attempt is not classified // 最后一次尝试不再分类
+}
+
+// TestTransactionRetryZeroConfig tests nil configs run once and nil classifiers fall back to IsRetryableError
+// TestTransactionRetryZeroConfig 测试 nil 配置只执行一次, nil 分类函数回退到 IsRetryableError
+func TestTransactionRetryZeroConfig(t *testing.T) {
+	erk, err := gormkratos.TransactionRetry(context.Background(), setupFlakyDB(t, 1), nil, func(db *gorm.DB) *errors.Error {
+		return nil
+	})
+	require.Error(t, err)
+	erkrequire.NoError(t, erk)
+	require.True(t, gormkratos.IsRetryableError(err))
+
+	var runs int
+	erk, err = gormkratos.TransactionRetry(context.Background(), setupFlakyDB(t, 1), &gormkratos.RetryConfig{MaxAttempts: 2}, func(db *gorm.DB) *errors.Error {
+		runs++
+		return nil
+	})
+	require.NoError(t, err)
+	erkrequire.NoError(t, erk)
+	require.Equal(t, 1, runs)
+}
+
+// TestTransactionRetryBusinessError tests business errors are never retried
+// TestTransactionRetryBusinessError 测试业务错误永远不会重试
+func TestTransactionRetryBusinessError(t *testing.T) {
+	db := setupFlakyDB(t, 0)
+
+	var runs int
+	retry := newFastRetryConfig().WithIsRetryable(func(err error) bool {
+		return true
+	})
+
+	erk, err := gormkratos.TransactionRetry(context.Background(), db, retry, func(db *gorm.DB) *errors.Error {
+		runs++
+		return errorspb.ErrorBadRequest("invalid input")
+	})
+	require.Error(t, err)
+	erkrequire.Error(t, erk)
+	require.True(t, errorspb.IsBadRequest(erk))
+	require.Equal(t, 1, runs)
+}
+
+// TestTransactionRetryLockTimeoutErk tests erks of transient database failures are retried only when opted in
+// TestTransactionRetryLockTimeoutErk 测试数据库瞬时故障的 erk 只有在开启后才会重试
+func TestTransactionRetryLockTimeoutErk(t *testing.T) {
+	db := setupFlakyDB(t, 0)
+
+	var runs int
+	erk, err := gormkratos.TransactionRetry(context.Background(), db, newFastRetryConfig(), func(db *gorm.DB) *errors.Error {
+		runs++
+		return dberrors.ErrorServerDbLockTimeout("lock not available")
+	})
+	require.Error(t, err)
+	require.True(t, dberrors.IsServerDbLockTimeout(erk))
+	require.Equal(t, 1, runs) // Erks are not retried by default // 默认不重试 erk
+
+	runs = 0
+	retry := newFastRetryConfig().WithRetryErk(gormkratos.IsRetryableErk)
+	erk, err = gormkratos.TransactionRetry(context.Background(), db, retry, func(db *gorm.DB) *errors.Error {
+		runs++
+		if runs < 3 {
+			return dberrors.ErrorServerDbLockTimeout("lock not available")
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	erkrequire.NoError(t, erk)
+	require.Equal(t, 3, runs)
+
+	runs = 0
+	erk, err = gormkratos.TransactionRetry(context.Background(), db, retry.WithMaxAttempts(2), func(db *gorm.DB) *errors.Error {
+		runs++
+		return dberrors.ErrorServerDbLockTimeout("lock not available")
+	})
+	require.Error(t, err)
+	require.True(t, dberrors.IsServerDbLockTimeout(erk))
+	require.Equal(t, 2, runs)
+}
+
+// TestTransactionRetryNotRetryable tests non-retryable database errors return at once
+// TestTransactionRetryNotRetryable 测试不可重试的数据库错误立即返回
+func TestTransactionRetryNotRetryable(t *testing.T) {
+	db := setupFlakyDB(t, 1)
+
+	retry := newFastRetryConfig().WithIsRetryable(func(err error) bool {
+		return false
+	})
+
+	erk, err := gormkratos.TransactionRetry(context.Background(), db, retry, func(db *gorm.DB) *errors.Error {
+		return nil
+	})
+	require.Error(t, err)
+	erkrequire.NoError(t, erk)
+}
+
+// TestIsRetryableError tests the default retryable error classifier
+// TestIsRetryableError 测试默认的可重试错误分类函数
+func TestIsRetryableError(t *testing.T) {
+	require.False(t, gormkratos.IsRetryableError(nil))
+	require.True(t, gormkratos.IsRetryableError(serializationError{}))
+	require.True(t, gormkratos.IsRetryableError(erero.Wro(serializationError{})))
+	require.True(t, gormkratos.IsRetryableError(erero.New("Error 1213 (40001): Deadlock found when trying to get lock")))
+	require.True(t, gormkratos.IsRetryableError(erero.New("database is locked")))
+	require.True(t, gormkratos.IsRetryableError(erero.New("Error 1205 (HY000): Lock wait timeout exceeded; try restarting transaction")))
+	require.False(t, gormkratos.IsRetryableError(erero.New("UNIQUE constraint failed")))
+	require.False(t, gormkratos.IsRetryableError(context.Canceled))
+}
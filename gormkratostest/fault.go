@@ -0,0 +1,277 @@
+package gormkratostest
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// FaultOp is the database operation a fault applies to
+//
+// FaultOp 是故障作用的数据库操作
+type FaultOp string
+
+const (
+	FaultBegin     FaultOp = "begin"     // BEGIN of transactions // 开启事务
+	FaultStatement FaultOp = "statement" // Statements run with ExecContext and QueryContext // 通过 ExecContext 和 QueryContext 执行的语句
+	FaultCommit    FaultOp = "commit"    // COMMIT of transactions // 提交事务
+	FaultRollback  FaultOp = "rollback"  // ROLLBACK of transactions // 回滚事务
+)
+
+// Fault describes one injected failure or latency
+//
+// Fault 描述一个注入的失败或延迟
+type Fault struct {
+	Op      FaultOp       // Operation the fault applies to // 故障作用的操作
+	Match   string        // Substring of the SQL, only for FaultStatement, empty matches all // SQL 子串, 仅用于 FaultStatement, 为空时匹配所有语句
+	Err     error         // Error returned, nil means only latency // 返回的错误, nil 表示只有延迟
+	Latency time.Duration // Latency added before the operation // 操作前增加的延迟
+	Times   int           // Times to apply, 0 means every time // 生效次数, 0 表示每次都生效
+	Applied bool          // Only for FaultCommit, commits before returning Err, as the connection broke after COMMIT applied // 仅用于 FaultCommit, 先提交再返回 Err, 模拟 COMMIT 生效后连接断开
+}
+
+// FaultInjector injects faults into the database operations of NewFaultDB databases
+// Failed commits roll back the real transaction, so the data is not committed, unless the fault is Applied
+// Failed rollbacks still roll back the real transaction, only the error is returned
+//
+// FaultInjector 向 NewFaultDB 数据库的操作注入故障
+// 提交失败时回滚真实事务, 数据不会提交, 除非故障设置了 Applied
+// 回滚失败时仍会回滚真实事务, 只返回错误
+type FaultInjector struct {
+	mutex  sync.Mutex
+	faults []*Fault
+}
+
+// NewFaultInjector creates fault injector without faults
+//
+// NewFaultInjector 创建没有故障的故障注入器
+func NewFaultInjector() *FaultInjector {
+	return &FaultInjector{}
+}
+
+// Inject adds the fault, faults apply in the order injected
+// Inject 添加故障, 故障按注入顺序生效
+func (f *FaultInjector) Inject(fault *Fault) *FaultInjector {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.faults = append(f.faults, fault)
+	return f
+}
+
+// FailBegin fails the next BEGIN with err
+// FailBegin 使下一次开启事务返回 err
+func (f *FaultInjector) FailBegin(err error) *FaultInjector {
+	return f.Inject(&Fault{Op: FaultBegin, Err: err, Times: 1})
+}
+
+// FailStatement fails the next statement containing match with err
+// FailStatement 使下一条包含 match 的语句返回 err
+func (f *FaultInjector) FailStatement(match string, err error) *FaultInjector {
+	return f.Inject(&Fault{Op: FaultStatement, Match: match, Err: err, Times: 1})
+}
+
+// FailCommit fails the next COMMIT with err
+// FailCommit 使下一次提交返回 err
+func (f *FaultInjector) FailCommit(err error) *FaultInjector {
+	return f.Inject(&Fault{Op: FaultCommit, Err: err, Times: 1})
+}
+
+// FailCommitApplied commits the next COMMIT and then returns err, as the connection broke after COMMIT applied
+// FailCommitApplied 使下一次提交生效后再返回 err, 模拟 COMMIT 生效后连接断开
+func (f *FaultInjector) FailCommitApplied(err error) *FaultInjector {
+	return f.Inject(&Fault{Op: FaultCommit, Err: err, Times: 1, Applied: true})
+}
+
+// FailRollback fails the next ROLLBACK with err
+// FailRollback 使下一次回滚返回 err
+func (f *FaultInjector) FailRollback(err error) *FaultInjector {
+	return f.Inject(&Fault{Op: FaultRollback, Err: err, Times: 1})
+}
+
+// Delay adds latency before every operation of op, waiting stops early when ctx is done
+// Delay 在每次 op 操作前增加延迟, ctx 结束时提前停止等待
+func (f *FaultInjector) Delay(op FaultOp, latency time.Duration) *FaultInjector {
+	return f.Inject(&Fault{Op: op, Latency: latency})
+}
+
+// Reset removes all faults
+// Reset 移除所有故障
+func (f *FaultInjector) Reset() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.faults = nil
+}
+
+// take returns the total latency of the matching faults and the first matching failure
+// Each matching fault consumes one of its times
+//
+// take 返回匹配故障的总延迟和第一个匹配的失败
+// 每个匹配的故障消耗一次生效次数
+func (f *FaultInjector) take(op FaultOp, query string) (latency time.Duration, failure *Fault) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	faults := f.faults[:0]
+	for _, fault := range f.faults {
+		if fault.Op == op && (op != FaultStatement || strings.Contains(query, fault.Match)) && (fault.Err == nil || failure == nil) {
+			latency += fault.Latency
+			if fault.Err != nil {
+				failure = fault
+			}
+			if fault.Times > 0 {
+				if fault.Times--; fault.Times == 0 {
+					continue // Used up // 已用完
+				}
+			}
+		}
+		faults = append(faults, fault)
+	}
+	f.faults = faults
+	return latency, failure
+}
+
+// apply waits the latency and returns the matching failure, nil when none
+// When ctx is done while waiting, returns failure carrying ctx.Err()
+//
+// apply 等待延迟并返回匹配的失败, 没有时返回 nil
+// 等待时 ctx 结束则返回携带 ctx.Err() 的失败
+func (f *FaultInjector) apply(ctx context.Context, op FaultOp, query string) *Fault {
+	latency, failure := f.take(op, query)
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return &Fault{Op: op, Err: ctx.Err()}
+		case <-timer.C:
+		}
+	}
+	return failure
+}
+
+// NewFaultDB creates isolated in-memory SQLite database with faults injected into its connection pool
+// Models are migrated before any fault applies
+//
+// NewFaultDB 创建在连接池上注入故障的独立内存 SQLite 数据库
+// 模型在故障生效前完成迁移
+func NewFaultDB(t *testing.T, models ...any) (*gorm.DB, *FaultInjector) {
+	sqlDB, err := NewDB(t).DB()
+	require.NoError(t, err)
+
+	injector := NewFaultInjector()
+	db, err := gorm.Open(sqlite.Dialector{Conn: &faultPool{db: sqlDB, injector: injector}}, newConfig())
+	require.NoError(t, err)
+	if len(models) > 0 {
+		require.NoError(t, db.AutoMigrate(models...))
+	}
+	return db, injector
+}
+
+// faultPool wraps the connection pool, beginning transactions wrapped with faults
+// faultPool 包装连接池, 开启带故障的事务
+type faultPool struct {
+	db       *sql.DB
+	injector *FaultInjector
+}
+
+var _ gorm.ConnPoolBeginner = &faultPool{}
+var _ gorm.GetDBConnector = &faultPool{}
+
+func (p *faultPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return p.db.PrepareContext(ctx, query)
+}
+
+func (p *faultPool) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if fault := p.injector.apply(ctx, FaultStatement, query); fault != nil {
+		return nil, fault.Err
+	}
+	return p.db.ExecContext(ctx, query, args...)
+}
+
+func (p *faultPool) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if fault := p.injector.apply(ctx, FaultStatement, query); fault != nil {
+		return nil, fault.Err
+	}
+	return p.db.QueryContext(ctx, query, args...)
+}
+
+func (p *faultPool) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return p.db.QueryRowContext(ctx, query, args...)
+}
+
+func (p *faultPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	if fault := p.injector.apply(ctx, FaultBegin, ""); fault != nil {
+		return nil, fault.Err
+	}
+	tx, err := p.db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &faultTx{ctx: ctx, tx: tx, injector: p.injector}, nil
+}
+
+func (p *faultPool) GetDBConn() (*sql.DB, error) {
+	return p.db, nil
+}
+
+// faultTx wraps the transaction, injecting faults into statements, commit and rollback
+// faultTx 包装事务, 向语句, 提交和回滚注入故障
+type faultTx struct {
+	ctx      context.Context
+	tx       *sql.Tx
+	injector *FaultInjector
+}
+
+var _ gorm.TxCommitter = &faultTx{}
+
+func (x *faultTx) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return x.tx.PrepareContext(ctx, query)
+}
+
+func (x *faultTx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if fault := x.injector.apply(ctx, FaultStatement, query); fault != nil {
+		return nil, fault.Err
+	}
+	return x.tx.ExecContext(ctx, query, args...)
+}
+
+func (x *faultTx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if fault := x.injector.apply(ctx, FaultStatement, query); fault != nil {
+		return nil, fault.Err
+	}
+	return x.tx.QueryContext(ctx, query, args...)
+}
+
+func (x *faultTx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return x.tx.QueryRowContext(ctx, query, args...)
+}
+
+func (x *faultTx) Commit() error {
+	fault := x.injector.apply(x.ctx, FaultCommit, "")
+	switch {
+	case fault == nil:
+		return x.tx.Commit()
+	case fault.Applied:
+		if err := x.tx.Commit(); err != nil {
+			return err
+		}
+		return fault.Err
+	default:
+		_ = x.tx.Rollback() // Release the real transaction, nothing committed // 释放真实事务, 不提交任何数据
+		return fault.Err
+	}
+}
+
+func (x *faultTx) Rollback() error {
+	fault := x.injector.apply(x.ctx, FaultRollback, "")
+	if err := x.tx.Rollback(); fault == nil {
+		return err
+	}
+	return fault.Err
+}
@@ -0,0 +1,118 @@
+package gormkratostest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/orzkratos/gormkratos"
+	"github.com/orzkratos/gormkratos/api/dberrors/v1"
+	"github.com/orzkratos/gormkratos/gormkratostest"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/erero"
+	"gorm.io/gorm"
+)
+
+// createOrder creates order in the transaction
+// createOrder 在事务中创建订单
+func createOrder(name string) func(db *gorm.DB) *errors.Error {
+	return func(db *gorm.DB) *errors.Error {
+		if err := db.Create(&Order{Name: name}).Error; err != nil {
+			return dberrors.ErrorServerDbError("create failed: %v", err)
+		}
+		return nil
+	}
+}
+
+// TestFaultBegin tests BEGIN failures return database errors without business errors
+// TestFaultBegin 测试开启事务失败返回数据库错误而没有业务错误
+func TestFaultBegin(t *testing.T) {
+	db, faults := gormkratostest.NewFaultDB(t, &Order{})
+	cause := erero.New("begin failed")
+	faults.FailBegin(cause)
+
+	erk, err := gormkratos.Transaction(context.Background(), db, createOrder("a"))
+	gormkratostest.RequireRolledBack(t, erk, err)
+	require.Nil(t, erk)
+	require.ErrorIs(t, err, cause)
+	require.Equal(t, int64(0), countOrders(t, db))
+
+	// Used up, the next transaction commits
+	// 已用完, 下一个事务正常提交
+	erk, err = gormkratos.Transaction(context.Background(), db, createOrder("a"))
+	gormkratostest.RequireCommitted(t, erk, err)
+	require.Equal(t, int64(1), countOrders(t, db))
+}
+
+// TestFaultStatement tests statement failures surface as business errors returned by run
+// TestFaultStatement 测试语句失败以 run 返回的业务错误体现
+func TestFaultStatement(t *testing.T) {
+	db, faults := gormkratostest.NewFaultDB(t, &Order{})
+	faults.FailStatement("INSERT INTO `orders`", erero.New("disk full"))
+
+	erk, err := gormkratos.Transaction(context.Background(), db, createOrder("a"))
+	gormkratostest.RequireRolledBack(t, erk, err)
+	gormkratostest.RequireErkReason(t, erk, dberrors.ErrorReason_SERVER_DB_ERROR.String())
+	require.Equal(t, int64(0), countOrders(t, db))
+}
+
+// TestFaultCommit tests COMMIT failures return database errors and nothing is committed
+// TestFaultCommit 测试提交失败返回数据库错误且没有数据提交
+func TestFaultCommit(t *testing.T) {
+	db, faults := gormkratostest.NewFaultDB(t, &Order{})
+	cause := erero.New("commit failed")
+	faults.FailCommit(cause)
+
+	var rolledBack bool
+	erk, err := gormkratos.Transaction(context.Background(), db, func(db *gorm.DB) *errors.Error {
+		gormkratos.AfterRollback(db.Statement.Context, func(ctx context.Context, erk *errors.Error, err error) {
+			rolledBack = true
+		})
+		return createOrder("a")(db)
+	})
+	gormkratostest.RequireRolledBack(t, erk, err)
+	require.Nil(t, erk)
+	require.ErrorIs(t, err, cause)
+	require.True(t, rolledBack)
+	require.Equal(t, int64(0), countOrders(t, db))
+
+	erk = gormkratos.TransactionErk(context.Background(), db, createOrder("b"))
+	require.Nil(t, erk)
+	faults.FailCommit(cause)
+	erk = gormkratos.TransactionErk(context.Background(), db, createOrder("c"))
+	gormkratostest.RequireErkReason(t, erk, dberrors.ErrorReason_SERVER_DB_COMMIT_FAILED.String())
+}
+
+// TestFaultRollback tests ROLLBACK failures keep the business error and still roll back
+// TestFaultRollback 测试回滚失败时保留业务错误并仍然回滚
+func TestFaultRollback(t *testing.T) {
+	db, faults := gormkratostest.NewFaultDB(t, &Order{})
+	faults.FailRollback(erero.New("rollback failed"))
+
+	erk, err := gormkratos.Transaction(context.Background(), db, func(db *gorm.DB) *errors.Error {
+		if erk := createOrder("a")(db); erk != nil {
+			return erk
+		}
+		return dberrors.ErrorDbConflict("order already paid")
+	})
+	gormkratostest.RequireRolledBack(t, erk, err)
+	gormkratostest.RequireErkReason(t, erk, dberrors.ErrorReason_DB_CONFLICT.String())
+	require.Equal(t, int64(0), countOrders(t, db))
+}
+
+// TestFaultLatency tests commit latency exceeding the ctx deadline cancels the transaction
+// TestFaultLatency 测试超过 ctx 期限的提交延迟使事务取消
+func TestFaultLatency(t *testing.T) {
+	db, faults := gormkratostest.NewFaultDB(t, &Order{})
+	faults.Delay(gormkratostest.FaultCommit, 100*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	erk, err := gormkratos.Transaction(ctx, db, createOrder("a"))
+	gormkratostest.RequireRolledBack(t, erk, err)
+	require.Equal(t, gormkratos.TxOutcomeCanceled, gormkratos.ClassifyTxOutcome(ctx, erk, err))
+
+	faults.Reset()
+	require.Equal(t, int64(0), countOrders(t, db))
+}
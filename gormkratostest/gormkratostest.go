@@ -0,0 +1,100 @@
+// Package gormkratostest: test support of gormkratos transactions
+// Provides isolated in-memory SQLite databases, rollback-only test transactions and two-error assertions
+//
+// gormkratostest: gormkratos 事务的测试支持
+// 提供独立的内存 SQLite 数据库, 只回滚的测试事务和双错误断言
+package gormkratostest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// NewDB creates isolated in-memory SQLite database and migrates the models
+// Holds one connection open, since the in-memory database is dropped once its last connection closes
+// The database is closed when the test ends
+//
+// NewDB 创建独立的内存 SQLite 数据库并迁移模型
+// 保持一个连接打开, 因为内存数据库在最后一个连接关闭时会被删除
+// 测试结束时关闭数据库
+func NewDB(t *testing.T, models ...any) *gorm.DB {
+	dsn := fmt.Sprintf("file:db-%s?mode=memory&cache=shared", uuid.New().String())
+	db, err := gorm.Open(sqlite.Open(dsn), newConfig())
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, sqlDB.Close())
+	})
+	conn, err := sqlDB.Conn(context.Background())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, conn.Close())
+	})
+	if len(models) > 0 {
+		require.NoError(t, db.AutoMigrate(models...))
+	}
+	return db
+}
+
+// newConfig returns GORM config logging all statements, as tests read them when failing
+// newConfig 返回记录所有语句的 GORM 配置, 便于测试失败时查看
+func newConfig() *gorm.Config {
+	return &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Info),
+	}
+}
+
+// WithRollbackTx begins a transaction rolled back when the test ends, so tests leave no data behind
+// Pass the returned tx where the code under test expects the database
+// gormkratos.Transaction and TxManager inside run as savepoints, business rollbacks still undo their writes
+// Hooks registered with gormkratos.AfterCommit run once the savepoint succeeds
+//
+// WithRollbackTx 开启在测试结束时回滚的事务, 使测试不留下数据
+// 将返回的 tx 传给被测代码中需要数据库的地方
+// 其中的 gormkratos.Transaction 和 TxManager 以保存点方式执行, 业务回滚仍会撤销其写入
+// 通过 gormkratos.AfterCommit 注册的钩子在保存点成功后执行
+func WithRollbackTx(t *testing.T, db *gorm.DB) *gorm.DB {
+	tx := db.Begin()
+	require.NoError(t, tx.Error)
+	t.Cleanup(func() {
+		require.NoError(t, tx.Rollback().Error)
+	})
+	return tx
+}
+
+// RequireCommitted asserts the two errors of a committed transaction
+//
+// RequireCommitted 断言已提交事务的两个错误
+func RequireCommitted(t *testing.T, erk *errors.Error, err error) {
+	require.NoError(t, err)
+	require.Nil(t, erk)
+}
+
+// RequireRolledBack asserts the two errors of a transaction that did not commit
+// Covers business rollbacks (erk != nil) and database failures (erk == nil)
+//
+// RequireRolledBack 断言未提交事务的两个错误
+// 包括业务回滚 (erk != nil) 和数据库失败 (erk == nil)
+func RequireRolledBack(t *testing.T, erk *errors.Error, err error) {
+	require.Error(t, err)
+	if erk != nil {
+		require.ErrorIs(t, err, erk)
+	}
+}
+
+// RequireErkReason asserts erk is Kratos error with the reason, such as dberrors.ErrorReason_DB_CONFLICT.String()
+//
+// RequireErkReason 断言 erk 是带有该原因的 Kratos 错误, 例如 dberrors.ErrorReason_DB_CONFLICT.String()
+func RequireErkReason(t *testing.T, erk *errors.Error, reason string) {
+	require.NotNil(t, erk)
+	require.Equal(t, reason, erk.Reason)
+}
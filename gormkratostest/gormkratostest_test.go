@@ -0,0 +1,86 @@
+package gormkratostest_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/orzkratos/gormkratos"
+	"github.com/orzkratos/gormkratos/api/dberrors/v1"
+	"github.com/orzkratos/gormkratos/gormkratostest"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// Order is the test model
+// Order 是测试模型
+type Order struct {
+	ID   uint   `gorm:"primarykey"`
+	Name string `gorm:"uniqueIndex"`
+}
+
+// countOrders returns the count of orders visible to db
+// countOrders 返回 db 可见的订单数量
+func countOrders(t *testing.T, db *gorm.DB) int64 {
+	var count int64
+	require.NoError(t, db.Model(&Order{}).Count(&count).Error)
+	return count
+}
+
+// TestWithRollbackTx tests writes inside the test transaction are dropped when the test ends
+// TestWithRollbackTx 测试测试事务中的写入在测试结束时被丢弃
+func TestWithRollbackTx(t *testing.T) {
+	db := gormkratostest.NewDB(t, &Order{})
+
+	t.Run("commit", func(t *testing.T) {
+		tx := gormkratostest.WithRollbackTx(t, db)
+
+		erk, err := gormkratos.Transaction(context.Background(), tx, func(db *gorm.DB) *errors.Error {
+			if err := db.Create(&Order{Name: "a"}).Error; err != nil {
+				return dberrors.ErrorServerDbError("create failed: %v", err)
+			}
+			return nil
+		})
+		gormkratostest.RequireCommitted(t, erk, err)
+		require.Equal(t, int64(1), countOrders(t, tx))
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		tx := gormkratostest.WithRollbackTx(t, db)
+
+		erk, err := gormkratos.Transaction(context.Background(), tx, func(db *gorm.DB) *errors.Error {
+			if err := db.Create(&Order{Name: "a"}).Error; err != nil {
+				return dberrors.ErrorServerDbError("create failed: %v", err)
+			}
+			return dberrors.ErrorDbConflict("order already paid")
+		})
+		gormkratostest.RequireRolledBack(t, erk, err)
+		gormkratostest.RequireErkReason(t, erk, dberrors.ErrorReason_DB_CONFLICT.String())
+		require.Equal(t, int64(0), countOrders(t, tx)) // Savepoint rolled back // 保存点已回滚
+	})
+
+	// The subtests left no data behind
+	// 子测试没有留下数据
+	require.Equal(t, int64(0), countOrders(t, db))
+}
+
+// TestWithRollbackTxManager tests TxManager on the test transaction
+// TestWithRollbackTxManager 测试基于测试事务的 TxManager
+func TestWithRollbackTxManager(t *testing.T) {
+	db := gormkratostest.NewDB(t, &Order{})
+
+	t.Run("manager", func(t *testing.T) {
+		txm := gormkratos.NewTxManager(gormkratostest.WithRollbackTx(t, db))
+
+		erk, err := txm.Transaction(context.Background(), func(ctx context.Context) *errors.Error {
+			if err := txm.DB(ctx).Create(&Order{Name: "a"}).Error; err != nil {
+				return dberrors.ErrorServerDbError("create failed: %v", err)
+			}
+			return nil
+		})
+		gormkratostest.RequireCommitted(t, erk, err)
+		require.Equal(t, int64(1), countOrders(t, txm.DB(context.Background())))
+	})
+
+	require.Equal(t, int64(0), countOrders(t, db))
+}
@@ -0,0 +1,55 @@
+package idempotency
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/yyle88/erero"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// marshal serializes the response, proto messages with protojson and other values with encoding/json
+// marshal 序列化响应, proto 消息使用 protojson, 其他值使用 encoding/json
+func marshal(value any) ([]byte, error) {
+	if message, ok := value.(proto.Message); ok {
+		data, err := protojson.Marshal(message)
+		if err != nil {
+			return nil, erero.Wro(err)
+		}
+		return data, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	return data, nil
+}
+
+// unmarshal deserializes the response written by marshal
+// unmarshal 反序列化 marshal 写入的响应
+func unmarshal[T any](data []byte) (T, error) {
+	var res T
+	if _, ok := any(res).(proto.Message); ok {
+		// T is a pointer to a proto message, allocate the message before decoding
+		// T 是 proto 消息指针, 解码前先分配消息
+		value := reflect.New(reflect.TypeOf(res).Elem()).Interface()
+		if err := protojson.Unmarshal(data, value.(proto.Message)); err != nil {
+			return res, erero.Wro(err)
+		}
+		return value.(T), nil
+	}
+	if err := unmarshalJSON(data, &res); err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+// unmarshalJSON deserializes JSON data into the value
+// unmarshalJSON 将 JSON 数据反序列化到该值
+func unmarshalJSON(data []byte, value any) error {
+	if err := json.Unmarshal(data, value); err != nil {
+		return erero.Wro(err)
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+// Package idempotency: Idempotency keys for gormkratos transactions
+// Stores the response of each key in the same transaction as business data,
+// so retried requests with the same key return the stored result without running again
+//
+// idempotency: gormkratos 事务的幂等键
+// 在业务数据的同一事务中保存每个键的响应,
+// 使相同键的重试请求直接返回保存的结果而不再执行
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/orzkratos/gormkratos"
+	"github.com/orzkratos/gormkratos/api/dberrors/v1"
+	"github.com/yyle88/erero"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Record is the stored outcome of one idempotency key
+// Record 是一个幂等键保存的结果
+type Record struct {
+	Scope       string    `gorm:"column:scope;primaryKey;size:255"`           // Scope of the key, see ScopeFromContext // 键的作用域, 参见 ScopeFromContext
+	Key         string    `gorm:"column:idempotency_key;primaryKey;size:255"` // Idempotency key // 幂等键
+	Response    []byte    `gorm:"column:response"`                            // Serialized response, set when committed // 序列化的响应, 提交时设置
+	ErkCode     int32     `gorm:"column:erk_code;not null"`                   // Code of the stored Kratos error, 0 when committed // 保存的 Kratos 错误码, 提交时为 0
+	ErkReason   string    `gorm:"column:erk_reason;size:255"`                 // Reason of the stored Kratos error // 保存的 Kratos 错误原因
+	ErkMessage  string    `gorm:"column:erk_message"`                         // Message of the stored Kratos error // 保存的 Kratos 错误消息
+	ErkMetadata []byte    `gorm:"column:erk_metadata"`                        // Metadata of the stored Kratos error in JSON // 保存的 Kratos 错误元数据 (JSON)
+	CreatedAt   time.Time `gorm:"column:created_at;index"`                    // Time stored // 保存时间
+}
+
+// TableName returns the idempotency table name
+// TableName 返回幂等表名
+func (*Record) TableName() string {
+	return "idempotency_records"
+}
+
+// Migrate creates or updates the idempotency table
+//
+// Migrate 创建或更新幂等表
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(&Record{})
+}
+
+// Config configures which outcomes are stored
+//
+// Config 配置保存哪些结果
+type Config struct {
+	StoreErk func(erk *errors.Error) bool // Whether to store the business error, stored errors are returned on retries // 是否保存业务错误, 保存的错误在重试时返回
+}
+
+// NewConfig creates idempotency config storing client errors (code 4xx)
+// Server errors are not stored, retries with the same key run again
+//
+// NewConfig 创建保存客户端错误 (4xx 错误码) 的幂等配置
+// 服务端错误不保存, 相同键的重试会重新执行
+func NewConfig() *Config {
+	return &Config{
+		StoreErk: func(erk *errors.Error) bool {
+			return erk.Code >= 400 && erk.Code < 500
+		},
+	}
+}
+
+// WithStoreErk sets whether to store the business error
+// WithStoreErk 设置是否保存业务错误
+func (c *Config) WithStoreErk(storeErk func(erk *errors.Error) bool) *Config {
+	c.StoreErk = storeErk
+	return c
+}
+
+// Transaction executes run in database transaction at most once per idempotency key
+// Keys are scoped with ScopeFromContext, the same key of another operation runs again
+// The serialized result is stored together with the business data when the transaction commits
+// Repeated calls with the same key return the stored result or stored Kratos error without running run
+// Empty keys disable idempotency, run executes every time
+// Returns the same two errors as gormkratos.Transaction
+//
+// Transaction 对每个幂等键最多执行一次数据库事务中的 run
+// 键通过 ScopeFromContext 限定作用域, 其他操作的相同键会重新执行
+// 事务提交时序列化的结果与业务数据一起保存
+// 相同键的重复调用直接返回保存的结果或 Kratos 错误, 不再执行 run
+// 空键表示不启用幂等, 每次都执行 run
+// 返回与 gormkratos.Transaction 相同的两个错误
+func Transaction[T any](
+	ctx context.Context,
+	db *gorm.DB,
+	config *Config,
+	key string,
+	run func(db *gorm.DB) (T, *errors.Error),
+	options ...*sql.TxOptions,
+) (T, *errors.Error, error) {
+	var zero T
+	if key == "" {
+		return gormkratos.TransactionResult(ctx, db, run, options...)
+	}
+	scope := ScopeFromContext(ctx)
+	if record, err := load(ctx, db, scope, key); err != nil {
+		return zero, nil, erero.Wro(err)
+	} else if record != nil {
+		return replay[T](record)
+	}
+
+	// The record is inserted last, a concurrent request committing the same key first makes the insert fail
+	// 最后插入记录, 并发请求先提交相同键时插入失败
+	var res T
+	var conflict bool
+	erk, err := gormkratos.Transaction(ctx, db, func(db *gorm.DB) (erk *errors.Error) {
+		if res, erk = run(db); erk != nil {
+			return erk
+		}
+		response, err := marshal(res)
+		if err != nil {
+			return dberrors.ErrorServerDbError("failed to serialize response of idempotency key %s: %v", key, err)
+		}
+		if err := db.Create(&Record{Scope: scope, Key: key, Response: response, CreatedAt: time.Now().UTC()}).Error; err != nil {
+			conflict = gormkratos.ClassifyDbError(err) == gormkratos.DbErrorUniqueViolation
+			return dberrors.ErrorServerDbError("failed to store idempotency key %s: %v", key, err)
+		}
+		return nil
+	}, options...)
+	switch {
+	case err == nil:
+		return res, nil, nil
+	case conflict:
+		return reload[T](ctx, db, scope, key, erk, err)
+	case erk != nil && config.StoreErk(erk):
+		return storeErk[T](ctx, db, scope, key, erk, err)
+	default:
+		return zero, erk, err
+	}
+}
+
+// TransactionContext executes run like Transaction with the idempotency key taken from ctx, see KeyFromContext
+//
+// TransactionContext 与 Transaction 相同, 幂等键取自 ctx, 参见 KeyFromContext
+func TransactionContext[T any](
+	ctx context.Context,
+	db *gorm.DB,
+	config *Config,
+	run func(db *gorm.DB) (T, *errors.Error),
+	options ...*sql.TxOptions,
+) (T, *errors.Error, error) {
+	return Transaction(ctx, db, config, KeyFromContext(ctx), run, options...)
+}
+
+// Purge deletes records stored before the time, returns the count deleted
+// Retries arriving after purging run again, keep records longer than clients retry
+//
+// Purge 删除在该时间之前保存的记录, 返回删除的数量
+// 清理后到达的重试会重新执行, 记录的保留时间应长于客户端的重试时间
+func Purge(ctx context.Context, db *gorm.DB, before time.Time) (int64, error) {
+	result := db.WithContext(ctx).Where("created_at < ?", before.UTC()).Delete(&Record{})
+	if result.Error != nil {
+		return 0, erero.Wro(result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// load returns the record of the key in the scope, nil when not stored
+// load 返回作用域中该键的记录, 未保存时为 nil
+func load(ctx context.Context, db *gorm.DB, scope string, key string) (*Record, error) {
+	var records []*Record
+	if err := db.WithContext(ctx).Where("scope = ? AND idempotency_key = ?", scope, key).Limit(1).Find(&records).Error; err != nil {
+		return nil, erero.Wro(err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	return records[0], nil
+}
+
+// reload returns the record stored by the concurrent request, or the two errors when it is gone
+// reload 返回并发请求保存的记录, 记录不存在时返回原来的两个错误
+func reload[T any](ctx context.Context, db *gorm.DB, scope string, key string, erk *errors.Error, err error) (T, *errors.Error, error) {
+	var zero T
+	record, loadErr := load(ctx, db, scope, key)
+	if loadErr != nil || record == nil {
+		return zero, erk, erero.Join(err, loadErr)
+	}
+	return replay[T](record)
+}
+
+// storeErk stores the business error of the rolled back transaction, the record stored first wins
+// storeErk 保存已回滚事务的业务错误, 先保存的记录生效
+func storeErk[T any](ctx context.Context, db *gorm.DB, scope string, key string, erk *errors.Error, err error) (T, *errors.Error, error) {
+	var zero T
+	metadata, marshalErr := marshal(erk.Metadata)
+	if marshalErr != nil {
+		return zero, erk, err
+	}
+	record := &Record{
+		Scope:       scope,
+		Key:         key,
+		ErkCode:     erk.Code,
+		ErkReason:   erk.Reason,
+		ErkMessage:  erk.Message,
+		ErkMetadata: metadata,
+		CreatedAt:   time.Now().UTC(),
+	}
+	result := db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+	if result.Error != nil || result.RowsAffected > 0 {
+		return zero, erk, err // Storing is best effort, the business error stands // 保存失败不影响业务错误
+	}
+	return reload[T](ctx, db, scope, key, erk, err)
+}
+
+// replay returns the stored result or stored Kratos error of the record
+// replay 返回记录保存的结果或 Kratos 错误
+func replay[T any](record *Record) (T, *errors.Error, error) {
+	var zero T
+	if record.ErkCode != 0 {
+		erk := errors.New(int(record.ErkCode), record.ErkReason, record.ErkMessage)
+		if len(record.ErkMetadata) > 0 {
+			var metadata map[string]string
+			if err := unmarshalJSON(record.ErkMetadata, &metadata); err != nil {
+				return zero, nil, erero.Wro(err)
+			}
+			erk = erk.WithMetadata(metadata)
+		}
+		return zero, erk, erero.Wro(erk)
+	}
+	res, err := unmarshal[T](record.Response)
+	if err != nil {
+		return zero, nil, erero.Wro(err)
+	}
+	return res, nil, nil
+}
@@ -0,0 +1,202 @@
+package idempotency_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/orzkratos/gormkratos/gormkratostest"
+	"github.com/orzkratos/gormkratos/idempotency"
+	"github.com/orzkratos/gormkratos/internal/errorspb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"gorm.io/gorm"
+)
+
+// Account is the business model written in idempotency tests
+// Account 是幂等测试中写入的业务模型
+type Account struct {
+	ID      uint   `gorm:"primaryKey"`
+	Name    string `gorm:"not null"`
+	Balance int
+}
+
+// Receipt is the response of creating accounts
+// Receipt 是创建账户的响应
+type Receipt struct {
+	AccountID uint
+	Name      string
+}
+
+// setupTestDB creates isolated in-memory SQLite database with the idempotency table
+// setupTestDB 创建带幂等表的独立内存 SQLite 数据库
+func setupTestDB(t *testing.T) *gorm.DB {
+	db := gormkratostest.NewDB(t, &Account{})
+	require.NoError(t, idempotency.Migrate(db))
+	return db
+}
+
+// countAccounts counts the committed accounts
+// countAccounts 统计已提交的账户数量
+func countAccounts(t *testing.T, db *gorm.DB) int64 {
+	var count int64
+	require.NoError(t, db.Model(&Account{}).Count(&count).Error)
+	return count
+}
+
+// TestTransactionReplay tests repeated keys return the stored response without running again
+// TestTransactionReplay 测试重复的键返回保存的响应而不再执行
+func TestTransactionReplay(t *testing.T) {
+	db := setupTestDB(t)
+
+	var runs int
+	createAccount := func(db *gorm.DB) (*Receipt, *errors.Error) {
+		runs++
+		account := &Account{Name: "alice", Balance: 100}
+		if err := db.Create(account).Error; err != nil {
+			return nil, errorspb.ErrorServerDbError("create failed: %v", err)
+		}
+		return &Receipt{AccountID: account.ID, Name: account.Name}, nil
+	}
+
+	first, erk, err := idempotency.Transaction(context.Background(), db, idempotency.NewConfig(), "key-1", createAccount)
+	gormkratostest.RequireCommitted(t, erk, err)
+
+	second, erk, err := idempotency.Transaction(context.Background(), db, idempotency.NewConfig(), "key-1", createAccount)
+	gormkratostest.RequireCommitted(t, erk, err)
+	require.Equal(t, first, second)
+	require.Equal(t, 1, runs)
+	require.Equal(t, int64(1), countAccounts(t, db))
+
+	// Different keys run again
+	// 不同的键会重新执行
+	_, erk, err = idempotency.Transaction(context.Background(), db, idempotency.NewConfig(), "key-2", createAccount)
+	gormkratostest.RequireCommitted(t, erk, err)
+	require.Equal(t, 2, runs)
+	require.Equal(t, int64(2), countAccounts(t, db))
+}
+
+// TestTransactionEmptyKey tests empty keys run every time
+// TestTransactionEmptyKey 测试空键每次都执行
+func TestTransactionEmptyKey(t *testing.T) {
+	db := setupTestDB(t)
+
+	for range 2 {
+		_, erk, err := idempotency.Transaction(context.Background(), db, idempotency.NewConfig(), "", func(db *gorm.DB) (int, *errors.Error) {
+			if err := db.Create(&Account{Name: "bob"}).Error; err != nil {
+				return 0, errorspb.ErrorServerDbError("create failed: %v", err)
+			}
+			return 1, nil
+		})
+		gormkratostest.RequireCommitted(t, erk, err)
+	}
+	require.Equal(t, int64(2), countAccounts(t, db))
+
+	var count int64
+	require.NoError(t, db.Model(&idempotency.Record{}).Count(&count).Error)
+	require.Equal(t, int64(0), count)
+}
+
+// TestTransactionStoredErk tests client errors are stored and returned on retries
+// TestTransactionStoredErk 测试客户端错误被保存并在重试时返回
+func TestTransactionStoredErk(t *testing.T) {
+	db := setupTestDB(t)
+
+	var runs int
+	rejectAccount := func(db *gorm.DB) (*Receipt, *errors.Error) {
+		runs++
+		if err := db.Create(&Account{Name: "carol", Balance: -1}).Error; err != nil {
+			return nil, errorspb.ErrorServerDbError("create failed: %v", err)
+		}
+		return nil, errorspb.ErrorBadRequest("negative balance").WithMetadata(map[string]string{"field": "balance"})
+	}
+
+	for range 2 {
+		res, erk, err := idempotency.Transaction(context.Background(), db, idempotency.NewConfig(), "key-1", rejectAccount)
+		gormkratostest.RequireRolledBack(t, erk, err)
+		require.Nil(t, res)
+		require.True(t, errorspb.IsBadRequest(erk))
+		require.Equal(t, "negative balance", erk.Message)
+		require.Equal(t, map[string]string{"field": "balance"}, erk.Metadata)
+	}
+	require.Equal(t, 1, runs)
+	require.Equal(t, int64(0), countAccounts(t, db))
+}
+
+// TestTransactionServerErk tests server errors are not stored, retries run again
+// TestTransactionServerErk 测试服务端错误不被保存, 重试会重新执行
+func TestTransactionServerErk(t *testing.T) {
+	db := setupTestDB(t)
+
+	var runs int
+	failAccount := func(db *gorm.DB) (*Receipt, *errors.Error) {
+		runs++
+		if runs == 1 {
+			return nil, errorspb.ErrorServerDbError("temporary failure")
+		}
+		return &Receipt{Name: "dave"}, nil
+	}
+
+	_, erk, err := idempotency.Transaction(context.Background(), db, idempotency.NewConfig(), "key-1", failAccount)
+	gormkratostest.RequireRolledBack(t, erk, err)
+	require.True(t, errorspb.IsServerDbError(erk))
+
+	res, erk, err := idempotency.Transaction(context.Background(), db, idempotency.NewConfig(), "key-1", failAccount)
+	gormkratostest.RequireCommitted(t, erk, err)
+	require.Equal(t, "dave", res.Name)
+	require.Equal(t, 2, runs)
+
+	// WithStoreErk stores server errors too
+	// WithStoreErk 也可保存服务端错误
+	config := idempotency.NewConfig().WithStoreErk(func(erk *errors.Error) bool { return true })
+	for range 2 {
+		_, erk, err = idempotency.Transaction(context.Background(), db, config, "key-2", func(db *gorm.DB) (*Receipt, *errors.Error) {
+			runs++
+			return nil, errorspb.ErrorServerDbError("permanent failure")
+		})
+		gormkratostest.RequireRolledBack(t, erk, err)
+		require.True(t, errorspb.IsServerDbError(erk))
+	}
+	require.Equal(t, 3, runs)
+}
+
+// TestTransactionProtoResponse tests proto responses are stored with protojson
+// TestTransactionProtoResponse 测试 proto 响应以 protojson 保存
+func TestTransactionProtoResponse(t *testing.T) {
+	db := setupTestDB(t)
+
+	var runs int
+	run := func(db *gorm.DB) (*wrapperspb.StringValue, *errors.Error) {
+		runs++
+		return wrapperspb.String("done"), nil
+	}
+
+	for range 2 {
+		res, erk, err := idempotency.Transaction(context.Background(), db, idempotency.NewConfig(), "key-1", run)
+		gormkratostest.RequireCommitted(t, erk, err)
+		require.Equal(t, "done", res.GetValue())
+	}
+	require.Equal(t, 1, runs)
+}
+
+// TestPurge tests purging deletes records stored before the time
+// TestPurge 测试清理删除该时间之前保存的记录
+func TestPurge(t *testing.T) {
+	db := setupTestDB(t)
+
+	for _, key := range []string{"key-1", "key-2"} {
+		_, erk, err := idempotency.Transaction(context.Background(), db, idempotency.NewConfig(), key, func(db *gorm.DB) (string, *errors.Error) {
+			return key, nil
+		})
+		gormkratostest.RequireCommitted(t, erk, err)
+	}
+
+	count, err := idempotency.Purge(context.Background(), db, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, int64(0), count)
+
+	count, err = idempotency.Purge(context.Background(), db, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	require.Equal(t, int64(2), count)
+}
@@ -0,0 +1,68 @@
+package idempotency
+
+import (
+	"context"
+
+	"github.com/go-kratos/kratos/v2/metadata"
+	"github.com/go-kratos/kratos/v2/transport"
+)
+
+const (
+	// HeaderKey is the request header carrying the idempotency key
+	// HeaderKey 是携带幂等键的请求头
+	HeaderKey = "Idempotency-Key"
+
+	// MetadataKey is the Kratos metadata key carrying the idempotency key
+	// Local metadata is not passed on to downstream services, each hop uses its own key
+	//
+	// MetadataKey 是携带幂等键的 Kratos 元数据键
+	// 本地元数据不会传递到下游服务, 每一跳使用自己的键
+	MetadataKey = "x-md-local-idempotency-key"
+)
+
+// KeyFromContext returns the idempotency key of the Kratos request in ctx, empty when not set
+// Checks the Idempotency-Key request header, then the x-md-local-idempotency-key metadata
+// Clients set the metadata with metadata.AppendToClientContext(ctx, idempotency.MetadataKey, key)
+//
+// KeyFromContext 返回 ctx 中 Kratos 请求的幂等键, 未设置时为空
+// 先检查 Idempotency-Key 请求头, 再检查 x-md-local-idempotency-key 元数据
+// 客户端通过 metadata.AppendToClientContext(ctx, idempotency.MetadataKey, key) 设置元数据
+func KeyFromContext(ctx context.Context) string {
+	if tr, ok := transport.FromServerContext(ctx); ok {
+		if key := tr.RequestHeader().Get(HeaderKey); key != "" {
+			return key
+		}
+	}
+	if md, ok := metadata.FromServerContext(ctx); ok {
+		return md.Get(MetadataKey)
+	}
+	return ""
+}
+
+// scopeKey carries the scope of idempotency keys set by WithScope
+// scopeKey 携带 WithScope 设置的幂等键作用域
+type scopeKey struct{}
+
+// WithScope returns a copy of ctx scoping idempotency keys to scope, such as "create-order"
+// The same key in different scopes stores different records, so one key cannot replay the response of another operation
+//
+// WithScope 返回将幂等键限定在 scope 中的 ctx 副本, 例如 "create-order"
+// 相同的键在不同作用域中保存不同的记录, 因此一个键不会重放另一个操作的响应
+func WithScope(ctx context.Context, scope string) context.Context {
+	return context.WithValue(ctx, scopeKey{}, scope)
+}
+
+// ScopeFromContext returns the scope of idempotency keys in ctx
+// Returns the scope set by WithScope, then the operation of the Kratos request, empty when neither is set
+//
+// ScopeFromContext 返回 ctx 中幂等键的作用域
+// 先返回 WithScope 设置的作用域, 再返回 Kratos 请求的操作名, 都未设置时为空
+func ScopeFromContext(ctx context.Context) string {
+	if scope, ok := ctx.Value(scopeKey{}).(string); ok {
+		return scope
+	}
+	if tr, ok := transport.FromServerContext(ctx); ok {
+		return tr.Operation()
+	}
+	return ""
+}
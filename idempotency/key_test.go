@@ -0,0 +1,111 @@
+package idempotency_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/metadata"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/orzkratos/gormkratos/gormkratostest"
+	"github.com/orzkratos/gormkratos/idempotency"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// headerCarrier is the request header of testTransport
+// headerCarrier 是 testTransport 的请求头
+type headerCarrier http.Header
+
+func (c headerCarrier) Get(key string) string      { return http.Header(c).Get(key) }
+func (c headerCarrier) Set(key, value string)      { http.Header(c).Set(key, value) }
+func (c headerCarrier) Add(key, value string)      { http.Header(c).Add(key, value) }
+func (c headerCarrier) Values(key string) []string { return http.Header(c).Values(key) }
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// testTransport is the server transport of requests in tests
+// testTransport 是测试中请求的服务端传输
+type testTransport struct {
+	header    headerCarrier
+	operation string
+}
+
+func (tr *testTransport) Kind() transport.Kind            { return transport.KindHTTP }
+func (tr *testTransport) Endpoint() string                { return "" }
+func (tr *testTransport) Operation() string               { return tr.operation }
+func (tr *testTransport) RequestHeader() transport.Header { return tr.header }
+func (tr *testTransport) ReplyHeader() transport.Header   { return headerCarrier{} }
+
+// TestKeyFromContext tests keys are taken from the request header, then the metadata
+// TestKeyFromContext 测试先从请求头获取键, 再从元数据获取
+func TestKeyFromContext(t *testing.T) {
+	require.Equal(t, "", idempotency.KeyFromContext(context.Background()))
+
+	header := headerCarrier{}
+	header.Set(idempotency.HeaderKey, "header-key")
+	ctx := transport.NewServerContext(context.Background(), &testTransport{header: header})
+	require.Equal(t, "header-key", idempotency.KeyFromContext(ctx))
+
+	ctx = metadata.NewServerContext(context.Background(), metadata.New(map[string][]string{
+		idempotency.MetadataKey: {"metadata-key"},
+	}))
+	require.Equal(t, "metadata-key", idempotency.KeyFromContext(ctx))
+
+	// Transports without the header fall back to the metadata
+	// 没有请求头的传输回退到元数据
+	ctx = transport.NewServerContext(ctx, &testTransport{header: headerCarrier{}})
+	require.Equal(t, "metadata-key", idempotency.KeyFromContext(ctx))
+}
+
+// TestTransactionContext tests the key of the Kratos request makes retries return the stored response
+// TestTransactionContext 测试 Kratos 请求的键使重试返回保存的响应
+func TestTransactionContext(t *testing.T) {
+	db := setupTestDB(t)
+
+	header := headerCarrier{}
+	header.Set(idempotency.HeaderKey, "request-1")
+	ctx := transport.NewServerContext(context.Background(), &testTransport{header: header})
+
+	var runs int
+	for range 2 {
+		res, erk, err := idempotency.TransactionContext(ctx, db, idempotency.NewConfig(), func(db *gorm.DB) (*Receipt, *errors.Error) {
+			runs++
+			return &Receipt{Name: "erin"}, nil
+		})
+		gormkratostest.RequireCommitted(t, erk, err)
+		require.Equal(t, "erin", res.Name)
+	}
+	require.Equal(t, 1, runs)
+}
+
+// TestTransactionContextScope tests the same key of different operations does not replay the other response
+// TestTransactionContextScope 测试不同操作的相同键不会重放另一个操作的响应
+func TestTransactionContextScope(t *testing.T) {
+	db := setupTestDB(t)
+
+	header := headerCarrier{}
+	header.Set(idempotency.HeaderKey, "request-1")
+	createCtx := transport.NewServerContext(context.Background(), &testTransport{header: header, operation: "/test.v1.Accounts/Create"})
+	renameCtx := transport.NewServerContext(context.Background(), &testTransport{header: header, operation: "/test.v1.Accounts/Rename"})
+	require.Equal(t, "/test.v1.Accounts/Create", idempotency.ScopeFromContext(createCtx))
+	require.Equal(t, "orders", idempotency.ScopeFromContext(idempotency.WithScope(createCtx, "orders")))
+
+	var runs []string
+	for _, ctx := range []context.Context{createCtx, renameCtx, createCtx, idempotency.WithScope(createCtx, "orders")} {
+		operation := idempotency.ScopeFromContext(ctx)
+		res, erk, err := idempotency.TransactionContext(ctx, db, idempotency.NewConfig(), func(db *gorm.DB) (*Receipt, *errors.Error) {
+			runs = append(runs, operation)
+			return &Receipt{Name: operation}, nil
+		})
+		gormkratostest.RequireCommitted(t, erk, err)
+		require.Equal(t, operation, res.Name)
+	}
+	require.Equal(t, []string{"/test.v1.Accounts/Create", "/test.v1.Accounts/Rename", "orders"}, runs)
+}
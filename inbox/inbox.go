@@ -0,0 +1,130 @@
+// Package inbox: Inbox pattern for gormkratos transactions
+// Records the ID of each consumed message in the same transaction as its side effects,
+// so messages delivered again by at-least-once brokers are skipped
+//
+// inbox: gormkratos 事务的收件箱模式
+// 在副作用的同一事务中记录每条已消费消息的 ID,
+// 使至少一次投递的消息代理再次投递的消息被跳过
+package inbox
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/orzkratos/gormkratos"
+	"github.com/yyle88/erero"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Record marks one message processed by one consumer
+// Record 标记一条消息已被一个消费者处理
+type Record struct {
+	Consumer    string    `gorm:"column:consumer;primaryKey;size:255"`   // Consumer name // 消费者名称
+	MessageID   string    `gorm:"column:message_id;primaryKey;size:255"` // Message ID // 消息 ID
+	ProcessedAt time.Time `gorm:"column:processed_at;index"`             // Time processed // 处理时间
+}
+
+// TableName returns the inbox table name
+// TableName 返回收件箱表名
+func (*Record) TableName() string {
+	return "inbox_records"
+}
+
+// Migrate creates or updates the inbox table
+//
+// Migrate 创建或更新收件箱表
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(&Record{})
+}
+
+// Config configures the consumer and the outcome of duplicates
+//
+// Config 配置消费者和重复消息的结果
+type Config struct {
+	Consumer    string                               // Consumer name, message IDs are deduplicated per consumer // 消费者名称, 消息 ID 按消费者去重
+	OnDuplicate func(messageID string) *errors.Error // Outcome of duplicates, nil acknowledges them as processed // 重复消息的结果, nil 表示视为已处理并确认
+}
+
+// NewConfig creates inbox config of the consumer, acknowledging duplicates
+//
+// NewConfig 创建该消费者的收件箱配置, 确认重复消息
+func NewConfig(consumer string) *Config {
+	return &Config{
+		Consumer: consumer,
+		OnDuplicate: func(messageID string) *errors.Error {
+			return nil
+		},
+	}
+}
+
+// WithOnDuplicate sets the outcome of duplicates
+// WithOnDuplicate 设置重复消息的结果
+func (c *Config) WithOnDuplicate(onDuplicate func(messageID string) *errors.Error) *Config {
+	c.OnDuplicate = onDuplicate
+	return c
+}
+
+// Consume executes run in database transaction at most once per message ID
+// The message ID is recorded first, so concurrent deliveries of the same ID wait until the first one ends
+// Duplicates skip run and return the outcome of OnDuplicate, when run fails the record rolls back and redeliveries run again
+// Empty message IDs disable deduplication, run executes every time
+// Returns the same two errors as gormkratos.Transaction
+//
+// Consume 对每个消息 ID 最多执行一次数据库事务中的 run
+// 先记录消息 ID, 使相同 ID 的并发投递等待第一个结束
+// 重复消息跳过 run 并返回 OnDuplicate 的结果, run 失败时记录随之回滚, 再次投递时重新执行
+// 空消息 ID 表示不去重, 每次都执行 run
+// 返回与 gormkratos.Transaction 相同的两个错误
+func Consume(
+	ctx context.Context,
+	db *gorm.DB,
+	config *Config,
+	messageID string,
+	run func(db *gorm.DB) *errors.Error,
+	options ...*sql.TxOptions,
+) (erk *errors.Error, err error) {
+	if messageID == "" {
+		return gormkratos.Transaction(ctx, db, run, options...)
+	}
+	return gormkratos.Transaction(ctx, db, func(db *gorm.DB) *errors.Error {
+		record := &Record{Consumer: config.Consumer, MessageID: messageID, ProcessedAt: time.Now().UTC()}
+		result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+		if result.Error != nil {
+			return gormkratos.TranslateDbError(result.Error)
+		}
+		if result.RowsAffected == 0 {
+			if config.OnDuplicate == nil {
+				return nil
+			}
+			return config.OnDuplicate(messageID)
+		}
+		return run(db)
+	}, options...)
+}
+
+// Processed checks whether the consumer has processed the message
+//
+// Processed 检查该消费者是否已处理该消息
+func Processed(ctx context.Context, db *gorm.DB, consumer string, messageID string) (bool, error) {
+	var count int64
+	if err := db.WithContext(ctx).Model(&Record{}).Where("consumer = ? AND message_id = ?", consumer, messageID).Count(&count).Error; err != nil {
+		return false, erero.Wro(err)
+	}
+	return count > 0, nil
+}
+
+// Purge deletes records processed before the time, returns the count deleted
+// Messages delivered again after purging run again, keep records longer than brokers redeliver
+//
+// Purge 删除在该时间之前处理的记录, 返回删除的数量
+// 清理后再次投递的消息会重新执行, 记录的保留时间应长于消息代理的重新投递时间
+func Purge(ctx context.Context, db *gorm.DB, before time.Time) (int64, error) {
+	result := db.WithContext(ctx).Where("processed_at < ?", before.UTC()).Delete(&Record{})
+	if result.Error != nil {
+		return 0, erero.Wro(result.Error)
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,159 @@
+package inbox_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/orzkratos/gormkratos/api/dberrors/v1"
+	"github.com/orzkratos/gormkratos/gormkratostest"
+	"github.com/orzkratos/gormkratos/inbox"
+	"github.com/orzkratos/gormkratos/internal/errorspb"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// Payment is the side effect applied when consuming messages in inbox tests
+// Payment 是收件箱测试中消费消息时产生的副作用
+type Payment struct {
+	ID     uint `gorm:"primaryKey"`
+	Amount int
+}
+
+// setupTestDB creates isolated in-memory SQLite database with the inbox table
+// setupTestDB 创建带收件箱表的独立内存 SQLite 数据库
+func setupTestDB(t *testing.T) *gorm.DB {
+	db := gormkratostest.NewDB(t, &Payment{})
+	require.NoError(t, inbox.Migrate(db))
+	return db
+}
+
+// countPayments counts the committed payments
+// countPayments 统计已提交的付款数量
+func countPayments(t *testing.T, db *gorm.DB) int64 {
+	var count int64
+	require.NoError(t, db.Model(&Payment{}).Count(&count).Error)
+	return count
+}
+
+// createPayment is the run creating one payment
+// createPayment 是创建一笔付款的 run
+func createPayment(db *gorm.DB) *errors.Error {
+	if err := db.Create(&Payment{Amount: 100}).Error; err != nil {
+		return errorspb.ErrorServerDbError("create failed: %v", err)
+	}
+	return nil
+}
+
+// TestConsumeDuplicate tests messages delivered again skip run and are acknowledged
+// TestConsumeDuplicate 测试再次投递的消息跳过 run 并被确认
+func TestConsumeDuplicate(t *testing.T) {
+	db := setupTestDB(t)
+	config := inbox.NewConfig("billing")
+
+	for range 3 {
+		erk, err := inbox.Consume(context.Background(), db, config, "msg-1", createPayment)
+		gormkratostest.RequireCommitted(t, erk, err)
+	}
+	require.Equal(t, int64(1), countPayments(t, db))
+
+	processed, err := inbox.Processed(context.Background(), db, "billing", "msg-1")
+	require.NoError(t, err)
+	require.True(t, processed)
+
+	// Other consumers process the same message once too
+	// 其他消费者同样处理该消息一次
+	erk, err := inbox.Consume(context.Background(), db, inbox.NewConfig("audit"), "msg-1", createPayment)
+	gormkratostest.RequireCommitted(t, erk, err)
+	require.Equal(t, int64(2), countPayments(t, db))
+}
+
+// TestConsumeOnDuplicate tests the configured outcome of duplicates
+// TestConsumeOnDuplicate 测试配置的重复消息结果
+func TestConsumeOnDuplicate(t *testing.T) {
+	db := setupTestDB(t)
+	config := inbox.NewConfig("billing").WithOnDuplicate(func(messageID string) *errors.Error {
+		return dberrors.ErrorDbConflict("message %s was processed", messageID)
+	})
+
+	erk, err := inbox.Consume(context.Background(), db, config, "msg-1", createPayment)
+	gormkratostest.RequireCommitted(t, erk, err)
+
+	erk, err = inbox.Consume(context.Background(), db, config, "msg-1", createPayment)
+	gormkratostest.RequireRolledBack(t, erk, err)
+	require.True(t, dberrors.IsDbConflict(erk))
+	require.Equal(t, int64(1), countPayments(t, db))
+}
+
+// TestConsumeNilOnDuplicate tests nil OnDuplicate acknowledges duplicates
+// TestConsumeNilOnDuplicate 测试 OnDuplicate 为 nil 时确认重复消息
+func TestConsumeNilOnDuplicate(t *testing.T) {
+	db := setupTestDB(t)
+	config := inbox.NewConfig("billing").WithOnDuplicate(nil)
+
+	for range 2 {
+		erk, err := inbox.Consume(context.Background(), db, config, "msg-1", createPayment)
+		gormkratostest.RequireCommitted(t, erk, err)
+	}
+	require.Equal(t, int64(1), countPayments(t, db))
+}
+
+// TestConsumeRollback tests failed runs leave the message unprocessed, so redeliveries run again
+// TestConsumeRollback 测试失败的 run 使消息保持未处理, 再次投递时重新执行
+func TestConsumeRollback(t *testing.T) {
+	db := setupTestDB(t)
+	config := inbox.NewConfig("billing")
+
+	erk, err := inbox.Consume(context.Background(), db, config, "msg-1", func(db *gorm.DB) *errors.Error {
+		if erk := createPayment(db); erk != nil {
+			return erk
+		}
+		return errorspb.ErrorBadRequest("card declined")
+	})
+	gormkratostest.RequireRolledBack(t, erk, err)
+	require.True(t, errorspb.IsBadRequest(erk))
+
+	processed, err := inbox.Processed(context.Background(), db, "billing", "msg-1")
+	require.NoError(t, err)
+	require.False(t, processed)
+
+	erk, err = inbox.Consume(context.Background(), db, config, "msg-1", createPayment)
+	gormkratostest.RequireCommitted(t, erk, err)
+	require.Equal(t, int64(1), countPayments(t, db))
+}
+
+// TestConsumeEmptyMessageID tests empty message IDs run every time
+// TestConsumeEmptyMessageID 测试空消息 ID 每次都执行
+func TestConsumeEmptyMessageID(t *testing.T) {
+	db := setupTestDB(t)
+	config := inbox.NewConfig("billing")
+
+	for range 2 {
+		erk, err := inbox.Consume(context.Background(), db, config, "", createPayment)
+		gormkratostest.RequireCommitted(t, erk, err)
+	}
+	require.Equal(t, int64(2), countPayments(t, db))
+}
+
+// TestPurge tests purged messages are consumed again
+// TestPurge 测试清理后的消息会再次被消费
+func TestPurge(t *testing.T) {
+	db := setupTestDB(t)
+	config := inbox.NewConfig("billing")
+
+	erk, err := inbox.Consume(context.Background(), db, config, "msg-1", createPayment)
+	gormkratostest.RequireCommitted(t, erk, err)
+
+	count, err := inbox.Purge(context.Background(), db, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, int64(0), count)
+
+	count, err = inbox.Purge(context.Background(), db, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), count)
+
+	erk, err = inbox.Consume(context.Background(), db, config, "msg-1", createPayment)
+	gormkratostest.RequireCommitted(t, erk, err)
+	require.Equal(t, int64(2), countPayments(t, db))
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/go-kratos/kratos/v2/errors"
 	"github.com/google/uuid"
 	"github.com/orzkratos/gormkratos"
+	"github.com/orzkratos/gormkratos/api/dberrors/v1"
 	"github.com/yyle88/must"
 	"github.com/yyle88/rese"
 	"github.com/yyle88/zaplog"
@@ -39,10 +40,10 @@ func main() {
 
 	ctx := context.Background()
 
-	erk := Transaction(ctx, db, func(db *gorm.DB) *errors.Error {
+	erk := gormkratos.TransactionErk(ctx, db, func(db *gorm.DB) *errors.Error {
 		admin := &Admin{Name: "Alice"}
 		if err := db.Create(admin).Error; err != nil {
-			return ErrorServerDbError("create failed: %v", err)
+			return dberrors.ErrorServerDbError("create failed: %v", err)
 		}
 		zaplog.LOG.Debug("Created admin", zap.Uint("id", admin.ID), zap.String("name", admin.Name))
 		return nil
@@ -51,31 +52,3 @@ func main() {
 		zaplog.LOG.Error("Error", zap.Error(erk))
 	}
 }
-
-// ErrorServerDbError creates Kratos database operation errors
-// ErrorServerDbError 创建 Kratos 数据库操作错误
-func ErrorServerDbError(format string, args ...interface{}) *errors.Error {
-	return errors.New(500, "DB_ERROR", fmt.Sprintf(format, args...))
-}
-
-// ErrorServerDbTransactionError creates Kratos transaction-level errors
-// ErrorServerDbTransactionError 创建 Kratos 事务级错误
-func ErrorServerDbTransactionError(format string, args ...interface{}) *errors.Error {
-	return errors.New(500, "TRANSACTION_ERROR", fmt.Sprintf(format, args...))
-}
-
-// Transaction wraps gormkratos.Transaction with single-error-return pattern
-// Returns business errors (erk) as-is, wraps database errors (err) as TRANSACTION_ERROR
-//
-// Transaction 用单错误返回模式包装 gormkratos.Transaction
-// 直接返回业务错误 (erk),将数据库错误 (err) 包装为 TRANSACTION_ERROR
-func Transaction(ctx context.Context, db *gorm.DB, run func(db *gorm.DB) *errors.Error) *errors.Error {
-	erk, err := gormkratos.Transaction(ctx, db, run)
-	if err != nil {
-		if erk != nil {
-			return erk
-		}
-		return ErrorServerDbTransactionError("transaction failed: %v", err)
-	}
-	return nil
-}
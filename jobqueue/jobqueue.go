@@ -0,0 +1,78 @@
+// Package jobqueue: Transactional job queue built on gormkratos.Transaction
+// Enqueues background jobs in the same transaction as business data,
+// then workers claim due jobs with row locks and leases and run each one in its own transaction
+//
+// jobqueue: 基于 gormkratos.Transaction 的事务性任务队列
+// 在业务数据的同一事务中入队后台任务,
+// 然后由工作者通过行锁和租约认领到期的任务, 并在各自的事务中执行
+package jobqueue
+
+import (
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/orzkratos/gormkratos/api/dberrors/v1"
+	"gorm.io/gorm"
+)
+
+// Status of jobs
+// Status 任务的状态
+type Status string
+
+const (
+	StatusPending Status = "pending" // Waiting to run // 等待执行
+	StatusRunning Status = "running" // Claimed by a worker under lease // 已被工作者在租约内认领
+	StatusDone    Status = "done"    // Finished // 已完成
+	StatusDead    Status = "dead"    // Exhausted attempts // 耗尽尝试次数
+)
+
+// Job represents one job in the job table
+// Job 表示任务表中的一个任务
+type Job struct {
+	ID         uint64     `gorm:"primarykey"`                                                       // Auto-increment ID // 自增主键
+	Kind       string     `gorm:"column:kind;size:255;not null;index"`                              // Job kind, selects the handler // 任务类型, 用于选择处理函数
+	Payload    []byte     `gorm:"column:payload"`                                                   // Job payload // 任务内容
+	Status     Status     `gorm:"column:status;size:16;not null;index:idx_jobqueue_due,priority:1"` // Job status // 任务状态
+	RunAt      time.Time  `gorm:"column:run_at;not null;index:idx_jobqueue_due,priority:2"`         // Time the job is due, the lease end while running // 任务到期时间, 执行中时为租约结束时间
+	Attempts   int        `gorm:"column:attempts;not null"`                                         // Claimed attempts // 认领执行的次数
+	LeaseToken string     `gorm:"column:lease_token;size:64"`                                       // Token of the current lease // 当前租约的令牌
+	LastError  string     `gorm:"column:last_error"`                                                // Error of the last failed attempt // 最近一次失败的错误
+	CreatedAt  time.Time  `gorm:"column:created_at"`                                                // Time of enqueuing // 入队时间
+	FinishedAt *time.Time `gorm:"column:finished_at"`                                               // Time finished or dead // 完成或进入死信的时间
+}
+
+// TableName returns the job table name
+// TableName 返回任务表名
+func (*Job) TableName() string {
+	return "jobqueue_jobs"
+}
+
+// Migrate creates or updates the job table
+//
+// Migrate 创建或更新任务表
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(&Job{})
+}
+
+// Enqueue writes a job into the job table, call it inside run with the tx
+// The job runs at runAt, zero runAt runs it at once, only when the transaction commits
+//
+// Enqueue 将任务写入任务表, 在 run 中使用 tx 调用
+// 任务在 runAt 执行, runAt 为零值时立即执行, 只有在事务提交后才会执行
+func Enqueue(tx *gorm.DB, kind string, payload []byte, runAt time.Time) *errors.Error {
+	now := time.Now().UTC()
+	if runAt.IsZero() {
+		runAt = now
+	}
+	job := &Job{
+		Kind:      kind,
+		Payload:   payload,
+		Status:    StatusPending,
+		RunAt:     runAt.UTC(),
+		CreatedAt: now,
+	}
+	if err := tx.Create(job).Error; err != nil {
+		return dberrors.ErrorServerDbError("failed to enqueue job of kind %s: %v", kind, err)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package jobqueue_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/orzkratos/errkratos/must/erkrequire"
+	"github.com/orzkratos/gormkratos"
+	"github.com/orzkratos/gormkratos/gormkratostest"
+	"github.com/orzkratos/gormkratos/internal/errorspb"
+	"github.com/orzkratos/gormkratos/jobqueue"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// Order is the business model changed together with jobs in tests
+// Order 是测试中与任务一起修改的业务模型
+type Order struct {
+	ID     uint   `gorm:"primaryKey"`
+	Status string `gorm:"not null"`
+}
+
+// setupTestDB creates isolated in-memory SQLite database with the job table
+// One connection serializes the workers, as SQLite shared cache fails concurrent writes at once
+// NewDB holds one more connection open to keep the in-memory database
+//
+// setupTestDB 创建带任务表的独立内存 SQLite 数据库
+// 单个连接使工作者串行执行, 因为 SQLite 共享缓存下的并发写入会立即失败
+// NewDB 另外保持一个连接打开以保留内存数据库
+func setupTestDB(t *testing.T) *gorm.DB {
+	db := gormkratostest.NewDB(t, &Order{})
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(2)
+	require.NoError(t, jobqueue.Migrate(db))
+	return db
+}
+
+// enqueue writes jobs of the kind in one transaction, due at runAt
+// enqueue 在一个事务中写入该类型的任务, 在 runAt 到期
+func enqueue(t *testing.T, db *gorm.DB, kind string, runAt time.Time, payloads ...string) {
+	erk := gormkratos.TransactionErk(context.Background(), db, func(db *gorm.DB) *errors.Error {
+		for _, payload := range payloads {
+			if erk := jobqueue.Enqueue(db, kind, []byte(payload), runAt); erk != nil {
+				return erk
+			}
+		}
+		return nil
+	})
+	erkrequire.NoError(t, erk)
+}
+
+// TestEnqueueCommit tests enqueued jobs are stored when the transaction commits
+// TestEnqueueCommit 测试事务提交时入队的任务被保存
+func TestEnqueueCommit(t *testing.T) {
+	db := setupTestDB(t)
+
+	erk, err := gormkratos.Transaction(context.Background(), db, func(db *gorm.DB) *errors.Error {
+		if err := db.Create(&Order{Status: "paid"}).Error; err != nil {
+			return gormkratos.TranslateDbError(err)
+		}
+		return jobqueue.Enqueue(db, "order.ship", []byte(`{"id":1}`), time.Time{})
+	})
+	require.NoError(t, err)
+	erkrequire.NoError(t, erk)
+
+	var jobs []*jobqueue.Job
+	require.NoError(t, db.Find(&jobs).Error)
+	require.Len(t, jobs, 1)
+	require.Equal(t, "order.ship", jobs[0].Kind)
+	require.Equal(t, []byte(`{"id":1}`), jobs[0].Payload)
+	require.Equal(t, jobqueue.StatusPending, jobs[0].Status)
+	require.False(t, jobs[0].RunAt.After(time.Now()))
+}
+
+// TestEnqueueRollback tests enqueued jobs are dropped when the transaction rolls back
+// TestEnqueueRollback 测试事务回滚时入队的任务被丢弃
+func TestEnqueueRollback(t *testing.T) {
+	db := setupTestDB(t)
+
+	erk, err := gormkratos.Transaction(context.Background(), db, func(db *gorm.DB) *errors.Error {
+		if erk := jobqueue.Enqueue(db, "order.ship", []byte(`{"id":1}`), time.Time{}); erk != nil {
+			return erk
+		}
+		return errorspb.ErrorBadRequest("validation failed")
+	})
+	require.Error(t, err)
+	require.True(t, errorspb.IsBadRequest(erk))
+
+	var count int64
+	require.NoError(t, db.Model(&jobqueue.Job{}).Count(&count).Error)
+	require.Equal(t, int64(0), count)
+}
@@ -0,0 +1,412 @@
+package jobqueue
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/google/uuid"
+	"github.com/orzkratos/gormkratos"
+	"github.com/orzkratos/gormkratos/api/dberrors/v1"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/zaplog"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Handler runs one job inside its own transaction, db is the tx
+// Returning erk rolls back the transaction and retries the job with backoff
+//
+// Handler 在独立的事务中执行一个任务, db 即 tx
+// 返回 erk 时回滚事务并以退避方式重试该任务
+type Handler func(db *gorm.DB, job *Job) *errors.Error
+
+// ClaimStrategy selects how workers claim due jobs
+// ClaimStrategy 选择工作者认领到期任务的方式
+type ClaimStrategy string
+
+const (
+	ClaimAuto        ClaimStrategy = ""            // Conditional on SQLite, skip-locked on others // SQLite 上使用条件更新, 其它数据库使用跳过锁定
+	ClaimSkipLocked  ClaimStrategy = "skip_locked" // SELECT ... FOR UPDATE SKIP LOCKED, then lease the rows // SELECT ... FOR UPDATE SKIP LOCKED, 然后租用这些行
+	ClaimConditional ClaimStrategy = "conditional" // Lease each row with UPDATE ... WHERE still due, works without row locks // 通过 UPDATE ... WHERE 仍到期逐行租用, 无需行锁
+)
+
+// WorkerConfig configures the worker pool
+//
+// WorkerConfig 配置工作者池
+type WorkerConfig struct {
+	Concurrency   int           // Count of polling workers in Run // Run 中轮询工作者的数量
+	BatchSize     int           // Max jobs claimed per poll // 每次轮询最多认领的任务数
+	PollInterval  time.Duration // Wait time between polls // 轮询间隔
+	LeaseTimeout  time.Duration // Claimed jobs become due again after this time, handlers stop at the lease end // 认领的任务超过该时间再次到期, 处理函数在租约结束时停止
+	MaxAttempts   int           // Attempts before the job is dead // 任务进入死信前的尝试次数
+	BaseDelay     time.Duration // Delay before the first retry // 首次重试前的等待时间
+	MaxDelay      time.Duration // Upper bound of the retry delay // 重试等待时间上限
+	ClaimStrategy ClaimStrategy // How due jobs are claimed // 认领到期任务的方式
+}
+
+// NewWorkerConfig creates worker config with defaults
+// Default: 4 workers, 10 per batch, 1s poll interval, 5m lease, 10 attempts, 1s base delay, 1h max delay
+//
+// NewWorkerConfig 创建带默认值的工作者配置
+// 默认: 4 个工作者, 每批 10 个, 1s 轮询间隔, 5m 租约, 10 次尝试, 1s 基础等待, 1h 最大等待
+func NewWorkerConfig() *WorkerConfig {
+	return &WorkerConfig{
+		Concurrency:   4,
+		BatchSize:     10,
+		PollInterval:  time.Second,
+		LeaseTimeout:  5 * time.Minute,
+		MaxAttempts:   10,
+		BaseDelay:     time.Second,
+		MaxDelay:      time.Hour,
+		ClaimStrategy: ClaimAuto,
+	}
+}
+
+// WithConcurrency sets the count of polling workers
+// WithConcurrency 设置轮询工作者的数量
+func (c *WorkerConfig) WithConcurrency(concurrency int) *WorkerConfig {
+	c.Concurrency = concurrency
+	return c
+}
+
+// WithBatchSize sets the max jobs claimed per poll
+// WithBatchSize 设置每次轮询最多认领的任务数
+func (c *WorkerConfig) WithBatchSize(batchSize int) *WorkerConfig {
+	c.BatchSize = batchSize
+	return c
+}
+
+// WithPollInterval sets the wait time between polls
+// WithPollInterval 设置轮询间隔
+func (c *WorkerConfig) WithPollInterval(pollInterval time.Duration) *WorkerConfig {
+	c.PollInterval = pollInterval
+	return c
+}
+
+// WithLeaseTimeout sets the lease of claimed jobs
+// WithLeaseTimeout 设置认领任务的租约时间
+func (c *WorkerConfig) WithLeaseTimeout(leaseTimeout time.Duration) *WorkerConfig {
+	c.LeaseTimeout = leaseTimeout
+	return c
+}
+
+// WithMaxAttempts sets the attempts before the job is dead
+// WithMaxAttempts 设置任务进入死信前的尝试次数
+func (c *WorkerConfig) WithMaxAttempts(maxAttempts int) *WorkerConfig {
+	c.MaxAttempts = maxAttempts
+	return c
+}
+
+// WithBackoff sets the base delay and max delay of retries
+// WithBackoff 设置重试的基础等待和最大等待
+func (c *WorkerConfig) WithBackoff(baseDelay time.Duration, maxDelay time.Duration) *WorkerConfig {
+	c.BaseDelay = baseDelay
+	c.MaxDelay = maxDelay
+	return c
+}
+
+// WithClaimStrategy sets how due jobs are claimed
+// WithClaimStrategy 设置认领到期任务的方式
+func (c *WorkerConfig) WithClaimStrategy(claimStrategy ClaimStrategy) *WorkerConfig {
+	c.ClaimStrategy = claimStrategy
+	return c
+}
+
+// delay computes the wait time after the given failed attempts, doubling each time
+// delay 计算给定失败次数后的等待时间, 每次翻倍
+func (c *WorkerConfig) delay(attempts int) time.Duration {
+	delay := float64(c.BaseDelay) * math.Pow(2, float64(attempts-1))
+	if c.MaxDelay > 0 {
+		delay = min(delay, float64(c.MaxDelay))
+	}
+	return time.Duration(delay)
+}
+
+// Worker claims due jobs and runs their handlers, each job in its own transaction
+// Jobs are marked done in the handler transaction, so the changes of the handler and the status commit together
+// A job whose lease expired is claimed again, its attempt counts towards MaxAttempts
+//
+// Worker 认领到期的任务并执行其处理函数, 每个任务在独立的事务中执行
+// 任务在处理函数的事务中标记为完成, 使处理函数的修改和任务状态一起提交
+// 租约过期的任务会被再次认领, 该次尝试计入 MaxAttempts
+type Worker struct {
+	db       *gorm.DB
+	config   *WorkerConfig
+	handlers map[string]Handler
+}
+
+// NewWorker creates worker running jobs of the database, register handlers with Handle before Run
+//
+// NewWorker 创建执行数据库中任务的工作者, 在 Run 之前通过 Handle 注册处理函数
+func NewWorker(db *gorm.DB, config *WorkerConfig) *Worker {
+	return &Worker{db: db, config: config, handlers: map[string]Handler{}}
+}
+
+// Handle registers the handler of the job kind, jobs without handlers fail and are retried
+// Handle 注册该任务类型的处理函数, 没有处理函数的任务会失败并重试
+func (w *Worker) Handle(kind string, handler Handler) *Worker {
+	w.handlers[kind] = handler
+	return w
+}
+
+// Run polls and runs jobs with Concurrency workers until ctx is done
+//
+// Run 使用 Concurrency 个工作者轮询并执行任务, 直到 ctx 结束
+func (w *Worker) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for range max(w.config.Concurrency, 1) {
+		wg.Go(func() {
+			for {
+				if _, err := w.WorkOnce(ctx); err != nil && ctx.Err() == nil {
+					zaplog.LOG.Error("job worker failed", zap.Error(err))
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(w.config.PollInterval):
+				}
+			}
+		})
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// WorkOnce claims one batch of due jobs and runs them, returns the count of jobs done
+// Every claimed job runs even when others fail to record their outcome, the errors are joined
+//
+// WorkOnce 认领一批到期的任务并执行, 返回完成的任务数
+// 即使其它任务记录结果失败, 每个认领的任务都会执行, 错误合并后返回
+func (w *Worker) WorkOnce(ctx context.Context) (int, error) {
+	jobs, err := w.claim(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var done int
+	var errs []error
+	for _, job := range jobs {
+		ok, err := w.process(ctx, job)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if ok {
+			done++
+		}
+	}
+	if len(errs) > 0 {
+		return done, erero.Joins(errs)
+	}
+	return done, nil
+}
+
+// claim leases due jobs with the configured strategy
+// claim 使用配置的方式租用到期的任务
+func (w *Worker) claim(ctx context.Context) ([]*Job, error) {
+	strategy := w.config.ClaimStrategy
+	if strategy == ClaimAuto {
+		strategy = ClaimSkipLocked
+		if w.db.Dialector.Name() == "sqlite" {
+			strategy = ClaimConditional
+		}
+	}
+	if strategy == ClaimConditional {
+		return w.claimConditional(ctx)
+	}
+	return w.claimSkipLocked(ctx)
+}
+
+// claimSkipLocked locks due jobs skipping rows locked by other workers, then leases them in the same transaction
+// claimSkipLocked 锁定到期的任务并跳过被其它工作者锁定的行, 然后在同一事务中租用它们
+func (w *Worker) claimSkipLocked(ctx context.Context) ([]*Job, error) {
+	var jobs []*Job
+	now := time.Now().UTC()
+	lease := w.newLease(now)
+	_, err := gormkratos.Transaction(ctx, w.db, func(db *gorm.DB) *errors.Error {
+		locked, erk := gormkratos.LockRows(db, gormkratos.NewLockConfig().WithSkipLocked())
+		if erk != nil {
+			return erk
+		}
+		if err := due(locked, now).Order("run_at, id").Limit(w.config.BatchSize).Find(&jobs).Error; err != nil {
+			return gormkratos.TranslateDbError(err)
+		}
+		if len(jobs) == 0 {
+			return nil
+		}
+		ids := make([]uint64, 0, len(jobs))
+		for _, job := range jobs {
+			ids = append(ids, job.ID)
+		}
+		if err := db.Model(&Job{}).Where("id IN ?", ids).Updates(lease.columns()).Error; err != nil {
+			return gormkratos.TranslateDbError(err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, erero.Wro(err)
+	}
+	for _, job := range jobs {
+		lease.apply(job)
+	}
+	return jobs, nil
+}
+
+// claimConditional leases each due job with a conditional UPDATE, only when it is still due
+// claimConditional 通过条件 UPDATE 逐个租用到期的任务, 仅当其仍然到期时
+func (w *Worker) claimConditional(ctx context.Context) ([]*Job, error) {
+	db := w.db.WithContext(ctx)
+	now := time.Now().UTC()
+
+	var candidates []*Job
+	if err := due(db, now).Order("run_at, id").Limit(w.config.BatchSize).Find(&candidates).Error; err != nil {
+		return nil, erero.Wro(err)
+	}
+
+	jobs := make([]*Job, 0, len(candidates))
+	for _, job := range candidates {
+		lease := w.newLease(now)
+		result := due(db.Model(&Job{}), now).Where("id = ?", job.ID).Updates(lease.columns())
+		if result.Error != nil {
+			return jobs, erero.Wro(result.Error)
+		}
+		if result.RowsAffected != 1 {
+			continue // Claimed by another worker // 已被其它工作者认领
+		}
+		lease.apply(job)
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// due filters jobs that are pending and due, or running with expired leases
+// due 筛选待执行且到期, 或执行中但租约已过期的任务
+func due(db *gorm.DB, now time.Time) *gorm.DB {
+	return db.Where("status IN ? AND run_at <= ?", []Status{StatusPending, StatusRunning}, now)
+}
+
+// lease is one claim of jobs by a worker
+// lease 是工作者对任务的一次认领
+type lease struct {
+	token string
+	until time.Time
+}
+
+// newLease creates lease with a new token, ending after the lease timeout
+// newLease 创建带新令牌的租约, 在租约时间后结束
+func (w *Worker) newLease(now time.Time) *lease {
+	return &lease{token: uuid.NewString(), until: now.Add(w.config.LeaseTimeout)}
+}
+
+// columns returns the columns leasing the job
+// columns 返回租用任务的列
+func (l *lease) columns() map[string]any {
+	return map[string]any{
+		"status":      StatusRunning,
+		"run_at":      l.until,
+		"lease_token": l.token,
+		"attempts":    gorm.Expr("attempts + 1"),
+	}
+}
+
+// apply sets the leased columns on the loaded job
+// apply 在已加载的任务上设置租用的列
+func (l *lease) apply(job *Job) {
+	job.Status = StatusRunning
+	job.RunAt = l.until
+	job.LeaseToken = l.token
+	job.Attempts++
+}
+
+// process runs the handler of the job, returns whether the job is done
+// Panics of the handler are recovered as failed attempts, see gormkratos.RecoverPanic
+//
+// process 执行任务的处理函数, 返回任务是否完成
+// 处理函数的 panic 被捕获为失败的尝试, 参见 gormkratos.RecoverPanic
+func (w *Worker) process(ctx context.Context, job *Job) (bool, error) {
+	if job.Attempts > w.config.MaxAttempts {
+		// The last attempt lost its lease, such as the worker crashed
+		// 最后一次尝试丢失了租约, 例如工作者崩溃
+		return false, w.fail(ctx, job, erero.Errorf("lease of job %d expired on the last attempt", job.ID))
+	}
+	handler, ok := w.handlers[job.Kind]
+	if !ok {
+		return false, w.fail(ctx, job, erero.Errorf("no handler of job kind %s", job.Kind))
+	}
+
+	// The lease started at claim time, stop the handler once it ends, other workers may claim the job then
+	// 租约从认领时开始, 租约结束时停止处理函数, 此后其他工作者可能认领该任务
+	runCtx, cancel := context.WithDeadline(ctx, job.RunAt)
+	defer cancel()
+	_, err := gormkratos.Transaction(runCtx, w.db, gormkratos.RecoverPanic(func(db *gorm.DB) *errors.Error {
+		if erk := handler(db, job); erk != nil {
+			return erk
+		}
+		return w.complete(db, job)
+	}))
+	if err != nil {
+		return false, w.fail(ctx, job, err)
+	}
+	return true, nil
+}
+
+// complete marks the job done in the handler transaction, losing the lease rolls back the handler
+// complete 在处理函数的事务中将任务标记为完成, 丢失租约时回滚处理函数
+func (w *Worker) complete(db *gorm.DB, job *Job) *errors.Error {
+	now := time.Now().UTC()
+	result := db.Model(&Job{}).Where("id = ? AND lease_token = ?", job.ID, job.LeaseToken).Updates(map[string]any{
+		"status":      StatusDone,
+		"finished_at": now,
+		"lease_token": "",
+	})
+	if result.Error != nil {
+		return gormkratos.TranslateDbError(result.Error)
+	}
+	if result.RowsAffected != 1 {
+		return dberrors.ErrorDbConflict("lease of job %d was lost", job.ID)
+	}
+	job.Status = StatusDone
+	job.FinishedAt = &now
+	job.LeaseToken = ""
+	return nil
+}
+
+// fail records the failed attempt, schedules the retry or marks the job dead
+// Jobs whose lease was lost are left to the worker holding the new lease
+//
+// fail 记录失败的尝试, 安排重试或将任务标记为死信
+// 租约已丢失的任务留给持有新租约的工作者处理
+func (w *Worker) fail(ctx context.Context, job *Job, cause error) error {
+	now := time.Now().UTC()
+	if job.Attempts >= w.config.MaxAttempts {
+		job.Status = StatusDead
+		job.FinishedAt = &now
+	} else {
+		job.Status = StatusPending
+		job.RunAt = now.Add(w.config.delay(job.Attempts))
+	}
+	job.LastError = cause.Error()
+	if err := w.db.WithContext(ctx).Model(&Job{}).Where("id = ? AND lease_token = ?", job.ID, job.LeaseToken).Updates(map[string]any{
+		"status":      job.Status,
+		"run_at":      job.RunAt,
+		"finished_at": job.FinishedAt,
+		"last_error":  job.LastError,
+		"lease_token": "",
+	}).Error; err != nil {
+		return erero.Wro(err)
+	}
+	job.LeaseToken = ""
+	return nil
+}
+
+// DeadJobs returns the dead jobs in enqueuing order
+//
+// DeadJobs 按入队顺序返回进入死信的任务
+func (w *Worker) DeadJobs(ctx context.Context) ([]*Job, error) {
+	var jobs []*Job
+	if err := w.db.WithContext(ctx).Where("status = ?", StatusDead).Order("id").Find(&jobs).Error; err != nil {
+		return nil, erero.Wro(err)
+	}
+	return jobs, nil
+}
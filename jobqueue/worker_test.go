@@ -0,0 +1,282 @@
+package jobqueue_test
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/orzkratos/gormkratos"
+	"github.com/orzkratos/gormkratos/gormkratostest"
+	"github.com/orzkratos/gormkratos/internal/errorspb"
+	"github.com/orzkratos/gormkratos/jobqueue"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/erero"
+	"gorm.io/gorm"
+)
+
+// shipOrder is the handler marking the order of the payload shipped
+// shipOrder 是将 payload 中的订单标记为已发货的处理函数
+func shipOrder(db *gorm.DB, job *jobqueue.Job) *errors.Error {
+	id, err := strconv.Atoi(string(job.Payload))
+	if err != nil {
+		return errorspb.ErrorBadRequest("invalid payload %s", job.Payload)
+	}
+	if err := db.Model(&Order{}).Where("id = ?", id).Update("status", "shipped").Error; err != nil {
+		return gormkratos.TranslateDbError(err)
+	}
+	return nil
+}
+
+// loadJob loads the job by ID
+// loadJob 按 ID 加载任务
+func loadJob(t *testing.T, db *gorm.DB, id uint64) *jobqueue.Job {
+	var job jobqueue.Job
+	require.NoError(t, db.First(&job, id).Error)
+	return &job
+}
+
+// TestWorkOnce tests due jobs run and commit together with the changes of the handler
+// TestWorkOnce 测试到期任务被执行, 并与处理函数的修改一起提交
+func TestWorkOnce(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.Create(&Order{Status: "paid"}).Error)
+	enqueue(t, db, "order.ship", time.Time{}, "1")
+	enqueue(t, db, "order.ship", time.Now().Add(time.Hour), "2")
+
+	worker := jobqueue.NewWorker(db, jobqueue.NewWorkerConfig()).
+		Handle("order.ship", shipOrder)
+
+	done, err := worker.WorkOnce(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, done)
+
+	var order Order
+	require.NoError(t, db.First(&order).Error)
+	require.Equal(t, "shipped", order.Status)
+
+	job := loadJob(t, db, 1)
+	require.Equal(t, jobqueue.StatusDone, job.Status)
+	require.Equal(t, 1, job.Attempts)
+	require.NotNil(t, job.FinishedAt)
+	require.Empty(t, job.LeaseToken)
+
+	// Done jobs and jobs not yet due do not run
+	// 已完成和尚未到期的任务不会执行
+	done, err = worker.WorkOnce(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 0, done)
+	require.Equal(t, jobqueue.StatusPending, loadJob(t, db, 2).Status)
+}
+
+// TestWorkOnceRetry tests failed jobs roll back and run again after the backoff delay
+// TestWorkOnceRetry 测试失败的任务回滚, 并在退避等待后再次执行
+func TestWorkOnceRetry(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.Create(&Order{Status: "paid"}).Error)
+	enqueue(t, db, "order.ship", time.Time{}, "1")
+
+	var runs int
+	worker := jobqueue.NewWorker(db, jobqueue.NewWorkerConfig().WithBackoff(50*time.Millisecond, time.Second)).
+		Handle("order.ship", func(db *gorm.DB, job *jobqueue.Job) *errors.Error {
+			runs++
+			if erk := shipOrder(db, job); erk != nil {
+				return erk
+			}
+			if runs == 1 {
+				return errorspb.ErrorUnknown("carrier unavailable")
+			}
+			return nil
+		})
+
+	done, err := worker.WorkOnce(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 0, done)
+
+	job := loadJob(t, db, 1)
+	require.Equal(t, jobqueue.StatusPending, job.Status)
+	require.Equal(t, 1, job.Attempts)
+	require.Contains(t, job.LastError, "carrier unavailable")
+	var order Order
+	require.NoError(t, db.First(&order).Error)
+	require.Equal(t, "paid", order.Status)
+
+	// Not due before the backoff delay
+	// 退避等待结束前不会到期
+	done, err = worker.WorkOnce(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 0, done)
+
+	time.Sleep(100 * time.Millisecond)
+	done, err = worker.WorkOnce(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, done)
+	require.Equal(t, 2, runs)
+	require.NoError(t, db.First(&order).Error)
+	require.Equal(t, "shipped", order.Status)
+}
+
+// TestWorkOnceDead tests jobs exhausting attempts and jobs without handlers become dead
+// TestWorkOnceDead 测试耗尽尝试次数的任务和没有处理函数的任务进入死信
+func TestWorkOnceDead(t *testing.T) {
+	db := setupTestDB(t)
+	enqueue(t, db, "order.ship", time.Time{}, "poison")
+	enqueue(t, db, "order.unknown", time.Time{}, "1")
+
+	worker := jobqueue.NewWorker(db, jobqueue.NewWorkerConfig().WithMaxAttempts(2).WithBackoff(0, 0)).
+		Handle("order.ship", shipOrder)
+
+	for range 3 {
+		done, err := worker.WorkOnce(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, 0, done)
+	}
+
+	deadJobs, err := worker.DeadJobs(context.Background())
+	require.NoError(t, err)
+	require.Len(t, deadJobs, 2)
+	require.Equal(t, "poison", string(deadJobs[0].Payload))
+	require.Equal(t, 2, deadJobs[0].Attempts)
+	require.Contains(t, deadJobs[0].LastError, "invalid payload")
+	require.Contains(t, deadJobs[1].LastError, "no handler of job kind order.unknown")
+	require.NotNil(t, deadJobs[1].FinishedAt)
+}
+
+// TestWorkOnceLeaseExpired tests running jobs with expired leases are claimed again, the last attempt becomes dead
+// TestWorkOnceLeaseExpired 测试租约过期的执行中任务被再次认领, 最后一次尝试的任务进入死信
+func TestWorkOnceLeaseExpired(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.Create(&Order{Status: "paid"}).Error)
+	enqueue(t, db, "order.ship", time.Time{}, "1", "1")
+
+	// Jobs claimed by crashed workers, the second on its last attempt
+	// 被已崩溃的工作者认领的任务, 第二个处于最后一次尝试
+	expired := time.Now().UTC().Add(-time.Second)
+	require.NoError(t, db.Model(&jobqueue.Job{}).Where("id = ?", 1).Updates(map[string]any{"status": jobqueue.StatusRunning, "run_at": expired, "lease_token": "crashed", "attempts": 1}).Error)
+	require.NoError(t, db.Model(&jobqueue.Job{}).Where("id = ?", 2).Updates(map[string]any{"status": jobqueue.StatusRunning, "run_at": expired, "lease_token": "crashed", "attempts": 3}).Error)
+
+	worker := jobqueue.NewWorker(db, jobqueue.NewWorkerConfig().WithMaxAttempts(3)).Handle("order.ship", shipOrder)
+	done, err := worker.WorkOnce(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, done)
+
+	job := loadJob(t, db, 1)
+	require.Equal(t, jobqueue.StatusDone, job.Status)
+	require.Equal(t, 2, job.Attempts)
+
+	job = loadJob(t, db, 2)
+	require.Equal(t, jobqueue.StatusDead, job.Status)
+	require.Contains(t, job.LastError, "expired on the last attempt")
+}
+
+// TestWorkOncePanic tests panics of handlers become failed attempts and the batch goes on
+// TestWorkOncePanic 测试处理函数的 panic 成为失败的尝试, 且该批次继续执行
+func TestWorkOncePanic(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.Create(&Order{Status: "paid"}).Error)
+	enqueue(t, db, "order.panic", time.Time{}, "1")
+	enqueue(t, db, "order.ship", time.Time{}, "1")
+
+	worker := jobqueue.NewWorker(db, jobqueue.NewWorkerConfig()).
+		Handle("order.panic", func(db *gorm.DB, job *jobqueue.Job) *errors.Error {
+			panic("handler crashed")
+		}).
+		Handle("order.ship", shipOrder)
+
+	done, err := worker.WorkOnce(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, done)
+
+	job := loadJob(t, db, 1)
+	require.Equal(t, jobqueue.StatusPending, job.Status)
+	require.Contains(t, job.LastError, "handler crashed")
+	require.Equal(t, jobqueue.StatusDone, loadJob(t, db, 2).Status)
+}
+
+// TestWorkOnceLeaseDeadline tests handlers stop at the end of the lease taken at claim time
+// TestWorkOnceLeaseDeadline 测试处理函数在认领时获得的租约结束时停止
+func TestWorkOnceLeaseDeadline(t *testing.T) {
+	db := setupTestDB(t)
+	enqueue(t, db, "order.wait", time.Time{}, "1", "2")
+
+	var deadlines []time.Time
+	worker := jobqueue.NewWorker(db, jobqueue.NewWorkerConfig().WithLeaseTimeout(time.Second)).
+		Handle("order.wait", func(db *gorm.DB, job *jobqueue.Job) *errors.Error {
+			deadline, ok := db.Statement.Context.Deadline()
+			require.True(t, ok)
+			require.True(t, deadline.Equal(job.RunAt))
+			deadlines = append(deadlines, deadline)
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		})
+
+	done, err := worker.WorkOnce(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 2, done)
+	require.Len(t, deadlines, 2)
+	require.True(t, deadlines[1].Equal(deadlines[0])) // One lease for the batch // 整个批次共用一个租约
+}
+
+// TestWorkOnceBatchError tests failing to record one outcome still runs the rest of the batch
+// TestWorkOnceBatchError 测试记录某个结果失败时仍执行该批次的其余任务
+func TestWorkOnceBatchError(t *testing.T) {
+	db, faults := gormkratostest.NewFaultDB(t, &Order{})
+	require.NoError(t, jobqueue.Migrate(db))
+	require.NoError(t, db.Create(&Order{Status: "paid"}).Error)
+	enqueue(t, db, "order.ship", time.Time{}, "poison", "1")
+
+	cause := erero.New("disk full")
+	faults.FailStatement("last_error", cause)
+
+	worker := jobqueue.NewWorker(db, jobqueue.NewWorkerConfig()).Handle("order.ship", shipOrder)
+	done, err := worker.WorkOnce(context.Background())
+	require.ErrorIs(t, err, cause)
+	require.Equal(t, 1, done)
+	require.Equal(t, jobqueue.StatusDone, loadJob(t, db, 2).Status)
+}
+
+// TestWorkerRun tests the workers run each job once with both claim strategies
+// TestWorkerRun 测试工作者在两种认领方式下都只执行每个任务一次
+func TestWorkerRun(t *testing.T) {
+	for _, strategy := range []jobqueue.ClaimStrategy{jobqueue.ClaimConditional, jobqueue.ClaimSkipLocked} {
+		t.Run(string(strategy), func(t *testing.T) {
+			db := setupTestDB(t)
+
+			var mutex sync.Mutex
+			runs := map[string]int{}
+			config := jobqueue.NewWorkerConfig().WithConcurrency(3).WithBatchSize(2).WithPollInterval(10 * time.Millisecond).WithClaimStrategy(strategy)
+			worker := jobqueue.NewWorker(db, config).Handle("order.ship", func(db *gorm.DB, job *jobqueue.Job) *errors.Error {
+				mutex.Lock()
+				defer mutex.Unlock()
+				runs[string(job.Payload)]++
+				return nil
+			})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error, 1)
+			go func() {
+				done <- worker.Run(ctx)
+			}()
+
+			payloads := []string{"1", "2", "3", "4", "5", "6", "7", "8"}
+			enqueue(t, db, "order.ship", time.Time{}, payloads...)
+			require.Eventually(t, func() bool {
+				var count int64
+				require.NoError(t, db.Model(&jobqueue.Job{}).Where("status = ?", jobqueue.StatusDone).Count(&count).Error)
+				return count == int64(len(payloads))
+			}, 5*time.Second, 10*time.Millisecond)
+
+			cancel()
+			require.ErrorIs(t, <-done, context.Canceled)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			require.Len(t, runs, len(payloads))
+			for _, payload := range payloads {
+				require.Equal(t, 1, runs[payload])
+			}
+		})
+	}
+}
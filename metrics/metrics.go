@@ -0,0 +1,118 @@
+// Package metrics: transaction metrics of gormkratos transactions
+// Records the duration and outcome of each transaction through a pluggable Collector, registered on the database as GORM plugin
+//
+// metrics: gormkratos 事务的指标
+// 通过可替换的 Collector 记录每个事务的耗时和结果, 以 GORM 插件方式注册到数据库上
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/orzkratos/gormkratos"
+	"gorm.io/gorm"
+)
+
+// PluginName is the GORM plugin name of the metrics plugin
+// PluginName 是指标插件的 GORM 插件名
+const PluginName = "gormkratos:metrics"
+
+// Record describes one finished transaction
+//
+// Record 描述一个已结束的事务
+type Record struct {
+	Name     string               // Transaction name set with gormkratos.WithTxName // 通过 gormkratos.WithTxName 设置的事务名称
+	Outcome  gormkratos.TxOutcome // Transaction outcome // 事务结果
+	Reason   string               // Reason of the business error, empty when no business error // 业务错误的原因, 没有业务错误时为空
+	Depth    int                  // Nesting depth, above 0 means savepoint // 嵌套深度, 大于 0 表示保存点
+	Attempt  int                  // Attempt number, above 1 when retried // 尝试次数, 重试时大于 1
+	Duration time.Duration        // Time from begin to commit or rollback // 从开启到提交或回滚的耗时
+}
+
+// Collector collects records of finished transactions
+//
+// Collector 收集已结束事务的记录
+type Collector interface {
+	Observe(record *Record)
+}
+
+// NoopCollector drops all records, the default collector
+//
+// NoopCollector 丢弃所有记录, 是默认的收集器
+type NoopCollector struct{}
+
+var _ Collector = NoopCollector{}
+
+// Observe does nothing
+// Observe 不做任何事
+func (NoopCollector) Observe(record *Record) {}
+
+// Config configures the metrics plugin
+//
+// Config 配置指标插件
+type Config struct {
+	Collector Collector // Collector of transaction records, default is NoopCollector // 事务记录的收集器, 默认为 NoopCollector
+}
+
+// NewConfig creates metrics config using NoopCollector
+//
+// NewConfig 创建使用 NoopCollector 的指标配置
+func NewConfig() *Config {
+	return &Config{Collector: NoopCollector{}}
+}
+
+// WithCollector sets the collector
+// WithCollector 设置收集器
+func (c *Config) WithCollector(collector Collector) *Config {
+	c.Collector = collector
+	return c
+}
+
+// Plugin measures transactions, register it with db.Use(metrics.NewPlugin(config))
+//
+// Plugin 度量事务, 通过 db.Use(metrics.NewPlugin(config)) 注册
+type Plugin struct {
+	collector Collector
+}
+
+var _ gormkratos.TxObserver = &Plugin{}
+
+// NewPlugin creates metrics plugin
+//
+// NewPlugin 创建指标插件
+func NewPlugin(config *Config) *Plugin {
+	return &Plugin{collector: config.Collector}
+}
+
+// Name returns the GORM plugin name
+// Name 返回 GORM 插件名
+func (p *Plugin) Name() string {
+	return PluginName
+}
+
+// Initialize does nothing, the plugin only observes gormkratos transactions
+// Initialize 不做任何事, 该插件只观察 gormkratos 事务
+func (p *Plugin) Initialize(db *gorm.DB) error {
+	return nil
+}
+
+// ObserveTx starts timing the transaction and returns the function collecting the record
+//
+// ObserveTx 开始为事务计时, 并返回收集记录的函数
+func (p *Plugin) ObserveTx(ctx context.Context, info *gormkratos.TxInfo) (context.Context, func(erk *errors.Error, err error)) {
+	startTime := time.Now()
+	return ctx, func(erk *errors.Error, err error) {
+		record := &Record{
+			Name:     info.Name,
+			Outcome:  gormkratos.ClassifyTxOutcome(ctx, erk, err),
+			Depth:    info.Depth,
+			Attempt:  info.Attempt,
+			Duration: time.Since(startTime),
+		}
+		if erk != nil {
+			record.Reason = erk.Reason
+		}
+		p.collector.Observe(record)
+	}
+}
@@ -0,0 +1,127 @@
+package metrics_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/google/uuid"
+	"github.com/orzkratos/gormkratos"
+	"github.com/orzkratos/gormkratos/internal/errorspb"
+	"github.com/orzkratos/gormkratos/metrics"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/rese"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// recordCollector keeps records in memory
+// recordCollector 在内存中保存记录
+type recordCollector struct {
+	mutex   sync.Mutex
+	records []*metrics.Record
+}
+
+func (c *recordCollector) Observe(record *metrics.Record) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.records = append(c.records, record)
+}
+
+// setupMeasuredDB creates isolated in-memory SQLite database with the metrics plugin using the collector
+// setupMeasuredDB 创建使用该收集器的指标插件的独立内存 SQLite 数据库
+func setupMeasuredDB(t *testing.T, collector metrics.Collector) *gorm.DB {
+	dsn := fmt.Sprintf("file:db-%s?mode=memory&cache=shared", uuid.New().String())
+	db := rese.P1(gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Info),
+	}))
+	t.Cleanup(func() {
+		must.Done(rese.P1(db.DB()).Close())
+	})
+	require.NoError(t, db.Use(metrics.NewPlugin(metrics.NewConfig().WithCollector(collector))))
+	return db
+}
+
+// TestPluginRecords tests each transaction is recorded with name, outcome and reason
+// TestPluginRecords 测试每个事务都以名称, 结果和原因记录
+func TestPluginRecords(t *testing.T) {
+	collector := &recordCollector{}
+	db := setupMeasuredDB(t, collector)
+	ctx := gormkratos.WithTxName(context.Background(), "create-order")
+
+	_, err := gormkratos.Transaction(ctx, db, func(db *gorm.DB) *errors.Error {
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+	require.NoError(t, err)
+
+	erk, err := gormkratos.Transaction(ctx, db, func(db *gorm.DB) *errors.Error {
+		return errorspb.ErrorBadRequest("validation failed")
+	})
+	require.Error(t, err)
+	require.True(t, errorspb.IsBadRequest(erk))
+
+	require.Len(t, collector.records, 2)
+	require.Equal(t, "create-order", collector.records[0].Name)
+	require.Equal(t, gormkratos.TxOutcomeCommitted, collector.records[0].Outcome)
+	require.Empty(t, collector.records[0].Reason)
+	require.GreaterOrEqual(t, collector.records[0].Duration, 10*time.Millisecond)
+	require.Equal(t, 1, collector.records[0].Attempt)
+
+	require.Equal(t, gormkratos.TxOutcomeBusinessRollback, collector.records[1].Outcome)
+	require.Equal(t, "BAD_REQUEST", collector.records[1].Reason)
+}
+
+// TestPluginCanceled tests canceled transactions are told apart from database errors
+// TestPluginCanceled 测试取消的事务与数据库错误区分开
+func TestPluginCanceled(t *testing.T) {
+	collector := &recordCollector{}
+	db := setupMeasuredDB(t, collector)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := gormkratos.Transaction(ctx, db, func(db *gorm.DB) *errors.Error {
+		time.Sleep(100 * time.Millisecond) // Exceed timeout // 超过超时时间
+		return nil
+	})
+	require.Error(t, err)
+
+	require.Len(t, collector.records, 1)
+	require.Equal(t, gormkratos.TxOutcomeCanceled, collector.records[0].Outcome)
+	require.Empty(t, collector.records[0].Name)
+}
+
+// TestPluginHookPanic tests a panicking commit hook leaves the committed record alone
+// TestPluginHookPanic 测试提交钩子 panic 时不会改变已提交的记录
+func TestPluginHookPanic(t *testing.T) {
+	collector := &recordCollector{}
+	db := setupMeasuredDB(t, collector)
+
+	require.PanicsWithValue(t, "hook failed", func() {
+		_, _ = gormkratos.Transaction(context.Background(), db, func(db *gorm.DB) *errors.Error {
+			gormkratos.AfterCommit(db.Statement.Context, func(ctx context.Context) {
+				panic("hook failed")
+			})
+			return nil
+		})
+	})
+
+	require.Len(t, collector.records, 1)
+	require.Equal(t, gormkratos.TxOutcomeCommitted, collector.records[0].Outcome)
+}
+
+// TestNoopCollector tests the default config drops records
+// TestNoopCollector 测试默认配置丢弃记录
+func TestNoopCollector(t *testing.T) {
+	db := setupMeasuredDB(t, metrics.NewConfig().Collector)
+
+	_, err := gormkratos.Transaction(context.Background(), db, func(db *gorm.DB) *errors.Error {
+		return nil
+	})
+	require.NoError(t, err)
+}
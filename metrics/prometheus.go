@@ -0,0 +1,139 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Prometheus metric label names
+// Prometheus 指标的标签名
+const (
+	LabelName    = "name"    // Transaction name // 事务名称
+	LabelOutcome = "outcome" // Transaction outcome // 事务结果
+	LabelReason  = "reason"  // Reason of the business error // 业务错误的原因
+	LabelKind    = "kind"    // Kind of the transaction, see the Kind constants // 事务的种类, 参见 Kind 常量
+)
+
+// Values of the kind label
+// kind 标签的取值
+const (
+	KindTransaction = "transaction" // First attempt of outermost transaction // 最外层事务的首次尝试
+	KindRetry       = "retry"       // Later attempt of outermost transaction // 最外层事务的后续尝试
+	KindSavepoint   = "savepoint"   // Nested transaction run as savepoint // 以保存点方式执行的嵌套事务
+)
+
+// PrometheusConfig configures the Prometheus collector
+//
+// PrometheusConfig 配置 Prometheus 收集器
+type PrometheusConfig struct {
+	Namespace string    // Metric namespace, default "gormkratos" // 指标命名空间, 默认 "gormkratos"
+	Subsystem string    // Metric subsystem, default empty // 指标子系统, 默认为空
+	Buckets   []float64 // Duration histogram buckets in seconds // 耗时直方图的分桶, 单位秒
+}
+
+// NewPrometheusConfig creates Prometheus config with default buckets
+//
+// NewPrometheusConfig 创建使用默认分桶的 Prometheus 配置
+func NewPrometheusConfig() *PrometheusConfig {
+	return &PrometheusConfig{
+		Namespace: "gormkratos",
+		Buckets:   prometheus.DefBuckets,
+	}
+}
+
+// WithNamespace sets the metric namespace
+// WithNamespace 设置指标命名空间
+func (c *PrometheusConfig) WithNamespace(namespace string) *PrometheusConfig {
+	c.Namespace = namespace
+	return c
+}
+
+// WithSubsystem sets the metric subsystem
+// WithSubsystem 设置指标子系统
+func (c *PrometheusConfig) WithSubsystem(subsystem string) *PrometheusConfig {
+	c.Subsystem = subsystem
+	return c
+}
+
+// WithBuckets sets the duration histogram buckets in seconds
+// WithBuckets 设置耗时直方图的分桶, 单位秒
+func (c *PrometheusConfig) WithBuckets(buckets []float64) *PrometheusConfig {
+	c.Buckets = buckets
+	return c
+}
+
+// PrometheusCollector records transactions as Prometheus metrics
+// Register it with registry.MustRegister(collector) before use
+// Savepoints and retry attempts are counted apart from transactions with the kind label
+//
+// PrometheusCollector 将事务记录为 Prometheus 指标
+// 使用前通过 registry.MustRegister(collector) 注册
+// 保存点和重试通过 kind 标签与事务分开计数
+type PrometheusCollector struct {
+	transactions *prometheus.CounterVec
+	duration     *prometheus.HistogramVec
+}
+
+var _ Collector = &PrometheusCollector{}
+var _ prometheus.Collector = &PrometheusCollector{}
+
+// NewPrometheusCollector creates Prometheus collector with the config
+//
+// NewPrometheusCollector 使用配置创建 Prometheus 收集器
+func NewPrometheusCollector(config *PrometheusConfig) *PrometheusCollector {
+	labels := []string{LabelName, LabelOutcome, LabelReason, LabelKind}
+	return &PrometheusCollector{
+		transactions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: config.Namespace,
+			Subsystem: config.Subsystem,
+			Name:      "transactions_total",
+			Help:      "Count of finished transactions.",
+		}, labels),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: config.Namespace,
+			Subsystem: config.Subsystem,
+			Name:      "transaction_duration_seconds",
+			Help:      "Duration of transactions from begin to commit or rollback.",
+			Buckets:   config.Buckets,
+		}, labels),
+	}
+}
+
+// Observe records the transaction in the counter and the duration histogram
+// Observe 将事务记录到计数器和耗时直方图
+func (c *PrometheusCollector) Observe(record *Record) {
+	labels := prometheus.Labels{
+		LabelName:    record.Name,
+		LabelOutcome: string(record.Outcome),
+		LabelReason:  record.Reason,
+		LabelKind:    recordKind(record),
+	}
+	c.transactions.With(labels).Inc()
+	c.duration.With(labels).Observe(record.Duration.Seconds())
+}
+
+// recordKind returns the value of the kind label of the record
+// recordKind 返回记录的 kind 标签值
+func recordKind(record *Record) string {
+	switch {
+	case record.Depth > 0:
+		return KindSavepoint
+	case record.Attempt > 1:
+		return KindRetry
+	default:
+		return KindTransaction
+	}
+}
+
+// Describe implements prometheus.Collector
+// Describe 实现 prometheus.Collector
+func (c *PrometheusCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.transactions.Describe(ch)
+	c.duration.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+// Collect 实现 prometheus.Collector
+func (c *PrometheusCollector) Collect(ch chan<- prometheus.Metric) {
+	c.transactions.Collect(ch)
+	c.duration.Collect(ch)
+}
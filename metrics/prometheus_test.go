@@ -0,0 +1,92 @@
+package metrics_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/orzkratos/gormkratos"
+	"github.com/orzkratos/gormkratos/internal/errorspb"
+	"github.com/orzkratos/gormkratos/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// TestPrometheusCollector tests counters and histograms are labeled by name, outcome and reason
+// TestPrometheusCollector 测试计数器和直方图以名称, 结果和原因作为标签
+func TestPrometheusCollector(t *testing.T) {
+	collector := metrics.NewPrometheusCollector(metrics.NewPrometheusConfig().WithNamespace("demo"))
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(collector)
+
+	db := setupMeasuredDB(t, collector)
+	ctx := gormkratos.WithTxName(context.Background(), "create-order")
+
+	for range 2 {
+		_, err := gormkratos.Transaction(ctx, db, func(db *gorm.DB) *errors.Error {
+			return nil
+		})
+		require.NoError(t, err)
+	}
+	_, err := gormkratos.Transaction(ctx, db, func(db *gorm.DB) *errors.Error {
+		return errorspb.ErrorBadRequest("validation failed")
+	})
+	require.Error(t, err)
+
+	require.Equal(t, 2, testutil.CollectAndCount(collector, "demo_transactions_total"))
+	require.Equal(t, 2, testutil.CollectAndCount(collector, "demo_transaction_duration_seconds"))
+
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP demo_transactions_total Count of finished transactions.
+# TYPE demo_transactions_total counter
+demo_transactions_total{kind="transaction",name="create-order",outcome="business_rollback",reason="BAD_REQUEST"} 1
+demo_transactions_total{kind="transaction",name="create-order",outcome="committed",reason=""} 2
+`), "demo_transactions_total"))
+}
+
+// TestPrometheusCollectorKind tests savepoints and retry attempts are labeled apart from transactions
+// TestPrometheusCollectorKind 测试保存点和重试以不同的标签与事务区分
+func TestPrometheusCollectorKind(t *testing.T) {
+	collector := metrics.NewPrometheusCollector(metrics.NewPrometheusConfig().WithNamespace("demo"))
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(collector)
+
+	db := setupMeasuredDB(t, collector)
+	ctx := gormkratos.WithTxName(context.Background(), "create-order")
+
+	_, err := gormkratos.Transaction(ctx, db, func(db *gorm.DB) *errors.Error {
+		_, err := gormkratos.Transaction(db.Statement.Context, db, func(db *gorm.DB) *errors.Error {
+			return nil
+		})
+		require.NoError(t, err)
+		return nil
+	})
+	require.NoError(t, err)
+
+	// The first attempt rolls back with a retried business error, the second commits
+	// 第一次尝试因可重试的业务错误回滚, 第二次提交
+	var attempts int
+	retry := gormkratos.NewRetryConfig().WithBackoff(time.Millisecond, time.Millisecond, 1).WithRetryErk(func(erk *errors.Error) bool {
+		return errorspb.IsBadRequest(erk)
+	})
+	_, err = gormkratos.TransactionRetry(ctx, db, retry, func(db *gorm.DB) *errors.Error {
+		if attempts++; attempts == 1 {
+			return errorspb.ErrorBadRequest("stale version")
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP demo_transactions_total Count of finished transactions.
+# TYPE demo_transactions_total counter
+demo_transactions_total{kind="retry",name="create-order",outcome="committed",reason=""} 1
+demo_transactions_total{kind="savepoint",name="create-order",outcome="committed",reason=""} 1
+demo_transactions_total{kind="transaction",name="create-order",outcome="business_rollback",reason="BAD_REQUEST"} 1
+demo_transactions_total{kind="transaction",name="create-order",outcome="committed",reason=""} 1
+`), "demo_transactions_total"))
+}
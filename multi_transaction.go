@@ -0,0 +1,239 @@
+package gormkratos
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/orzkratos/gormkratos/api/dberrors/v1"
+	"github.com/yyle88/erero"
+	"gorm.io/gorm"
+)
+
+// NamedDB is one database of MultiTransaction with the name reported in errors
+//
+// NamedDB 是 MultiTransaction 中的一个数据库, 名称用于错误报告
+type NamedDB struct {
+	Name string   // Name of the database, such as core or ledger // 数据库名称, 例如 core 或 ledger
+	DB   *gorm.DB // Database handle // 数据库句柄
+}
+
+// Named creates named database of MultiTransaction
+// Named 创建 MultiTransaction 的命名数据库
+func Named(name string, db *gorm.DB) *NamedDB {
+	return &NamedDB{Name: name, DB: db}
+}
+
+// PartialCommitError means some databases of MultiTransaction committed and the rest did not
+// Committed databases keep their changes, reconcile them instead of running the transaction again
+//
+// PartialCommitError 表示 MultiTransaction 中部分数据库已提交, 其余未提交
+// 已提交的数据库保留了修改, 应核对数据而不是重新执行事务
+type PartialCommitError struct {
+	Committed  []string // Databases committed, in commit order // 已提交的数据库, 按提交顺序
+	Failed     string   // Database whose COMMIT failed, its outcome may be unknown, see CommitError // COMMIT 失败的数据库, 结果可能未知, 参见 CommitError
+	RolledBack []string // Databases rolled back after the failure // 失败后回滚的数据库
+	Err        error    // Error of the failed COMMIT, a CommitError // 失败的 COMMIT 的错误, 是 CommitError
+}
+
+// Error returns the error message
+// Error 返回错误消息
+func (e *PartialCommitError) Error() string {
+	return fmt.Sprintf("partial commit: committed [%s], %s: %v, rolled back [%s]",
+		strings.Join(e.Committed, ", "), e.Failed, e.Err, strings.Join(e.RolledBack, ", "))
+}
+
+// Unwrap returns the error of the failed COMMIT
+// Unwrap 返回失败的 COMMIT 的错误
+func (e *PartialCommitError) Unwrap() error {
+	return e.Err
+}
+
+// IsPartialCommit checks whether err means some databases of MultiTransaction committed
+//
+// IsPartialCommit 检查 err 是否表示 MultiTransaction 中部分数据库已提交
+func IsPartialCommit(err error) bool {
+	var partialErr *PartialCommitError
+	return erero.As(err, &partialErr)
+}
+
+// newPartialCommitErk returns SERVER_DB_PARTIAL_COMMIT with the committed, failed and rolled back databases in metadata
+// newPartialCommitErk 返回 SERVER_DB_PARTIAL_COMMIT, 元数据中包含已提交, 失败和已回滚的数据库
+func newPartialCommitErk(format string, err error) *errors.Error {
+	erk := dberrors.ErrorServerDbPartialCommit(format, err)
+	var partialErr *PartialCommitError
+	if erero.As(err, &partialErr) {
+		erk = erk.WithMetadata(map[string]string{
+			"committed":   strings.Join(partialErr.Committed, ","),
+			"failed":      partialErr.Failed,
+			"rolled_back": strings.Join(partialErr.RolledBack, ","),
+		})
+	}
+	return erk
+}
+
+// MultiTransaction executes a function in transactions on several databases, best-effort two-phase
+// Begins the transactions in order, runs run with the tx of each name, then commits them in order
+// Returns the same two errors as Transaction:
+// - erk != nil: run returned erk, all transactions rolled back
+// - erk == nil, err != nil: a database failed, when the first COMMIT fails nothing committed and err is CommitError
+// - a later COMMIT failing rolls back the rest and returns PartialCommitError naming the committed databases
+// Put the database most likely to fail COMMIT first, commit markers of CommitMarkerPlugin resolve broken connections
+// Hooks registered with AfterCommit run once all committed, AfterRollback hooks run on rollback and partial commit
+// Neither runs when the outcome of the failed COMMIT is unknown, see IsCommitOutcomeUnknown
+// Observers registered on each database, such as tracing and metrics, see the outcome of the whole transaction
+// The databases must not be in transaction already
+//
+// MultiTransaction 在多个数据库的事务中执行函数, 尽力而为的两阶段提交
+// 按顺序开启事务, 使用各名称对应的 tx 执行 run, 然后按顺序提交
+// 返回与 Transaction 相同的两个错误:
+// - erk != nil: run 返回了 erk, 所有事务已回滚
+// - erk == nil, err != nil: 数据库故障, 第一个 COMMIT 失败时没有任何提交, err 是 CommitError
+// - 之后的 COMMIT 失败时回滚其余事务, 返回列出已提交数据库的 PartialCommitError
+// 将最可能提交失败的数据库放在最前, CommitMarkerPlugin 的提交标记可以解析连接断开的情况
+// AfterCommit 注册的钩子在全部提交后执行, AfterRollback 注册的钩子在回滚和部分提交时执行
+// 失败的 COMMIT 结果未知时两者都不执行, 参见 IsCommitOutcomeUnknown
+// 每个数据库上注册的观察者, 例如链路追踪和指标, 得到整个事务的结果
+// 这些数据库不能已经处于事务中
+func MultiTransaction(
+	ctx context.Context,
+	dbs []*NamedDB,
+	run func(txs map[string]*gorm.DB) *errors.Error,
+	options ...*sql.TxOptions,
+) (erk *errors.Error, err error) {
+	if len(dbs) == 0 {
+		return nil, erero.New("no databases to run transaction")
+	}
+	names := map[string]bool{}
+	for _, item := range dbs {
+		if names[item.Name] {
+			return nil, erero.Errorf("database %s appears twice", item.Name)
+		}
+		if _, nested := item.DB.Statement.ConnPool.(gorm.TxCommitter); nested {
+			return nil, erero.Errorf("database %s is already in transaction", item.Name)
+		}
+		names[item.Name] = true
+	}
+
+	// Notify observers registered on each database, all finish with the outcome of the whole transaction
+	// 通知每个数据库上注册的观察者, 全部以整个事务的结果结束
+	txCtxs := make([]context.Context, len(dbs))
+	finishes := make([]func(erk *errors.Error, err error), len(dbs))
+	for idx, item := range dbs {
+		txCtxs[idx], finishes[idx] = observeTx(ctx, item.DB, &TxInfo{
+			Name:    TxNameFromContext(ctx),
+			Options: firstTxOptions(options),
+			Attempt: attemptFromContext(ctx),
+		})
+	}
+	finish := func(erk *errors.Error, err error) {
+		for _, finishOne := range finishes {
+			finishOne(erk, err)
+		}
+	}
+
+	hooks := &txHooks{}
+	txs := make(map[string]*gorm.DB, len(dbs))
+	begun := make([]*gorm.DB, 0, len(dbs))
+	rollback := func(from int) []string {
+		var rolledBack []string
+		for idx := from; idx < len(begun); idx++ {
+			begun[idx].Rollback()
+			rolledBack = append(rolledBack, dbs[idx].Name)
+		}
+		return rolledBack
+	}
+	defer func() {
+		if value := recover(); value != nil {
+			rollback(0)
+			err := erero.Errorf("transaction panic: %v", value)
+			finish(nil, err)
+			hooks.rolledBack(ctx, nil, err)
+			panic(value)
+		}
+	}()
+
+	for idx, item := range dbs {
+		tx := item.DB.WithContext(hooks.bind(txCtxs[idx])).Begin(options...)
+		if tx.Error != nil {
+			rollback(0)
+			err = erero.Wro(erero.Join(erero.Errorf("begin %s failed", item.Name), tx.Error))
+			finish(nil, err)
+			hooks.rolledBack(ctx, nil, err)
+			return nil, err
+		}
+		txs[item.Name] = tx
+		begun = append(begun, tx)
+	}
+
+	if erk = run(txs); erk != nil {
+		// Business error, roll back all
+		// 业务错误, 全部回滚
+		rollback(0)
+		err = erero.Wro(erk)
+		finish(erk, err)
+		hooks.rolledBack(ctx, erk, err)
+		return erk, err
+	}
+
+	// Write commit markers when registered, read-only transactions write nothing
+	// 注册了提交标记插件时写入提交标记, 只读事务不写入
+	markers := make([]*CommitMarkerPlugin, len(begun))
+	markerIDs := make([]string, len(begun))
+	if option := firstTxOptions(options); option == nil || !option.ReadOnly {
+		for idx, tx := range begun {
+			if markers[idx] = commitMarkerOf(tx); markers[idx] != nil {
+				if markerIDs[idx], err = markers[idx].mark(tx); err != nil {
+					rollback(0)
+					err = erero.Wro(err)
+					finish(nil, err)
+					hooks.rolledBack(ctx, nil, err)
+					return nil, err
+				}
+			}
+		}
+	}
+
+	var committed []string
+	for idx, tx := range begun {
+		commitErr := tx.Commit().Error
+		if commitErr != nil {
+			commitErr = newCommitError(ctx, dbs[idx].DB, markers[idx], markerIDs[idx], commitErr)
+		}
+		if commitErr == nil {
+			committed = append(committed, dbs[idx].Name)
+			continue
+		}
+		rolledBack := rollback(idx + 1)
+		if len(committed) == 0 {
+			err = erero.Wro(commitErr)
+		} else {
+			err = erero.Wro(&PartialCommitError{Committed: committed, Failed: dbs[idx].Name, RolledBack: rolledBack, Err: commitErr})
+		}
+		finish(nil, err)
+		hooks.rolledBack(ctx, nil, err)
+		return nil, err
+	}
+
+	finish(nil, nil)
+	hooks.committed(ctx)
+	return nil, nil
+}
+
+// MultiTransactionErk executes MultiTransaction and returns a single Kratos error
+// Business errors (erk) are returned as-is, database errors (err) are converted with the ErkTranslator
+// The default translator returns SERVER_DB_PARTIAL_COMMIT with the database names in metadata on partial commits
+//
+// MultiTransactionErk 执行 MultiTransaction 并返回单个 Kratos 错误
+// 业务错误 (erk) 原样返回, 数据库错误 (err) 通过 ErkTranslator 转换
+// 部分提交时默认转换函数返回 SERVER_DB_PARTIAL_COMMIT, 元数据中包含数据库名称
+func MultiTransactionErk(
+	ctx context.Context,
+	dbs []*NamedDB,
+	run func(txs map[string]*gorm.DB) *errors.Error,
+	options ...*sql.TxOptions,
+) *errors.Error {
+	return mergeErk(MultiTransaction(ctx, dbs, run, options...))
+}
@@ -0,0 +1,247 @@
+package gormkratos_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/orzkratos/gormkratos"
+	"github.com/orzkratos/gormkratos/api/dberrors/v1"
+	"github.com/orzkratos/gormkratos/gormkratostest"
+	"github.com/orzkratos/gormkratos/internal/errorspb"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/erero"
+	"gorm.io/gorm"
+)
+
+// createTransfers creates transfer in each transaction
+// createTransfers 在每个事务中创建转账
+func createTransfers(txs map[string]*gorm.DB) *errors.Error {
+	for _, tx := range txs {
+		if erk := createTransfer(tx); erk != nil {
+			return erk
+		}
+	}
+	return nil
+}
+
+// TestMultiTransaction tests all databases commit together
+// TestMultiTransaction 测试所有数据库一起提交
+func TestMultiTransaction(t *testing.T) {
+	core := gormkratostest.NewDB(t, &Transfer{})
+	ledger := gormkratostest.NewDB(t, &Transfer{})
+
+	var events []string
+	erk, err := gormkratos.MultiTransaction(context.Background(), []*gormkratos.NamedDB{
+		gormkratos.Named("core", core),
+		gormkratos.Named("ledger", ledger),
+	}, func(txs map[string]*gorm.DB) *errors.Error {
+		require.Len(t, txs, 2)
+		gormkratos.AfterCommit(txs["core"].Statement.Context, func(ctx context.Context) {
+			events = append(events, "commit")
+		})
+		return createTransfers(txs)
+	})
+	gormkratostest.RequireCommitted(t, erk, err)
+	require.Equal(t, int64(1), countTransfers(t, core))
+	require.Equal(t, int64(1), countTransfers(t, ledger))
+	require.Equal(t, []string{"commit"}, events)
+}
+
+// TestMultiTransactionBusinessRollback tests business errors roll back all databases
+// TestMultiTransactionBusinessRollback 测试业务错误回滚所有数据库
+func TestMultiTransactionBusinessRollback(t *testing.T) {
+	core := gormkratostest.NewDB(t, &Transfer{})
+	ledger := gormkratostest.NewDB(t, &Transfer{})
+
+	var events []string
+	erk, err := gormkratos.MultiTransaction(context.Background(), []*gormkratos.NamedDB{
+		gormkratos.Named("core", core),
+		gormkratos.Named("ledger", ledger),
+	}, func(txs map[string]*gorm.DB) *errors.Error {
+		gormkratos.AfterRollback(txs["ledger"].Statement.Context, func(ctx context.Context, erk *errors.Error, err error) {
+			events = append(events, "rollback")
+		})
+		if erk := createTransfers(txs); erk != nil {
+			return erk
+		}
+		return errorspb.ErrorBadRequest("insufficient balance")
+	})
+	gormkratostest.RequireRolledBack(t, erk, err)
+	require.True(t, errorspb.IsBadRequest(erk))
+	require.Equal(t, int64(0), countTransfers(t, core))
+	require.Equal(t, int64(0), countTransfers(t, ledger))
+	require.Equal(t, []string{"rollback"}, events)
+}
+
+// TestMultiTransactionPartialCommit tests a later COMMIT failing reports the committed databases
+// TestMultiTransactionPartialCommit 测试之后的 COMMIT 失败时报告已提交的数据库
+func TestMultiTransactionPartialCommit(t *testing.T) {
+	core := gormkratostest.NewDB(t, &Transfer{})
+	ledger, faults := gormkratostest.NewFaultDB(t, &Transfer{})
+	audit := gormkratostest.NewDB(t, &Transfer{})
+	cause := erero.New("constraint check failed on commit")
+	faults.FailCommit(cause)
+
+	var events []string
+	erk, err := gormkratos.MultiTransaction(context.Background(), []*gormkratos.NamedDB{
+		gormkratos.Named("core", core),
+		gormkratos.Named("ledger", ledger),
+		gormkratos.Named("audit", audit),
+	}, func(txs map[string]*gorm.DB) *errors.Error {
+		gormkratos.AfterCommit(txs["core"].Statement.Context, func(ctx context.Context) {
+			events = append(events, "commit")
+		})
+		gormkratos.AfterRollback(txs["core"].Statement.Context, func(ctx context.Context, erk *errors.Error, err error) {
+			require.True(t, gormkratos.IsPartialCommit(err))
+			events = append(events, "rollback")
+		})
+		return createTransfers(txs)
+	})
+	require.Nil(t, erk)
+	require.Error(t, err)
+	require.ErrorIs(t, err, cause)
+	require.True(t, gormkratos.IsPartialCommit(err))
+	require.Equal(t, []string{"rollback"}, events)
+
+	var partialErr *gormkratos.PartialCommitError
+	require.ErrorAs(t, err, &partialErr)
+	require.Equal(t, []string{"core"}, partialErr.Committed)
+	require.Equal(t, "ledger", partialErr.Failed)
+	require.Equal(t, []string{"audit"}, partialErr.RolledBack)
+	require.Equal(t, int64(1), countTransfers(t, core))
+	require.Equal(t, int64(0), countTransfers(t, ledger))
+	require.Equal(t, int64(0), countTransfers(t, audit))
+
+	require.Equal(t, gormkratos.DbErrorPartialCommit, gormkratos.ClassifyDbError(err))
+	translated := gormkratos.TranslateDbError(err)
+	require.True(t, dberrors.IsServerDbPartialCommit(translated))
+	require.Equal(t, "core", translated.Metadata["committed"])
+	require.Equal(t, "ledger", translated.Metadata["failed"])
+	require.Equal(t, "audit", translated.Metadata["rolled_back"])
+	require.True(t, dberrors.IsServerDbPartialCommit(gormkratos.GetErkTranslator()(err)))
+}
+
+// TestMultiTransactionErkPartialCommit tests the single Kratos error of a partial commit names the databases
+// TestMultiTransactionErkPartialCommit 测试部分提交的单个 Kratos 错误列出数据库
+func TestMultiTransactionErkPartialCommit(t *testing.T) {
+	core := gormkratostest.NewDB(t, &Transfer{})
+	ledger, faults := gormkratostest.NewFaultDB(t, &Transfer{})
+	faults.FailCommit(driver.ErrBadConn)
+
+	erk := gormkratos.MultiTransactionErk(context.Background(), []*gormkratos.NamedDB{
+		gormkratos.Named("core", core),
+		gormkratos.Named("ledger", ledger),
+	}, createTransfers)
+	require.True(t, dberrors.IsServerDbPartialCommit(erk))
+	require.Equal(t, "core", erk.Metadata["committed"])
+	require.Equal(t, "ledger", erk.Metadata["failed"])
+	require.Equal(t, "", erk.Metadata["rolled_back"])
+	require.Equal(t, int64(1), countTransfers(t, core))
+}
+
+// TestMultiTransactionFirstCommitFails tests the first COMMIT failing commits nothing and is no partial commit
+// TestMultiTransactionFirstCommitFails 测试第一个 COMMIT 失败时没有任何提交且不是部分提交
+func TestMultiTransactionFirstCommitFails(t *testing.T) {
+	core, faults := gormkratostest.NewFaultDB(t, &Transfer{})
+	ledger := gormkratostest.NewDB(t, &Transfer{})
+	faults.FailCommit(driver.ErrBadConn)
+
+	erk, err := gormkratos.MultiTransaction(context.Background(), []*gormkratos.NamedDB{
+		gormkratos.Named("core", core),
+		gormkratos.Named("ledger", ledger),
+	}, createTransfers)
+	gormkratostest.RequireRolledBack(t, erk, err)
+	require.Nil(t, erk)
+	require.False(t, gormkratos.IsPartialCommit(err))
+	require.True(t, gormkratos.IsCommitOutcomeUnknown(err))
+	require.Equal(t, int64(0), countTransfers(t, ledger))
+}
+
+// outcomeObserver records the outcome of each observed transaction with its database name
+// outcomeObserver 记录每个被观察事务的结果及其数据库名称
+type outcomeObserver struct {
+	name     string
+	outcomes *[]string
+}
+
+// Name returns the plugin name
+// Name 返回插件名称
+func (o *outcomeObserver) Name() string {
+	return "test:outcome"
+}
+
+// Initialize does nothing
+// Initialize 不做任何事
+func (o *outcomeObserver) Initialize(db *gorm.DB) error {
+	return nil
+}
+
+// ObserveTx records the outcome once the transaction finishes
+// ObserveTx 在事务结束时记录结果
+func (o *outcomeObserver) ObserveTx(ctx context.Context, info *gormkratos.TxInfo) (context.Context, func(erk *errors.Error, err error)) {
+	return ctx, func(erk *errors.Error, err error) {
+		*o.outcomes = append(*o.outcomes, o.name+":"+string(gormkratos.ClassifyTxOutcome(ctx, erk, err)))
+	}
+}
+
+// TestMultiTransactionObservers tests observers of each database see the outcome of the whole transaction
+// TestMultiTransactionObservers 测试每个数据库的观察者得到整个事务的结果
+func TestMultiTransactionObservers(t *testing.T) {
+	core := gormkratostest.NewDB(t, &Transfer{})
+	ledger, faults := gormkratostest.NewFaultDB(t, &Transfer{})
+	var outcomes []string
+	require.NoError(t, core.Use(&outcomeObserver{name: "core", outcomes: &outcomes}))
+	require.NoError(t, ledger.Use(&outcomeObserver{name: "ledger", outcomes: &outcomes}))
+	dbs := []*gormkratos.NamedDB{
+		gormkratos.Named("core", core),
+		gormkratos.Named("ledger", ledger),
+	}
+
+	erk, err := gormkratos.MultiTransaction(context.Background(), dbs, createTransfers)
+	gormkratostest.RequireCommitted(t, erk, err)
+	require.Equal(t, []string{"core:committed", "ledger:committed"}, outcomes)
+
+	outcomes = nil
+	erk, err = gormkratos.MultiTransaction(context.Background(), dbs, func(txs map[string]*gorm.DB) *errors.Error {
+		return errorspb.ErrorBadRequest("insufficient balance")
+	})
+	gormkratostest.RequireRolledBack(t, erk, err)
+	require.Equal(t, []string{"core:business_rollback", "ledger:business_rollback"}, outcomes)
+
+	outcomes = nil
+	faults.FailCommit(erero.New("constraint check failed on commit"))
+	erk, err = gormkratos.MultiTransaction(context.Background(), dbs, createTransfers)
+	require.Nil(t, erk)
+	require.True(t, gormkratos.IsPartialCommit(err))
+	require.Equal(t, []string{"core:db_error", "ledger:db_error"}, outcomes)
+}
+
+// TestMultiTransactionInvalid tests empty, duplicated and nested databases are rejected
+// TestMultiTransactionInvalid 测试拒绝空的, 重复的和嵌套的数据库
+func TestMultiTransactionInvalid(t *testing.T) {
+	core := gormkratostest.NewDB(t, &Transfer{})
+	run := func(txs map[string]*gorm.DB) *errors.Error {
+		t.Fatal("run should not execute")
+		return nil
+	}
+
+	erk, err := gormkratos.MultiTransaction(context.Background(), nil, run)
+	gormkratostest.RequireRolledBack(t, erk, err)
+
+	erk, err = gormkratos.MultiTransaction(context.Background(), []*gormkratos.NamedDB{
+		gormkratos.Named("core", core),
+		gormkratos.Named("core", gormkratostest.NewDB(t, &Transfer{})),
+	}, run)
+	gormkratostest.RequireRolledBack(t, erk, err)
+
+	erk, err = gormkratos.Transaction(context.Background(), core, func(db *gorm.DB) *errors.Error {
+		_, err := gormkratos.MultiTransaction(context.Background(), []*gormkratos.NamedDB{
+			gormkratos.Named("core", db),
+		}, run)
+		require.Error(t, err)
+		return nil
+	})
+	gormkratostest.RequireCommitted(t, erk, err)
+}
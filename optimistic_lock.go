@@ -0,0 +1,146 @@
+package gormkratos
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"strconv"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/orzkratos/gormkratos/api/dberrors/v1"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// VersionColumn is the column holding the version of optimistically locked models
+// VersionColumn 是乐观锁模型中保存版本号的列
+const VersionColumn = "version"
+
+// UpdateWithVersion updates the columns of the model row when its version still matches, bumping the version by one
+// Runs UPDATE ... SET version = version + 1 WHERE id = ? AND version = ?, use it inside run with the tx
+// Zero rows affected returns DB_CONFLICT (409) with entity, id and expected_version in metadata, so the transaction rolls back
+// The model is a struct pointer with an integer version column and a non-zero primary key
+// On success the model takes the columns and the bumped version, on failure it is left unchanged
+//
+// UpdateWithVersion 当模型行的版本号仍然匹配时更新这些列, 并将版本号加一
+// 执行 UPDATE ... SET version = version + 1 WHERE id = ? AND version = ?, 在 run 中使用 tx 调用
+// 影响行数为零时返回 DB_CONFLICT (409), 元数据包含 entity, id 和 expected_version, 使事务回滚
+// 模型是带整数类型版本列和非零主键的结构体指针
+// 成功时模型获得这些列的值和加一后的版本号, 失败时模型保持不变
+func UpdateWithVersion(db *gorm.DB, model any, columns map[string]any) *errors.Error {
+	lock, erk := newVersionLock(db, model)
+	if erk != nil {
+		return erk
+	}
+	values := maps.Clone(columns)
+	if values == nil {
+		values = map[string]any{}
+	}
+	values[VersionColumn] = lock.version + 1
+	// GORM assigns the columns to the model even when no row matches, keep a copy to restore
+	// 即使没有匹配的行, GORM 也会将这些列赋值给模型, 保留副本用于恢复
+	original := reflect.New(lock.value.Type()).Elem()
+	original.Set(lock.value)
+	result := db.Model(model).Where(lock.condition()).Updates(values)
+	if result.Error != nil {
+		lock.value.Set(original)
+		return TranslateDbError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		lock.value.Set(original)
+		return lock.conflict()
+	}
+	return lock.bump(db)
+}
+
+// DeleteWithVersion deletes the model row when its version still matches
+// Zero rows affected returns DB_CONFLICT (409) the same as UpdateWithVersion
+//
+// DeleteWithVersion 当模型行的版本号仍然匹配时删除该行
+// 影响行数为零时与 UpdateWithVersion 相同返回 DB_CONFLICT (409)
+func DeleteWithVersion(db *gorm.DB, model any) *errors.Error {
+	lock, erk := newVersionLock(db, model)
+	if erk != nil {
+		return erk
+	}
+	result := db.Where(lock.condition()).Delete(model)
+	if result.Error != nil {
+		return TranslateDbError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return lock.conflict()
+	}
+	return nil
+}
+
+// versionLock holds the primary key and version read from the model
+// versionLock 保存从模型读取的主键和版本号
+type versionLock struct {
+	schema  *schema.Schema
+	field   *schema.Field // Version field // 版本号字段
+	value   reflect.Value // Model value // 模型的值
+	id      any           // Primary key // 主键
+	version int64         // Expected version // 期望的版本号
+}
+
+// newVersionLock reads the primary key and the version of the model
+// newVersionLock 读取模型的主键和版本号
+func newVersionLock(db *gorm.DB, model any) (*versionLock, *errors.Error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, dberrors.ErrorServerDbError("failed to parse model %T: %v", model, err)
+	}
+	field := stmt.Schema.LookUpField(VersionColumn)
+	if field == nil {
+		return nil, dberrors.ErrorServerDbError("model %T has no %s column", model, VersionColumn)
+	}
+	primary := stmt.Schema.PrioritizedPrimaryField
+	if primary == nil {
+		return nil, dberrors.ErrorServerDbError("model %T has no primary key", model)
+	}
+	value := reflect.Indirect(reflect.ValueOf(model))
+	ctx := db.Statement.Context
+	id, zero := primary.ValueOf(ctx, value)
+	if zero {
+		return nil, dberrors.ErrorServerDbError("model %T has zero primary key", model)
+	}
+	version, _ := field.ValueOf(ctx, value)
+	current := reflect.ValueOf(version)
+	lock := &versionLock{schema: stmt.Schema, field: field, value: value, id: id}
+	switch {
+	case current.CanInt():
+		lock.version = current.Int()
+	case current.CanUint():
+		lock.version = int64(current.Uint())
+	default:
+		return nil, dberrors.ErrorServerDbError("column %s of model %T is not integer", VersionColumn, model)
+	}
+	return lock, nil
+}
+
+// condition returns the WHERE condition matching the expected version
+// condition 返回匹配期望版本号的 WHERE 条件
+func (l *versionLock) condition() clause.Eq {
+	return clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: l.field.DBName}, Value: l.version}
+}
+
+// conflict returns DB_CONFLICT with the entity, id and expected version
+// conflict 返回带 entity, id 和期望版本号的 DB_CONFLICT
+func (l *versionLock) conflict() *errors.Error {
+	id := fmt.Sprint(l.id)
+	return dberrors.ErrorDbConflict("%s %s was changed or deleted, expected version %d", l.schema.Table, id, l.version).WithMetadata(map[string]string{
+		"entity":           l.schema.Table,
+		"id":               id,
+		"expected_version": strconv.FormatInt(l.version, 10),
+	})
+}
+
+// bump sets the version of the model to the updated version
+// bump 将模型的版本号设为更新后的版本号
+func (l *versionLock) bump(db *gorm.DB) *errors.Error {
+	if err := l.field.Set(db.Statement.Context, l.value, l.version+1); err != nil {
+		return dberrors.ErrorServerDbError("failed to set %s of %s: %v", VersionColumn, l.schema.Table, err)
+	}
+	return nil
+}
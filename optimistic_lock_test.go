@@ -0,0 +1,112 @@
+package gormkratos_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/orzkratos/gormkratos"
+	"github.com/orzkratos/gormkratos/api/dberrors/v1"
+	"github.com/orzkratos/gormkratos/gormkratostest"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// Stock is the optimistically locked model in tests
+// Stock 是测试中使用乐观锁的模型
+type Stock struct {
+	ID       uint `gorm:"primaryKey"`
+	Quantity int
+	Version  int64
+}
+
+// setupStockDB creates database with one stock of quantity 10 at version 1
+// setupStockDB 创建包含一条数量为 10, 版本号为 1 的库存的数据库
+func setupStockDB(t *testing.T) *gorm.DB {
+	db := gormkratostest.NewDB(t, &Stock{}, &Book{})
+	require.NoError(t, db.Create(&Stock{Quantity: 10, Version: 1}).Error)
+	return db
+}
+
+// loadStock loads the stock
+// loadStock 加载库存
+func loadStock(t *testing.T, db *gorm.DB) *Stock {
+	var stock Stock
+	require.NoError(t, db.First(&stock).Error)
+	return &stock
+}
+
+// TestUpdateWithVersion tests matching versions update the row and bump the version
+// TestUpdateWithVersion 测试版本号匹配时更新该行并将版本号加一
+func TestUpdateWithVersion(t *testing.T) {
+	db := setupStockDB(t)
+	stock := loadStock(t, db)
+
+	erk, err := gormkratos.Transaction(context.Background(), db, func(db *gorm.DB) *errors.Error {
+		return gormkratos.UpdateWithVersion(db, stock, map[string]any{"quantity": 9})
+	})
+	gormkratostest.RequireCommitted(t, erk, err)
+	require.Equal(t, int64(2), stock.Version)
+	require.Equal(t, &Stock{ID: 1, Quantity: 9, Version: 2}, loadStock(t, db))
+}
+
+// TestUpdateWithVersionConflict tests stale versions return DB_CONFLICT and roll back the transaction
+// TestUpdateWithVersionConflict 测试过期的版本号返回 DB_CONFLICT 并回滚事务
+func TestUpdateWithVersionConflict(t *testing.T) {
+	db := setupStockDB(t)
+	first := loadStock(t, db)
+	second := loadStock(t, db)
+
+	require.Nil(t, gormkratos.UpdateWithVersion(db, first, map[string]any{"quantity": 9}))
+
+	erk, err := gormkratos.Transaction(context.Background(), db, func(db *gorm.DB) *errors.Error {
+		require.NoError(t, db.Create(&Book{Title: "audit"}).Error)
+		return gormkratos.UpdateWithVersion(db, second, map[string]any{"quantity": 8})
+	})
+	gormkratostest.RequireRolledBack(t, erk, err)
+	require.True(t, dberrors.IsDbConflict(erk))
+	require.Equal(t, int32(409), erk.Code)
+	require.Equal(t, map[string]string{"entity": "stocks", "id": "1", "expected_version": "1"}, erk.Metadata)
+	require.Equal(t, int64(1), second.Version)
+
+	require.Equal(t, &Stock{ID: 1, Quantity: 9, Version: 2}, loadStock(t, db))
+	var count int64
+	require.NoError(t, db.Model(&Book{}).Count(&count).Error)
+	require.Equal(t, int64(0), count)
+}
+
+// TestDeleteWithVersion tests deletes check the version too
+// TestDeleteWithVersion 测试删除同样检查版本号
+func TestDeleteWithVersion(t *testing.T) {
+	db := setupStockDB(t)
+	stale := loadStock(t, db)
+	stock := loadStock(t, db)
+
+	require.Nil(t, gormkratos.UpdateWithVersion(db, stock, map[string]any{"quantity": 9}))
+
+	erk := gormkratos.DeleteWithVersion(db, stale)
+	require.True(t, dberrors.IsDbConflict(erk))
+
+	require.Nil(t, gormkratos.DeleteWithVersion(db, stock))
+	var count int64
+	require.NoError(t, db.Model(&Stock{}).Count(&count).Error)
+	require.Equal(t, int64(0), count)
+
+	// Deleted rows conflict on update
+	// 已删除的行在更新时冲突
+	erk = gormkratos.UpdateWithVersion(db, stock, nil)
+	require.True(t, dberrors.IsDbConflict(erk))
+}
+
+// TestUpdateWithVersionInvalidModel tests models without version column or primary key are rejected
+// TestUpdateWithVersionInvalidModel 测试没有版本列或主键的模型被拒绝
+func TestUpdateWithVersionInvalidModel(t *testing.T) {
+	db := setupStockDB(t)
+
+	erk := gormkratos.UpdateWithVersion(db, &Book{ID: 1}, map[string]any{"title": "go"})
+	require.True(t, dberrors.IsServerDbError(erk))
+
+	erk = gormkratos.UpdateWithVersion(db, &Stock{Version: 1}, map[string]any{"quantity": 0})
+	require.True(t, dberrors.IsServerDbError(erk))
+	require.Equal(t, &Stock{ID: 1, Quantity: 10, Version: 1}, loadStock(t, db))
+}
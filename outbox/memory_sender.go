@@ -0,0 +1,57 @@
+package outbox
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// MemorySender keeps delivered messages in memory, used in tests
+//
+// MemorySender 将投递的消息保存在内存中, 用于测试
+type MemorySender struct {
+	mutex    sync.Mutex
+	messages []*Message
+	failFunc func(message *Message) error
+}
+
+// NewMemorySender creates in-memory sender
+//
+// NewMemorySender 创建内存发送器
+func NewMemorySender() *MemorySender {
+	return &MemorySender{}
+}
+
+// WithFailFunc sets the function deciding delivery failures, returning errors fails the delivery
+//
+// WithFailFunc 设置决定投递失败的函数, 返回错误时投递失败
+func (s *MemorySender) WithFailFunc(failFunc func(message *Message) error) *MemorySender {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.failFunc = failFunc
+	return s
+}
+
+// Send records the message unless the fail function returns errors
+//
+// Send 记录消息, 除非失败函数返回错误
+func (s *MemorySender) Send(ctx context.Context, message *Message) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.failFunc != nil {
+		if err := s.failFunc(message); err != nil {
+			return err
+		}
+	}
+	s.messages = append(s.messages, message)
+	return nil
+}
+
+// Messages returns the delivered messages in delivery order
+//
+// Messages 按投递顺序返回已投递的消息
+func (s *MemorySender) Messages() []*Message {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return slices.Clone(s.messages)
+}
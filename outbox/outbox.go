@@ -0,0 +1,73 @@
+// Package outbox: Transactional outbox built on gormkratos.Transaction
+// Writes domain events into the outbox table in the same transaction as business data,
+// then a polling relay delivers them with at-least-once semantics
+//
+// outbox: 基于 gormkratos.Transaction 的事务性发件箱
+// 在业务数据的同一事务中将领域事件写入发件箱表,
+// 然后由轮询中继以至少一次的语义投递
+package outbox
+
+import (
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/orzkratos/gormkratos/api/dberrors/v1"
+	"gorm.io/gorm"
+)
+
+// Status of outbox messages
+// Status 发件箱消息的状态
+type Status string
+
+const (
+	StatusPending Status = "pending" // Waiting to be delivered // 等待投递
+	StatusSent    Status = "sent"    // Delivered // 已投递
+	StatusDead    Status = "dead"    // Exhausted attempts, dead-lettered // 耗尽尝试次数, 进入死信
+)
+
+// Message represents one event in the outbox table
+// Message 表示发件箱表中的一条事件
+type Message struct {
+	ID            uint64     `gorm:"primarykey"`                                                      // Auto-increment ID, also the delivery order // 自增主键, 也是投递顺序
+	Topic         string     `gorm:"column:topic;size:255;not null;index"`                            // Destination topic // 目标主题
+	Payload       []byte     `gorm:"column:payload"`                                                  // Event payload // 事件内容
+	Status        Status     `gorm:"column:status;size:16;not null;index:idx_outbox_due,priority:1"`  // Delivery status // 投递状态
+	NextAttemptAt time.Time  `gorm:"column:next_attempt_at;not null;index:idx_outbox_due,priority:2"` // Time of the next delivery attempt // 下次投递时间
+	Attempts      int        `gorm:"column:attempts;not null"`                                        // Failed delivery attempts // 失败的投递次数
+	LastError     string     `gorm:"column:last_error"`                                               // Error of the last failed attempt // 最近一次失败的错误
+	CreatedAt     time.Time  `gorm:"column:created_at"`                                               // Time of publishing // 发布时间
+	SentAt        *time.Time `gorm:"column:sent_at"`                                                  // Time of delivery // 投递时间
+}
+
+// TableName returns the outbox table name
+// TableName 返回发件箱表名
+func (*Message) TableName() string {
+	return "outbox_messages"
+}
+
+// Migrate creates or updates the outbox table
+//
+// Migrate 创建或更新发件箱表
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(&Message{})
+}
+
+// Publish writes an event into the outbox table, call it inside run with the tx
+// The event is delivered only when the transaction commits
+//
+// Publish 将事件写入发件箱表, 在 run 中使用 tx 调用
+// 事件只有在事务提交后才会被投递
+func Publish(tx *gorm.DB, topic string, payload []byte) *errors.Error {
+	now := time.Now().UTC()
+	message := &Message{
+		Topic:         topic,
+		Payload:       payload,
+		Status:        StatusPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+	if err := tx.Create(message).Error; err != nil {
+		return dberrors.ErrorServerDbError("failed to publish outbox message on topic %s: %v", topic, err)
+	}
+	return nil
+}
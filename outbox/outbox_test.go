@@ -0,0 +1,72 @@
+package outbox_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/google/uuid"
+	"github.com/orzkratos/errkratos/must/erkrequire"
+	"github.com/orzkratos/gormkratos"
+	"github.com/orzkratos/gormkratos/internal/errorspb"
+	"github.com/orzkratos/gormkratos/outbox"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/rese"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// setupTestDB creates isolated in-memory SQLite database with the outbox table
+// setupTestDB 创建带发件箱表的独立内存 SQLite 数据库
+func setupTestDB(t *testing.T) *gorm.DB {
+	dsn := fmt.Sprintf("file:db-%s?mode=memory&cache=shared", uuid.New().String())
+	db := rese.P1(gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Info),
+	}))
+	t.Cleanup(func() {
+		must.Done(rese.P1(db.DB()).Close())
+	})
+	require.NoError(t, outbox.Migrate(db))
+	return db
+}
+
+// TestPublishCommit tests published messages are stored when the transaction commits
+// TestPublishCommit 测试事务提交时发布的消息被保存
+func TestPublishCommit(t *testing.T) {
+	db := setupTestDB(t)
+
+	erk, err := gormkratos.Transaction(context.Background(), db, func(db *gorm.DB) *errors.Error {
+		return outbox.Publish(db, "order.created", []byte(`{"id":1}`))
+	})
+	require.NoError(t, err)
+	erkrequire.NoError(t, erk)
+
+	var messages []*outbox.Message
+	require.NoError(t, db.Find(&messages).Error)
+	require.Len(t, messages, 1)
+	require.Equal(t, "order.created", messages[0].Topic)
+	require.Equal(t, []byte(`{"id":1}`), messages[0].Payload)
+	require.Equal(t, outbox.StatusPending, messages[0].Status)
+}
+
+// TestPublishRollback tests published messages are dropped when the transaction rolls back
+// TestPublishRollback 测试事务回滚时发布的消息被丢弃
+func TestPublishRollback(t *testing.T) {
+	db := setupTestDB(t)
+
+	erk, err := gormkratos.Transaction(context.Background(), db, func(db *gorm.DB) *errors.Error {
+		if erk := outbox.Publish(db, "order.created", []byte(`{"id":1}`)); erk != nil {
+			return erk
+		}
+		return errorspb.ErrorBadRequest("validation failed")
+	})
+	require.Error(t, err)
+	require.True(t, errorspb.IsBadRequest(erk))
+
+	var count int64
+	require.NoError(t, db.Model(&outbox.Message{}).Count(&count).Error)
+	require.Equal(t, int64(0), count)
+}
@@ -0,0 +1,224 @@
+package outbox
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/yyle88/erero"
+	"github.com/yyle88/zaplog"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Sender delivers outbox messages to the message broker
+// Returning errors makes the relay retry the message with backoff
+//
+// Sender 将发件箱消息投递到消息代理
+// 返回错误时中继会以退避方式重试该消息
+type Sender interface {
+	Send(ctx context.Context, message *Message) error
+}
+
+// RelayConfig configures the polling relay
+//
+// RelayConfig 配置轮询中继
+type RelayConfig struct {
+	BatchSize    int           // Max messages claimed per poll // 每次轮询最多认领的消息数
+	PollInterval time.Duration // Wait time between polls // 轮询间隔
+	LeaseTimeout time.Duration // Claimed messages become due again after this time, covering relay crashes // 认领的消息超过该时间再次到期, 应对中继崩溃
+	MaxAttempts  int           // Failed attempts before dead-lettering // 进入死信前的失败次数
+	BaseDelay    time.Duration // Delay before the first retry // 首次重试前的等待时间
+	MaxDelay     time.Duration // Upper bound of the retry delay // 重试等待时间上限
+}
+
+// NewRelayConfig creates relay config with defaults
+// Default: 100 per batch, 1s poll interval, 30s lease, 10 attempts, 1s base delay, 5m max delay
+//
+// NewRelayConfig 创建带默认值的中继配置
+// 默认: 每批 100 条, 1s 轮询间隔, 30s 租约, 10 次尝试, 1s 基础等待, 5m 最大等待
+func NewRelayConfig() *RelayConfig {
+	return &RelayConfig{
+		BatchSize:    100,
+		PollInterval: time.Second,
+		LeaseTimeout: 30 * time.Second,
+		MaxAttempts:  10,
+		BaseDelay:    time.Second,
+		MaxDelay:     5 * time.Minute,
+	}
+}
+
+// WithBatchSize sets the max messages claimed per poll
+// WithBatchSize 设置每次轮询最多认领的消息数
+func (c *RelayConfig) WithBatchSize(batchSize int) *RelayConfig {
+	c.BatchSize = batchSize
+	return c
+}
+
+// WithPollInterval sets the wait time between polls
+// WithPollInterval 设置轮询间隔
+func (c *RelayConfig) WithPollInterval(pollInterval time.Duration) *RelayConfig {
+	c.PollInterval = pollInterval
+	return c
+}
+
+// WithLeaseTimeout sets the lease of claimed messages
+// WithLeaseTimeout 设置认领消息的租约时间
+func (c *RelayConfig) WithLeaseTimeout(leaseTimeout time.Duration) *RelayConfig {
+	c.LeaseTimeout = leaseTimeout
+	return c
+}
+
+// WithMaxAttempts sets the failed attempts before dead-lettering
+// WithMaxAttempts 设置进入死信前的失败次数
+func (c *RelayConfig) WithMaxAttempts(maxAttempts int) *RelayConfig {
+	c.MaxAttempts = maxAttempts
+	return c
+}
+
+// WithBackoff sets the base delay and max delay of retries
+// WithBackoff 设置重试的基础等待和最大等待
+func (c *RelayConfig) WithBackoff(baseDelay time.Duration, maxDelay time.Duration) *RelayConfig {
+	c.BaseDelay = baseDelay
+	c.MaxDelay = maxDelay
+	return c
+}
+
+// delay computes the wait time after the given failed attempts, doubling each time
+// delay 计算给定失败次数后的等待时间, 每次翻倍
+func (c *RelayConfig) delay(attempts int) time.Duration {
+	delay := float64(c.BaseDelay) * math.Pow(2, float64(attempts-1))
+	if c.MaxDelay > 0 {
+		delay = min(delay, float64(c.MaxDelay))
+	}
+	return time.Duration(delay)
+}
+
+// Relay polls the outbox table and delivers due messages through the sender
+// Messages are marked sent only after the sender succeeds, giving at-least-once delivery
+//
+// Relay 轮询发件箱表并通过发送器投递到期的消息
+// 只有发送器成功后消息才标记为已发送, 保证至少一次投递
+type Relay struct {
+	db     *gorm.DB
+	sender Sender
+	config *RelayConfig
+}
+
+// NewRelay creates relay delivering messages of the database through the sender
+//
+// NewRelay 创建通过发送器投递数据库中消息的中继
+func NewRelay(db *gorm.DB, sender Sender, config *RelayConfig) *Relay {
+	return &Relay{db: db, sender: sender, config: config}
+}
+
+// Run polls and delivers messages until ctx is done
+//
+// Run 轮询并投递消息, 直到 ctx 结束
+func (r *Relay) Run(ctx context.Context) error {
+	for {
+		if _, err := r.RelayOnce(ctx); err != nil {
+			zaplog.LOG.Error("outbox relay failed", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(r.config.PollInterval):
+		}
+	}
+}
+
+// RelayOnce claims one batch of due messages and delivers them, returns the count of delivered messages
+//
+// RelayOnce 认领一批到期的消息并投递, 返回投递成功的消息数
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	db := r.db.WithContext(ctx)
+
+	var messages []*Message
+	if err := db.Where("status = ? AND next_attempt_at <= ?", StatusPending, time.Now().UTC()).
+		Order("id").Limit(r.config.BatchSize).Find(&messages).Error; err != nil {
+		return 0, erero.Wro(err)
+	}
+
+	var delivered int
+	for _, message := range messages {
+		claimed, err := r.claim(db, message)
+		if err != nil {
+			return delivered, err
+		}
+		if !claimed {
+			continue // Claimed by another relay // 已被其它中继认领
+		}
+		if err := r.sender.Send(ctx, message); err != nil {
+			if err := r.markFailed(db, message, err); err != nil {
+				return delivered, err
+			}
+			continue
+		}
+		if err := r.markSent(db, message); err != nil {
+			return delivered, err
+		}
+		delivered++
+	}
+	return delivered, nil
+}
+
+// claim leases the message by pushing its next attempt time forward, only when it is still due
+// claim 仅当消息仍然到期时, 通过推迟下次投递时间租用该消息
+func (r *Relay) claim(db *gorm.DB, message *Message) (bool, error) {
+	now := time.Now().UTC()
+	result := db.Model(&Message{}).
+		Where("id = ? AND status = ? AND next_attempt_at <= ?", message.ID, StatusPending, now).
+		Update("next_attempt_at", now.Add(r.config.LeaseTimeout))
+	if result.Error != nil {
+		return false, erero.Wro(result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// markSent marks the message delivered
+// markSent 将消息标记为已投递
+func (r *Relay) markSent(db *gorm.DB, message *Message) error {
+	now := time.Now().UTC()
+	message.Status = StatusSent
+	message.SentAt = &now
+	if err := db.Model(&Message{}).Where("id = ?", message.ID).Updates(map[string]any{
+		"status":  StatusSent,
+		"sent_at": now,
+	}).Error; err != nil {
+		return erero.Wro(err)
+	}
+	return nil
+}
+
+// markFailed records the failed attempt, schedules the retry or dead-letters the message
+// markFailed 记录失败的投递, 安排重试或将消息放入死信
+func (r *Relay) markFailed(db *gorm.DB, message *Message, cause error) error {
+	message.Attempts++
+	message.LastError = cause.Error()
+	if message.Attempts >= r.config.MaxAttempts {
+		message.Status = StatusDead
+	} else {
+		message.NextAttemptAt = time.Now().UTC().Add(r.config.delay(message.Attempts))
+	}
+	if err := db.Model(&Message{}).Where("id = ?", message.ID).Updates(map[string]any{
+		"status":          message.Status,
+		"attempts":        message.Attempts,
+		"last_error":      message.LastError,
+		"next_attempt_at": message.NextAttemptAt,
+	}).Error; err != nil {
+		return erero.Wro(err)
+	}
+	return nil
+}
+
+// DeadLetters returns the dead-lettered messages in publishing order
+//
+// DeadLetters 按发布顺序返回进入死信的消息
+func (r *Relay) DeadLetters(ctx context.Context) ([]*Message, error) {
+	var messages []*Message
+	if err := r.db.WithContext(ctx).Where("status = ?", StatusDead).Order("id").Find(&messages).Error; err != nil {
+		return nil, erero.Wro(err)
+	}
+	return messages, nil
+}
@@ -0,0 +1,147 @@
+package outbox_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/orzkratos/errkratos/must/erkrequire"
+	"github.com/orzkratos/gormkratos"
+	"github.com/orzkratos/gormkratos/outbox"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/erero"
+	"gorm.io/gorm"
+)
+
+// publish writes messages on the topic in one transaction
+// publish 在一个事务中写入该主题的消息
+func publish(t *testing.T, db *gorm.DB, topic string, payloads ...string) {
+	erk := gormkratos.TransactionErk(context.Background(), db, func(db *gorm.DB) *errors.Error {
+		for _, payload := range payloads {
+			if erk := outbox.Publish(db, topic, []byte(payload)); erk != nil {
+				return erk
+			}
+		}
+		return nil
+	})
+	erkrequire.NoError(t, erk)
+}
+
+// TestRelayOnce tests due messages are delivered in publishing order and marked sent
+// TestRelayOnce 测试到期消息按发布顺序投递并标记为已发送
+func TestRelayOnce(t *testing.T) {
+	db := setupTestDB(t)
+	publish(t, db, "order.created", "a", "b", "c")
+
+	sender := outbox.NewMemorySender()
+	relay := outbox.NewRelay(db, sender, outbox.NewRelayConfig())
+
+	delivered, err := relay.RelayOnce(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 3, delivered)
+
+	messages := sender.Messages()
+	require.Len(t, messages, 3)
+	require.Equal(t, "a", string(messages[0].Payload))
+	require.Equal(t, "c", string(messages[2].Payload))
+
+	// Sent messages are not delivered again
+	// 已发送的消息不会再次投递
+	delivered, err = relay.RelayOnce(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 0, delivered)
+
+	var count int64
+	require.NoError(t, db.Model(&outbox.Message{}).Where("status = ? AND sent_at IS NOT NULL", outbox.StatusSent).Count(&count).Error)
+	require.Equal(t, int64(3), count)
+}
+
+// TestRelayRetry tests failed deliveries are retried after the backoff delay
+// TestRelayRetry 测试失败的投递在退避等待后重试
+func TestRelayRetry(t *testing.T) {
+	db := setupTestDB(t)
+	publish(t, db, "order.created", "a")
+
+	var failures int
+	sender := outbox.NewMemorySender().WithFailFunc(func(message *outbox.Message) error {
+		if failures < 1 {
+			failures++
+			return erero.New("broker unavailable")
+		}
+		return nil
+	})
+	relay := outbox.NewRelay(db, sender, outbox.NewRelayConfig().WithBackoff(50*time.Millisecond, time.Second))
+
+	delivered, err := relay.RelayOnce(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 0, delivered)
+
+	var message outbox.Message
+	require.NoError(t, db.First(&message).Error)
+	require.Equal(t, 1, message.Attempts)
+	require.Equal(t, "broker unavailable", message.LastError)
+	require.Equal(t, outbox.StatusPending, message.Status)
+
+	// Not due before the backoff delay
+	// 退避等待结束前不会到期
+	delivered, err = relay.RelayOnce(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 0, delivered)
+
+	time.Sleep(100 * time.Millisecond)
+	delivered, err = relay.RelayOnce(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, delivered)
+	require.Len(t, sender.Messages(), 1)
+}
+
+// TestRelayDeadLetter tests messages exhausting attempts are dead-lettered
+// TestRelayDeadLetter 测试耗尽尝试次数的消息进入死信
+func TestRelayDeadLetter(t *testing.T) {
+	db := setupTestDB(t)
+	publish(t, db, "order.created", "poison", "good")
+
+	sender := outbox.NewMemorySender().WithFailFunc(func(message *outbox.Message) error {
+		if string(message.Payload) == "poison" {
+			return erero.New("cannot encode")
+		}
+		return nil
+	})
+	relay := outbox.NewRelay(db, sender, outbox.NewRelayConfig().WithMaxAttempts(2).WithBackoff(0, 0))
+
+	for range 3 {
+		_, err := relay.RelayOnce(context.Background())
+		require.NoError(t, err)
+	}
+	require.Len(t, sender.Messages(), 1)
+
+	deadLetters, err := relay.DeadLetters(context.Background())
+	require.NoError(t, err)
+	require.Len(t, deadLetters, 1)
+	require.Equal(t, "poison", string(deadLetters[0].Payload))
+	require.Equal(t, 2, deadLetters[0].Attempts)
+}
+
+// TestRelayRun tests the polling loop delivers messages published later
+// TestRelayRun 测试轮询循环投递后续发布的消息
+func TestRelayRun(t *testing.T) {
+	db := setupTestDB(t)
+
+	sender := outbox.NewMemorySender()
+	relay := outbox.NewRelay(db, sender, outbox.NewRelayConfig().WithPollInterval(10*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- relay.Run(ctx)
+	}()
+
+	publish(t, db, "order.created", "a", "b")
+	require.Eventually(t, func() bool {
+		return len(sender.Messages()) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+}
@@ -0,0 +1,53 @@
+package gormkratos
+
+// Propagation decides how TxManager transactions behave when ctx already carries a transaction
+// Mirrors the Spring transaction propagation modes
+//
+// Propagation 决定当 ctx 已携带事务时 TxManager 事务的行为
+// 参照 Spring 事务传播方式
+type Propagation int
+
+const (
+	// PropagationRequired joins the existing transaction, else begins a new one
+	// Business errors of joined calls mark the whole transaction rollback-only
+	//
+	// PropagationRequired 加入已有事务, 否则开启新事务
+	// 加入调用的业务错误会将整个事务标记为只能回滚
+	PropagationRequired Propagation = iota
+	// PropagationRequiresNew always begins a new transaction on a separate connection
+	// PropagationRequiresNew 总是在独立连接上开启新事务
+	PropagationRequiresNew
+	// PropagationNested runs in a savepoint of the existing transaction, else begins a new one
+	// PropagationNested 在已有事务的保存点中执行, 否则开启新事务
+	PropagationNested
+	// PropagationMandatory joins the existing transaction, fails with SERVER_DB_TRANSACTION_MANDATORY when none exists
+	// PropagationMandatory 加入已有事务, 不存在事务时以 SERVER_DB_TRANSACTION_MANDATORY 失败
+	PropagationMandatory
+	// PropagationNever runs without transaction, fails with SERVER_DB_TRANSACTION_NEVER when one exists
+	// PropagationNever 不使用事务执行, 存在事务时以 SERVER_DB_TRANSACTION_NEVER 失败
+	PropagationNever
+	// PropagationSupports joins the existing transaction, else runs without transaction
+	// PropagationSupports 加入已有事务, 否则不使用事务执行
+	PropagationSupports
+)
+
+// String returns the name of the propagation mode
+// String 返回传播方式的名称
+func (p Propagation) String() string {
+	switch p {
+	case PropagationRequired:
+		return "REQUIRED"
+	case PropagationRequiresNew:
+		return "REQUIRES_NEW"
+	case PropagationNested:
+		return "NESTED"
+	case PropagationMandatory:
+		return "MANDATORY"
+	case PropagationNever:
+		return "NEVER"
+	case PropagationSupports:
+		return "SUPPORTS"
+	default:
+		return "UNKNOWN"
+	}
+}
@@ -0,0 +1,163 @@
+package gormkratos_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/orzkratos/errkratos/must/erkrequire"
+	"github.com/orzkratos/gormkratos"
+	"github.com/orzkratos/gormkratos/api/dberrors/v1"
+	"github.com/orzkratos/gormkratos/internal/errorspb"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPropagationRequiredJoin tests joined calls share the outer transaction
+// TestPropagationRequiredJoin 测试加入的调用共享外层事务
+func TestPropagationRequiredJoin(t *testing.T) {
+	db, repo := setupOrderRepo(t)
+	txm := gormkratos.NewTxManager(db)
+
+	erk, err := txm.Transaction(context.Background(), func(ctx context.Context) *errors.Error {
+		outer, _ := gormkratos.TxFromContext(ctx, db)
+		erk, err := txm.Transaction(ctx, func(ctx context.Context) *errors.Error {
+			inner, _ := gormkratos.TxFromContext(ctx, db)
+			require.Same(t, outer, inner)
+			return repo.Create(ctx, "joined")
+		})
+		require.NoError(t, err)
+		erkrequire.NoError(t, erk)
+		return nil
+	})
+	require.NoError(t, err)
+	erkrequire.NoError(t, erk)
+	require.Equal(t, int64(1), repo.Count(context.Background()))
+}
+
+// TestPropagationRequiredRollbackOnly tests business errors of joined calls roll back the outer transaction
+// TestPropagationRequiredRollbackOnly 测试加入调用的业务错误使外层事务回滚
+func TestPropagationRequiredRollbackOnly(t *testing.T) {
+	db, repo := setupOrderRepo(t)
+	txm := gormkratos.NewTxManager(db)
+
+	erk, err := txm.Transaction(context.Background(), func(ctx context.Context) *errors.Error {
+		if erk := repo.Create(ctx, "outer"); erk != nil {
+			return erk
+		}
+		erk, err := txm.Transaction(ctx, func(ctx context.Context) *errors.Error {
+			return errorspb.ErrorBadRequest("inner failed")
+		})
+		require.Error(t, err)
+		require.True(t, errorspb.IsBadRequest(erk))
+		return nil // Swallow the inner business error // 吞掉内层业务错误
+	})
+	require.Error(t, err)
+	erkrequire.Error(t, erk)
+	require.True(t, errorspb.IsBadRequest(erk))
+	require.Equal(t, int64(0), repo.Count(context.Background()))
+}
+
+// TestPropagationRequiresNew tests inner transaction commits independent of the outer one
+// TestPropagationRequiresNew 测试内层事务独立于外层事务提交
+func TestPropagationRequiresNew(t *testing.T) {
+	db, repo := setupOrderRepo(t)
+	txm := gormkratos.NewTxManager(db)
+
+	erk := txm.TransactionErk(context.Background(), func(ctx context.Context) *errors.Error {
+		outer, _ := gormkratos.TxFromContext(ctx, db)
+		erk := txm.WithPropagation(gormkratos.PropagationRequiresNew).TransactionErk(ctx, func(ctx context.Context) *errors.Error {
+			inner, _ := gormkratos.TxFromContext(ctx, db)
+			require.NotSame(t, outer, inner)
+			return repo.Create(ctx, "independent")
+		})
+		erkrequire.NoError(t, erk)
+		return errorspb.ErrorBadRequest("outer failed")
+	})
+	require.True(t, errorspb.IsBadRequest(erk))
+	require.Equal(t, int64(1), repo.Count(context.Background()))
+}
+
+// TestPropagationMandatory tests MANDATORY fails without existing transaction
+// TestPropagationMandatory 测试 MANDATORY 在没有事务时失败
+func TestPropagationMandatory(t *testing.T) {
+	db, repo := setupOrderRepo(t)
+	txm := gormkratos.NewTxManager(db).WithPropagation(gormkratos.PropagationMandatory)
+
+	var runs int
+	erk, err := txm.Transaction(context.Background(), func(ctx context.Context) *errors.Error {
+		runs++
+		return nil
+	})
+	require.Error(t, err)
+	require.True(t, dberrors.IsServerDbTransactionMandatory(erk))
+	require.Equal(t, 0, runs)
+
+	erk = gormkratos.NewTxManager(db).TransactionErk(context.Background(), func(ctx context.Context) *errors.Error {
+		return txm.TransactionErk(ctx, func(ctx context.Context) *errors.Error {
+			return repo.Create(ctx, "mandatory")
+		})
+	})
+	erkrequire.NoError(t, erk)
+	require.Equal(t, int64(1), repo.Count(context.Background()))
+}
+
+// TestPropagationNever tests NEVER fails with existing transaction and runs without one otherwise
+// TestPropagationNever 测试 NEVER 在存在事务时失败, 否则不使用事务执行
+func TestPropagationNever(t *testing.T) {
+	db, repo := setupOrderRepo(t)
+	txm := gormkratos.NewTxManager(db).WithPropagation(gormkratos.PropagationNever)
+
+	erk := gormkratos.NewTxManager(db).TransactionErk(context.Background(), func(ctx context.Context) *errors.Error {
+		erk := txm.TransactionErk(ctx, func(ctx context.Context) *errors.Error {
+			return nil
+		})
+		require.True(t, dberrors.IsServerDbTransactionNever(erk))
+		return nil
+	})
+	erkrequire.NoError(t, erk)
+
+	erk = txm.TransactionErk(context.Background(), func(ctx context.Context) *errors.Error {
+		_, ok := gormkratos.TxFromContext(ctx, db)
+		require.False(t, ok)
+		if erk := repo.Create(ctx, "plain"); erk != nil {
+			return erk
+		}
+		return errorspb.ErrorBadRequest("no rollback without transaction")
+	})
+	require.True(t, errorspb.IsBadRequest(erk))
+	require.Equal(t, int64(1), repo.Count(context.Background()))
+}
+
+// TestPropagationSupports tests SUPPORTS joins the existing transaction and runs without one otherwise
+// TestPropagationSupports 测试 SUPPORTS 加入已有事务, 否则不使用事务执行
+func TestPropagationSupports(t *testing.T) {
+	db, _ := setupOrderRepo(t)
+	txm := gormkratos.NewTxManager(db).WithPropagation(gormkratos.PropagationSupports)
+
+	erk := txm.TransactionErk(context.Background(), func(ctx context.Context) *errors.Error {
+		_, ok := gormkratos.TxFromContext(ctx, db)
+		require.False(t, ok)
+		return nil
+	})
+	erkrequire.NoError(t, erk)
+
+	erk = gormkratos.NewTxManager(db).TransactionErk(context.Background(), func(ctx context.Context) *errors.Error {
+		return txm.TransactionErk(ctx, func(ctx context.Context) *errors.Error {
+			_, ok := gormkratos.TxFromContext(ctx, db)
+			require.True(t, ok)
+			return nil
+		})
+	})
+	erkrequire.NoError(t, erk)
+}
+
+// TestPropagationString tests propagation mode names
+// TestPropagationString 测试传播方式名称
+func TestPropagationString(t *testing.T) {
+	require.Equal(t, "REQUIRED", gormkratos.PropagationRequired.String())
+	require.Equal(t, "REQUIRES_NEW", gormkratos.PropagationRequiresNew.String())
+	require.Equal(t, "NESTED", gormkratos.PropagationNested.String())
+	require.Equal(t, "MANDATORY", gormkratos.PropagationMandatory.String())
+	require.Equal(t, "NEVER", gormkratos.PropagationNever.String())
+	require.Equal(t, "SUPPORTS", gormkratos.PropagationSupports.String())
+}
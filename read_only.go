@@ -0,0 +1,237 @@
+package gormkratos
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/orzkratos/gormkratos/api/dberrors/v1"
+	"github.com/yyle88/erero"
+	"gorm.io/gorm"
+)
+
+// ReadOnlyGuardPluginName is the GORM plugin name of the read-only guard
+// ReadOnlyGuardPluginName 是只读守卫的 GORM 插件名
+const ReadOnlyGuardPluginName = "gormkratos:read_only_guard"
+
+// writeKeywords are the leading keywords of raw statements that write
+// writeKeywords 是写入数据的原生语句的起始关键字
+var writeKeywords = []string{
+	"INSERT", "UPDATE", "DELETE", "REPLACE", "MERGE", "UPSERT",
+	"CREATE", "ALTER", "DROP", "TRUNCATE", "RENAME", "GRANT", "REVOKE",
+}
+
+// ReadOnlyGuardPlugin rejects write statements inside ReadOnlyTransaction, whether the driver supports read-only or not
+// Create, Update and Delete are rejected, Raw and Exec are rejected when the SQL starts with a write keyword
+// Register it with db.Use(gormkratos.NewReadOnlyGuardPlugin()) on startup, ReadOnlyTransaction requires it
+//
+// ReadOnlyGuardPlugin 拒绝 ReadOnlyTransaction 中的写语句, 无论驱动是否支持只读
+// 拒绝 Create, Update 和 Delete, 当 SQL 以写关键字开头时拒绝 Raw 和 Exec
+// 在服务启动时通过 db.Use(gormkratos.NewReadOnlyGuardPlugin()) 注册, ReadOnlyTransaction 依赖该插件
+type ReadOnlyGuardPlugin struct{}
+
+var _ gorm.Plugin = &ReadOnlyGuardPlugin{}
+
+// NewReadOnlyGuardPlugin creates read-only guard plugin
+//
+// NewReadOnlyGuardPlugin 创建只读守卫插件
+func NewReadOnlyGuardPlugin() *ReadOnlyGuardPlugin {
+	return &ReadOnlyGuardPlugin{}
+}
+
+// Name returns the GORM plugin name
+// Name 返回 GORM 插件名
+func (p *ReadOnlyGuardPlugin) Name() string {
+	return ReadOnlyGuardPluginName
+}
+
+// Initialize registers the guard before the create, update, delete, raw, query and row callbacks
+// Initialize 在 create, update, delete, raw, query 和 row 回调之前注册守卫
+func (p *ReadOnlyGuardPlugin) Initialize(db *gorm.DB) error {
+	callback := db.Callback()
+	if err := callback.Create().Before("gorm:begin_transaction").Register(ReadOnlyGuardPluginName+":create", guardWrite("create")); err != nil {
+		return erero.Wro(err)
+	}
+	if err := callback.Update().Before("gorm:begin_transaction").Register(ReadOnlyGuardPluginName+":update", guardWrite("update")); err != nil {
+		return erero.Wro(err)
+	}
+	if err := callback.Delete().Before("gorm:begin_transaction").Register(ReadOnlyGuardPluginName+":delete", guardWrite("delete")); err != nil {
+		return erero.Wro(err)
+	}
+	if err := callback.Raw().Before("gorm:raw").Register(ReadOnlyGuardPluginName+":raw", guardRawWrite); err != nil {
+		return erero.Wro(err)
+	}
+	if err := callback.Query().Before("gorm:query").Register(ReadOnlyGuardPluginName+":query", guardRawWrite); err != nil {
+		return erero.Wro(err)
+	}
+	if err := callback.Row().Before("gorm:row").Register(ReadOnlyGuardPluginName+":row", guardRawWrite); err != nil {
+		return erero.Wro(err)
+	}
+	return nil
+}
+
+// readOnlyKey carries the read-only state of ReadOnlyTransaction
+// readOnlyKey 携带 ReadOnlyTransaction 的只读状态
+type readOnlyKey struct{}
+
+// readOnlyState records the first write rejected inside the read-only transaction
+// readOnlyState 记录只读事务中首个被拒绝的写操作
+type readOnlyState struct {
+	mutex     sync.Mutex    // Guards violation // 保护 violation
+	violation *errors.Error // First rejected write // 首个被拒绝的写操作
+}
+
+// reject records and returns the Kratos error of the rejected write
+// reject 记录并返回被拒绝写操作的 Kratos 错误
+func (s *readOnlyState) reject(operation string, table string) *errors.Error {
+	erk := dberrors.ErrorServerDbReadOnlyViolation("%s on table %s in read-only transaction", operation, table)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.violation == nil {
+		s.violation = erk
+	}
+	return erk
+}
+
+// getViolation returns the first rejected write, nil when none
+// getViolation 返回首个被拒绝的写操作, 没有时为 nil
+func (s *readOnlyState) getViolation() *errors.Error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.violation
+}
+
+// IsReadOnly checks whether ctx belongs to ReadOnlyTransaction
+//
+// IsReadOnly 检查 ctx 是否属于 ReadOnlyTransaction
+func IsReadOnly(ctx context.Context) bool {
+	_, ok := ctx.Value(readOnlyKey{}).(*readOnlyState)
+	return ok
+}
+
+// guardWrite returns the callback rejecting the write operation inside read-only transactions
+// guardWrite 返回在只读事务中拒绝该写操作的回调
+func guardWrite(operation string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		if state, ok := db.Statement.Context.Value(readOnlyKey{}).(*readOnlyState); ok {
+			_ = db.AddError(state.reject(operation, db.Statement.Table))
+		}
+	}
+}
+
+// guardRawWrite rejects raw SQL writing inside read-only transactions, see rawWriteKeyword
+// guardRawWrite 在只读事务中拒绝写入数据的原生 SQL, 参见 rawWriteKeyword
+func guardRawWrite(db *gorm.DB) {
+	state, ok := db.Statement.Context.Value(readOnlyKey{}).(*readOnlyState)
+	if !ok {
+		return
+	}
+	if keyword := rawWriteKeyword(db.Statement.SQL.String()); keyword != "" {
+		_ = db.AddError(state.reject("raw "+strings.ToLower(keyword), db.Statement.Table))
+	}
+}
+
+// rawWriteKeyword returns the write keyword of raw SQL, empty when it reads
+// Comments and string literals are skipped, each statement separated by ; is checked
+// WITH statements are scanned for write keywords in any word, as the write follows the CTEs or sits inside them
+// Words in names match too, such CTEs are rejected, run them outside read-only transactions
+//
+// rawWriteKeyword 返回原生 SQL 的写关键字, 读取时为空
+// 跳过注释和字符串字面量, 检查以 ; 分隔的每条语句
+// WITH 语句扫描所有单词中的写关键字, 因为写操作位于 CTE 之后或其中
+// 名称中的单词同样会匹配, 这样的 CTE 会被拒绝, 请在只读事务之外执行
+func rawWriteKeyword(query string) string {
+	for _, statement := range strings.Split(stripSQLText(query), ";") {
+		words := strings.FieldsFunc(strings.ToUpper(statement), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+		})
+		if len(words) == 0 {
+			continue // Empty statement, or built by GORM later // 空语句, 或由 GORM 稍后构建
+		}
+		if words[0] != "WITH" {
+			words = words[:1]
+		}
+		for _, word := range words {
+			if slices.Contains(writeKeywords, word) {
+				return word
+			}
+		}
+	}
+	return ""
+}
+
+// stripSQLText replaces comments and string literals of query with spaces
+// stripSQLText 将 query 中的注释和字符串字面量替换为空格
+func stripSQLText(query string) string {
+	var builder strings.Builder
+	for idx := 0; idx < len(query); idx++ {
+		switch {
+		case strings.HasPrefix(query[idx:], "--"):
+			end := strings.IndexByte(query[idx:], '\n')
+			if end < 0 {
+				return builder.String()
+			}
+			idx += end
+		case strings.HasPrefix(query[idx:], "/*"):
+			end := strings.Index(query[idx+2:], "*/")
+			if end < 0 {
+				return builder.String()
+			}
+			idx += end + 3
+		case query[idx] == '\'':
+			// A doubled quote inside the literal ends it and starts a new one, the result is the same
+			// 字面量中的双写引号结束当前字面量并开始新的字面量, 结果相同
+			end := strings.IndexByte(query[idx+1:], '\'')
+			if end < 0 {
+				return builder.String()
+			}
+			idx += end + 1
+		default:
+			builder.WriteByte(query[idx])
+			continue
+		}
+		builder.WriteByte(' ')
+	}
+	return builder.String()
+}
+
+// ReadOnlyTransaction executes a function in read-only database transaction
+// Passes sql.TxOptions{ReadOnly: true} to the driver, keeping the isolation level of options
+// Writes inside are rejected with SERVER_DB_READ_ONLY_VIOLATION by ReadOnlyGuardPlugin, even when the driver ignores ReadOnly
+// Rejected writes roll back the transaction, even when run ignores the error
+// Only the statements of tx are guarded, AfterCommit and AfterRollback hooks may write with their ctx
+// Returns the same two errors as Transaction
+//
+// ReadOnlyTransaction 在只读数据库事务中执行函数
+// 向驱动传递 sql.TxOptions{ReadOnly: true}, 保留 options 中的隔离级别
+// 即使驱动忽略 ReadOnly, ReadOnlyGuardPlugin 也会以 SERVER_DB_READ_ONLY_VIOLATION 拒绝其中的写操作
+// 被拒绝的写操作导致事务回滚, 即使 run 忽略了该错误
+// 只守卫 tx 的语句, AfterCommit 和 AfterRollback 钩子可以使用其 ctx 写入
+// 返回与 Transaction 相同的两个错误
+func ReadOnlyTransaction(
+	ctx context.Context,
+	db *gorm.DB,
+	run func(db *gorm.DB) *errors.Error,
+	options ...*sql.TxOptions,
+) (erk *errors.Error, err error) {
+	if _, ok := db.Config.Plugins[ReadOnlyGuardPluginName]; !ok {
+		return nil, erero.New("read-only guard not registered, register it with db.Use(gormkratos.NewReadOnlyGuardPlugin())")
+	}
+	readOnlyOptions := &sql.TxOptions{ReadOnly: true}
+	if option := firstTxOptions(options); option != nil {
+		readOnlyOptions.Isolation = option.Isolation
+	}
+	state := &readOnlyState{}
+	return Transaction(ctx, db, func(db *gorm.DB) *errors.Error {
+		// Mark only the statements of the tx, hooks and observers get ctx as it is and may write after commit
+		// 只标记 tx 的语句, 钩子和观察者获得原样的 ctx, 可以在提交后写入
+		if erk := run(db.WithContext(context.WithValue(db.Statement.Context, readOnlyKey{}, state))); erk != nil {
+			return erk
+		}
+		return state.getViolation()
+	}, readOnlyOptions)
+}
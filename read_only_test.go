@@ -0,0 +1,179 @@
+package gormkratos_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/orzkratos/gormkratos"
+	"github.com/orzkratos/gormkratos/api/dberrors/v1"
+	"github.com/orzkratos/gormkratos/gormkratostest"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// Book is the model read in read-only transaction tests
+// Book 是只读事务测试中读取的模型
+type Book struct {
+	ID    uint   `gorm:"primaryKey"`
+	Title string `gorm:"not null"`
+}
+
+// setupReadOnlyDB creates database with the read-only guard and one book
+// setupReadOnlyDB 创建带只读守卫和一本书的数据库
+func setupReadOnlyDB(t *testing.T) *gorm.DB {
+	db := gormkratostest.NewDB(t, &Book{})
+	require.NoError(t, db.Use(gormkratos.NewReadOnlyGuardPlugin()))
+	require.NoError(t, db.Create(&Book{Title: "go"}).Error)
+	return db
+}
+
+// TestReadOnlyTransactionRead tests reads run inside read-only transactions
+// TestReadOnlyTransactionRead 测试只读事务中可以执行读操作
+func TestReadOnlyTransactionRead(t *testing.T) {
+	db := setupReadOnlyDB(t)
+
+	erk, err := gormkratos.ReadOnlyTransaction(context.Background(), db, func(db *gorm.DB) *errors.Error {
+		require.True(t, gormkratos.IsReadOnly(db.Statement.Context))
+
+		var books []*Book
+		require.NoError(t, db.Find(&books).Error)
+		require.Len(t, books, 1)
+
+		var count int64
+		require.NoError(t, db.Raw("SELECT count(*) FROM books").Scan(&count).Error)
+		require.NoError(t, db.Raw("WITH titles AS (SELECT title FROM books) SELECT count(*) FROM titles").Scan(&count).Error)
+		require.NoError(t, db.Raw("/* report */ SELECT count(*) FROM books WHERE title <> 'x; delete' -- update").Scan(&count).Error)
+		require.Equal(t, int64(1), count)
+		return nil
+	})
+	gormkratostest.RequireCommitted(t, erk, err)
+	require.False(t, gormkratos.IsReadOnly(context.Background()))
+}
+
+// TestReadOnlyTransactionWrite tests writes are rejected with SERVER_DB_READ_ONLY_VIOLATION
+// TestReadOnlyTransactionWrite 测试写操作以 SERVER_DB_READ_ONLY_VIOLATION 被拒绝
+func TestReadOnlyTransactionWrite(t *testing.T) {
+	db := setupReadOnlyDB(t)
+
+	writes := map[string]func(db *gorm.DB) error{
+		"create": func(db *gorm.DB) error { return db.Create(&Book{Title: "rust"}).Error },
+		"update": func(db *gorm.DB) error { return db.Model(&Book{}).Where("id = ?", 1).Update("title", "rust").Error },
+		"delete": func(db *gorm.DB) error { return db.Where("id = ?", 1).Delete(&Book{}).Error },
+		"exec":   func(db *gorm.DB) error { return db.Exec("DELETE FROM books").Error },
+		"raw": func(db *gorm.DB) error {
+			var books []*Book
+			return db.Raw("UPDATE books SET title = ? RETURNING *", "rust").Scan(&books).Error
+		},
+		"cte": func(db *gorm.DB) error {
+			return db.Exec("WITH old AS (SELECT id FROM books WHERE title = ?) DELETE FROM books WHERE id IN (SELECT id FROM old)", "go").Error
+		},
+		"cte-returning": func(db *gorm.DB) error {
+			var books []*Book
+			return db.Raw("WITH renamed AS (SELECT id FROM books) UPDATE books SET title = ? WHERE id IN (SELECT id FROM renamed) RETURNING *", "rust").Scan(&books).Error
+		},
+		"comment": func(db *gorm.DB) error {
+			return db.Exec("/* bulk */ INSERT INTO books (title) VALUES (?)", "rust").Error
+		},
+		"line-comment": func(db *gorm.DB) error {
+			return db.Exec("-- cleanup\nDELETE FROM books").Error
+		},
+		"multi-statement": func(db *gorm.DB) error {
+			return db.Exec("SELECT 1; INSERT INTO books (title) VALUES (?)", "rust").Error
+		},
+	}
+	for name, write := range writes {
+		t.Run(name, func(t *testing.T) {
+			erk, err := gormkratos.ReadOnlyTransaction(context.Background(), db, func(db *gorm.DB) *errors.Error {
+				err := write(db)
+				require.True(t, dberrors.IsServerDbReadOnlyViolation(err))
+				return errors.FromError(err)
+			})
+			gormkratostest.RequireRolledBack(t, erk, err)
+			gormkratostest.RequireErkReason(t, erk, dberrors.ErrorReason_SERVER_DB_READ_ONLY_VIOLATION.String())
+
+			var books []*Book
+			require.NoError(t, db.Find(&books).Error)
+			require.Len(t, books, 1)
+			require.Equal(t, "go", books[0].Title)
+		})
+	}
+}
+
+// TestReadOnlyTransactionIgnoredWrite tests rejected writes roll back even when run ignores the error
+// TestReadOnlyTransactionIgnoredWrite 测试即使 run 忽略错误, 被拒绝的写操作也会导致回滚
+func TestReadOnlyTransactionIgnoredWrite(t *testing.T) {
+	db := setupReadOnlyDB(t)
+
+	erk, err := gormkratos.ReadOnlyTransaction(context.Background(), db, func(db *gorm.DB) *errors.Error {
+		_ = db.Create(&Book{Title: "rust"}).Error
+		return nil
+	})
+	gormkratostest.RequireRolledBack(t, erk, err)
+	require.True(t, dberrors.IsServerDbReadOnlyViolation(erk))
+
+	var count int64
+	require.NoError(t, db.Model(&Book{}).Count(&count).Error)
+	require.Equal(t, int64(1), count)
+}
+
+// TestReadOnlyTransactionOutside tests writes outside read-only transactions are not affected
+// TestReadOnlyTransactionOutside 测试只读事务之外的写操作不受影响
+func TestReadOnlyTransactionOutside(t *testing.T) {
+	db := setupReadOnlyDB(t)
+	require.NoError(t, db.Use(gormkratos.NewCommitMarkerPlugin(gormkratos.NewCommitMarkerConfig())))
+
+	erk, err := gormkratos.Transaction(context.Background(), db, func(db *gorm.DB) *errors.Error {
+		require.NoError(t, db.Create(&Book{Title: "rust"}).Error)
+		require.NoError(t, db.Exec("UPDATE books SET title = ? WHERE title = ?", "zig", "go").Error)
+		return nil
+	})
+	gormkratostest.RequireCommitted(t, erk, err)
+
+	// Read-only transactions write no commit marker
+	// 只读事务不写入提交标记
+	erk, err = gormkratos.ReadOnlyTransaction(context.Background(), db, func(db *gorm.DB) *errors.Error {
+		return nil
+	})
+	gormkratostest.RequireCommitted(t, erk, err)
+
+	var count int64
+	require.NoError(t, db.Model(&gormkratos.CommitMarker{}).Count(&count).Error)
+	require.Equal(t, int64(1), count)
+}
+
+// TestReadOnlyTransactionNotRegistered tests the guard plugin is required
+// TestReadOnlyTransactionAfterCommit tests hooks after read-only transactions can write with their ctx
+// TestReadOnlyTransactionAfterCommit 测试只读事务之后的钩子可以使用其 ctx 写入
+func TestReadOnlyTransactionAfterCommit(t *testing.T) {
+	db := setupReadOnlyDB(t)
+
+	var hookErr error
+	erk, err := gormkratos.ReadOnlyTransaction(context.Background(), db, func(tx *gorm.DB) *errors.Error {
+		gormkratos.AfterCommit(tx.Statement.Context, func(ctx context.Context) {
+			require.False(t, gormkratos.IsReadOnly(ctx))
+			hookErr = db.WithContext(ctx).Create(&Book{Title: "audit"}).Error
+		})
+		return nil
+	})
+	gormkratostest.RequireCommitted(t, erk, err)
+	require.NoError(t, hookErr)
+
+	var count int64
+	require.NoError(t, db.Model(&Book{}).Count(&count).Error)
+	require.Equal(t, int64(2), count)
+}
+
+// TestReadOnlyTransactionNotRegistered 测试必须注册守卫插件
+func TestReadOnlyTransactionNotRegistered(t *testing.T) {
+	db := gormkratostest.NewDB(t, &Book{})
+
+	var runs int
+	erk, err := gormkratos.ReadOnlyTransaction(context.Background(), db, func(db *gorm.DB) *errors.Error {
+		runs++
+		return nil
+	})
+	require.Nil(t, erk)
+	require.Error(t, err)
+	require.Equal(t, 0, runs)
+}
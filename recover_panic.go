@@ -0,0 +1,101 @@
+package gormkratos
+
+import (
+	"fmt"
+	"maps"
+	"runtime/debug"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/orzkratos/gormkratos/api/dberrors/v1"
+)
+
+// PanicMetadataKey is the metadata key holding the recovered panic value
+// PanicMetadataKey 是保存捕获的 panic 值的 metadata 键
+const PanicMetadataKey = "panic"
+
+// PanicTranslator converts recovered panic values into Kratos errors
+//
+// PanicTranslator 将捕获的 panic 值转换为 Kratos 错误
+type PanicTranslator func(value any) *errors.Error
+
+// defaultPanicTranslator converts panics into UNKNOWN 500 errors
+// defaultPanicTranslator 将 panic 转换为 UNKNOWN 500 错误
+func defaultPanicTranslator(value any) *errors.Error {
+	return dberrors.ErrorUnknown("transaction panic: %v", value)
+}
+
+// SetPanicTranslator sets the translator used when run panics, passing nil restores the default translator
+//
+// SetPanicTranslator 设置 run 发生 panic 时使用的转换函数, 传 nil 恢复默认转换函数
+func SetPanicTranslator(translator PanicTranslator) {
+	if translator == nil {
+		translator = defaultPanicTranslator
+	}
+	defaultConfig.mutex.Lock()
+	defer defaultConfig.mutex.Unlock()
+	defaultConfig.PanicTranslator = translator
+}
+
+// GetPanicTranslator returns the current panic translator
+//
+// GetPanicTranslator 返回当前的 panic 转换函数
+func GetPanicTranslator() PanicTranslator {
+	defaultConfig.mutex.RLock()
+	defer defaultConfig.mutex.RUnlock()
+	return defaultConfig.PanicTranslator
+}
+
+// PanicError is the cause of Kratos errors converted from panics, holding the panic value and stack
+// The stack stays in the cause, not in metadata, so it is not sent to clients
+//
+// PanicError 是由 panic 转换的 Kratos 错误的 cause, 保存 panic 值和堆栈
+// 堆栈保存在 cause 而非 metadata 中, 因此不会发送给客户端
+type PanicError struct {
+	Value any    // Recovered panic value // 捕获的 panic 值
+	Stack []byte // Stack trace where the panic happened // panic 发生时的堆栈
+}
+
+// Error returns the panic value and stack as text
+// Error 以文本形式返回 panic 值和堆栈
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v\n%s", e.Value, e.Stack)
+}
+
+// Unwrap returns the panic value when it is an error
+// Unwrap 当 panic 值是错误时返回该错误
+func (e *PanicError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+	return nil
+}
+
+// RecoverPanic wraps run to recover panics into Kratos errors
+// The returned business error makes the transaction roll back, instead of the panic crashing the request
+// Use it with Transaction as gormkratos.Transaction(ctx, db, gormkratos.RecoverPanic(run))
+//
+// RecoverPanic 包装 run, 将 panic 捕获为 Kratos 错误
+// 返回的业务错误使事务回滚, 而不是让 panic 导致请求崩溃
+// 与 Transaction 搭配使用: gormkratos.Transaction(ctx, db, gormkratos.RecoverPanic(run))
+func RecoverPanic[T any](run func(T) *errors.Error) func(T) *errors.Error {
+	return func(arg T) (erk *errors.Error) {
+		defer func() {
+			if value := recover(); value != nil {
+				erk = newPanicErk(value, debug.Stack())
+			}
+		}()
+		return run(arg)
+	}
+}
+
+// newPanicErk converts panic value into Kratos error with the value in metadata and the stack in cause
+// newPanicErk 将 panic 值转换为 Kratos 错误, 值放在 metadata 中, 堆栈放在 cause 中
+func newPanicErk(value any, stack []byte) *errors.Error {
+	erk := GetPanicTranslator()(value)
+	metadata := maps.Clone(erk.Metadata)
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	metadata[PanicMetadataKey] = fmt.Sprint(value)
+	return erk.WithMetadata(metadata).WithCause(&PanicError{Value: value, Stack: stack})
+}
@@ -0,0 +1,86 @@
+package gormkratos_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/orzkratos/errkratos/must/erkrequire"
+	"github.com/orzkratos/gormkratos"
+	"github.com/orzkratos/gormkratos/api/dberrors/v1"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/erero"
+	"gorm.io/gorm"
+)
+
+// TestRecoverPanic tests panics in run become Kratos errors and the transaction rolls back
+// TestRecoverPanic 测试 run 中的 panic 转换为 Kratos 错误且事务回滚
+func TestRecoverPanic(t *testing.T) {
+	db, repo := setupOrderRepo(t)
+	ctx := context.Background()
+
+	erk, err := gormkratos.Transaction(ctx, db, gormkratos.RecoverPanic(func(db *gorm.DB) *errors.Error {
+		require.NoError(t, db.Create(&Order{Name: "panic"}).Error)
+		panic("something wrong")
+	}))
+	require.Error(t, err)
+	erkrequire.Error(t, erk)
+	require.True(t, dberrors.IsUnknown(erk))
+	require.Equal(t, "something wrong", erk.Metadata[gormkratos.PanicMetadataKey])
+
+	var panicErr *gormkratos.PanicError
+	require.True(t, errors.As(erk, &panicErr))
+	require.Equal(t, "something wrong", panicErr.Value)
+	require.Contains(t, string(panicErr.Stack), "TestRecoverPanic")
+
+	require.Equal(t, int64(0), repo.Count(ctx))
+}
+
+// TestRecoverPanicErrorValue tests panic values of error type stay reachable through the cause chain
+// TestRecoverPanicErrorValue 测试错误类型的 panic 值可以通过 cause 链访问
+func TestRecoverPanicErrorValue(t *testing.T) {
+	db := setupTestDB(t)
+	cause := erero.New("panic cause")
+
+	erk, err := gormkratos.Transaction(context.Background(), db, gormkratos.RecoverPanic(func(db *gorm.DB) *errors.Error {
+		panic(cause)
+	}))
+	require.Error(t, err)
+	require.True(t, errors.Is(erk, cause))
+}
+
+// TestTxManagerRecoverPanic tests the manager option recovering panics
+// TestTxManagerRecoverPanic 测试管理器的 panic 捕获选项
+func TestTxManagerRecoverPanic(t *testing.T) {
+	db, repo := setupOrderRepo(t)
+	txm := gormkratos.NewTxManager(db).WithRecoverPanic()
+
+	erk := txm.TransactionErk(context.Background(), func(ctx context.Context) *errors.Error {
+		erkrequire.NoError(t, repo.Create(ctx, "panic"))
+		var orders map[string]*Order
+		orders["x"].Name = "nil map" // Runtime panic // 运行时 panic
+		return nil
+	})
+	require.True(t, dberrors.IsUnknown(erk))
+	require.Equal(t, int64(0), repo.Count(context.Background()))
+}
+
+// TestSetPanicTranslator tests plugging in a custom panic translator
+// TestSetPanicTranslator 测试接入自定义 panic 转换函数
+func TestSetPanicTranslator(t *testing.T) {
+	gormkratos.SetPanicTranslator(func(value any) *errors.Error {
+		return errors.InternalServer("CUSTOM_PANIC", "service crashed").WithMetadata(map[string]string{"service": "demo"})
+	})
+	t.Cleanup(func() {
+		gormkratos.SetPanicTranslator(nil) // Restore default // 恢复默认
+	})
+
+	db := setupTestDB(t)
+	erk, err := gormkratos.Transaction(context.Background(), db, gormkratos.RecoverPanic(func(db *gorm.DB) *errors.Error {
+		panic(123)
+	}))
+	require.Error(t, err)
+	require.Equal(t, "CUSTOM_PANIC", erk.Reason)
+	require.Equal(t, "demo", erk.Metadata["service"])
+	require.Equal(t, "123", erk.Metadata[gormkratos.PanicMetadataKey])
+}
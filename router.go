@@ -0,0 +1,235 @@
+package gormkratos
+
+import (
+	"context"
+	"database/sql"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/yyle88/erero"
+	"gorm.io/gorm"
+)
+
+// RouterConfig configures the primary/replica router
+//
+// RouterConfig 配置主库/从库路由
+type RouterConfig struct {
+	StickyWindow        time.Duration // Reads go to the primary within this time after a write, see WithReadYourWrites // 写入后在该时间内读取走主库, 参见 WithReadYourWrites
+	HealthCheckInterval time.Duration // Wait time between replica health checks in RunHealthCheck // RunHealthCheck 中从库健康检查的间隔
+	PingTimeout         time.Duration // Timeout of one replica ping // 单次 ping 从库的超时时间
+}
+
+// NewRouterConfig creates router config with defaults
+// Default: 5s sticky window, 5s health check interval, 1s ping timeout
+//
+// NewRouterConfig 创建带默认值的路由配置
+// 默认: 5s 粘滞窗口, 5s 健康检查间隔, 1s ping 超时
+func NewRouterConfig() *RouterConfig {
+	return &RouterConfig{
+		StickyWindow:        5 * time.Second,
+		HealthCheckInterval: 5 * time.Second,
+		PingTimeout:         time.Second,
+	}
+}
+
+// WithStickyWindow sets how long reads go to the primary after a write
+// WithStickyWindow 设置写入后读取走主库的时长
+func (c *RouterConfig) WithStickyWindow(stickyWindow time.Duration) *RouterConfig {
+	c.StickyWindow = stickyWindow
+	return c
+}
+
+// WithHealthCheck sets the interval and ping timeout of replica health checks
+// WithHealthCheck 设置从库健康检查的间隔和 ping 超时
+func (c *RouterConfig) WithHealthCheck(interval time.Duration, pingTimeout time.Duration) *RouterConfig {
+	c.HealthCheckInterval = interval
+	c.PingTimeout = pingTimeout
+	return c
+}
+
+// replica is one replica database with its health
+// replica 是一个从库及其健康状态
+type replica struct {
+	db      *gorm.DB
+	healthy atomic.Bool
+}
+
+// Router routes read-only transactions to healthy replicas and write transactions to the primary
+// Replicas with broken connections are marked unhealthy and the read falls back to the primary, health checks bring them back
+// Register ReadOnlyGuardPlugin on the primary and the replicas, reads run with ReadOnlyTransaction
+//
+// Router 将只读事务路由到健康的从库, 将写事务路由到主库
+// 连接断开的从库被标记为不健康, 读取回退到主库, 健康检查将其恢复
+// 在主库和从库上注册 ReadOnlyGuardPlugin, 读取通过 ReadOnlyTransaction 执行
+type Router struct {
+	primary  *gorm.DB
+	replicas []*replica
+	next     atomic.Uint64 // Round-robin cursor of replicas // 从库轮询游标
+	config   *RouterConfig
+}
+
+// NewRouter creates router on the primary and the replicas, all replicas start healthy
+// Without replicas, every transaction goes to the primary
+//
+// NewRouter 基于主库和从库创建路由, 所有从库初始为健康
+// 没有从库时, 所有事务都走主库
+func NewRouter(primary *gorm.DB, replicas []*gorm.DB, config *RouterConfig) *Router {
+	router := &Router{primary: primary, config: config}
+	for _, db := range replicas {
+		item := &replica{db: db}
+		item.healthy.Store(true)
+		router.replicas = append(router.replicas, item)
+	}
+	return router
+}
+
+// Primary returns the primary database
+// Primary 返回主库
+func (r *Router) Primary() *gorm.DB {
+	return r.primary
+}
+
+// Transaction executes a function in database transaction on the primary
+// Options with ReadOnly route to ReadOnlyTransaction of the router
+// Committed writes start the sticky window of ctx prepared by WithReadYourWrites
+// Returns the same two errors as the package-level Transaction
+//
+// Transaction 在主库的数据库事务中执行函数
+// 选项带 ReadOnly 时路由到 Router 的 ReadOnlyTransaction
+// 已提交的写入会开启 WithReadYourWrites 准备的 ctx 的粘滞窗口
+// 返回与包级别 Transaction 相同的两个错误
+func (r *Router) Transaction(
+	ctx context.Context,
+	run func(db *gorm.DB) *errors.Error,
+	options ...*sql.TxOptions,
+) (erk *errors.Error, err error) {
+	if option := firstTxOptions(options); option != nil && option.ReadOnly {
+		return r.ReadOnlyTransaction(ctx, run, options...)
+	}
+	if erk, err = Transaction(ctx, r.primary, run, options...); err != nil {
+		return erk, err
+	}
+	markWritten(ctx)
+	return nil, nil
+}
+
+// ReadOnlyTransaction executes a function in read-only database transaction on a healthy replica
+// Uses the primary when no replica is healthy or ctx is within the sticky window of a write
+// When the connection to the replica is broken, marks it unhealthy and runs again on the primary
+// Other errors, such as SQL errors and business errors, are returned unchanged
+// Returns the same two errors as the package-level ReadOnlyTransaction
+//
+// ReadOnlyTransaction 在健康从库的只读数据库事务中执行函数
+// 没有健康的从库或 ctx 处于写入后的粘滞窗口时使用主库
+// 与从库的连接断开时, 将其标记为不健康并在主库上重新执行
+// 其他错误, 例如 SQL 错误和业务错误, 原样返回
+// 返回与包级别 ReadOnlyTransaction 相同的两个错误
+func (r *Router) ReadOnlyTransaction(
+	ctx context.Context,
+	run func(db *gorm.DB) *errors.Error,
+	options ...*sql.TxOptions,
+) (erk *errors.Error, err error) {
+	item := r.pickReplica(ctx)
+	if item == nil {
+		return ReadOnlyTransaction(ctx, r.primary, run, options...)
+	}
+	if erk, err = ReadOnlyTransaction(ctx, item.db, run, options...); erk != nil || !isConnectionBroken(err) || ctx.Err() != nil {
+		return erk, err
+	}
+	// Reads are safe to run again, fall back to the primary
+	// 读取可以安全地重新执行, 回退到主库
+	item.healthy.Store(false)
+	return ReadOnlyTransaction(ctx, r.primary, run, options...)
+}
+
+// pickReplica returns the next healthy replica, nil when reads should go to the primary
+// pickReplica 返回下一个健康的从库, 读取应走主库时返回 nil
+func (r *Router) pickReplica(ctx context.Context) *replica {
+	if len(r.replicas) == 0 || isSticky(ctx, r.config.StickyWindow) {
+		return nil
+	}
+	start := r.next.Add(1)
+	for idx := range r.replicas {
+		item := r.replicas[(start+uint64(idx))%uint64(len(r.replicas))]
+		if item.healthy.Load() {
+			return item
+		}
+	}
+	return nil
+}
+
+// CheckHealth pings every replica and updates its health, returns the count of healthy replicas
+//
+// CheckHealth ping 每个从库并更新其健康状态, 返回健康从库的数量
+func (r *Router) CheckHealth(ctx context.Context) int {
+	var healthy int
+	for _, item := range r.replicas {
+		err := r.ping(ctx, item.db)
+		item.healthy.Store(err == nil)
+		if err == nil {
+			healthy++
+		}
+	}
+	return healthy
+}
+
+// RunHealthCheck checks replica health at the interval until ctx is done
+//
+// RunHealthCheck 按间隔检查从库健康状态, 直到 ctx 结束
+func (r *Router) RunHealthCheck(ctx context.Context) error {
+	for {
+		r.CheckHealth(ctx)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(r.config.HealthCheckInterval):
+		}
+	}
+}
+
+// ping pings the database within the ping timeout
+// ping 在 ping 超时时间内 ping 数据库
+func (r *Router) ping(ctx context.Context, db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return erero.Wro(err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.config.PingTimeout)
+	defer cancel()
+	if err := sqlDB.PingContext(ctx); err != nil {
+		return erero.Wro(err)
+	}
+	return nil
+}
+
+// readYourWritesKey carries the time of the last write in the request
+// readYourWritesKey 携带请求中最近一次写入的时间
+type readYourWritesKey struct{}
+
+// WithReadYourWrites returns a copy of ctx tracking writes of Router, call it once per request
+// Reads with the returned ctx go to the primary within the sticky window after a write
+//
+// WithReadYourWrites 返回跟踪 Router 写入的 ctx 副本, 每个请求调用一次
+// 使用返回的 ctx 读取时, 写入后的粘滞窗口内走主库
+func WithReadYourWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readYourWritesKey{}, &atomic.Int64{})
+}
+
+// markWritten records the write time in ctx prepared by WithReadYourWrites
+// markWritten 在 WithReadYourWrites 准备的 ctx 中记录写入时间
+func markWritten(ctx context.Context) {
+	if lastWrite, ok := ctx.Value(readYourWritesKey{}).(*atomic.Int64); ok {
+		lastWrite.Store(time.Now().UnixNano())
+	}
+}
+
+// isSticky checks whether ctx is within the sticky window of a write
+// isSticky 检查 ctx 是否处于写入后的粘滞窗口内
+func isSticky(ctx context.Context, window time.Duration) bool {
+	lastWrite, ok := ctx.Value(readYourWritesKey{}).(*atomic.Int64)
+	if !ok || lastWrite.Load() == 0 {
+		return false
+	}
+	return time.Since(time.Unix(0, lastWrite.Load())) < window
+}
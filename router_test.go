@@ -0,0 +1,174 @@
+package gormkratos_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/orzkratos/gormkratos"
+	"github.com/orzkratos/gormkratos/gormkratostest"
+	"github.com/orzkratos/gormkratos/internal/errorspb"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/erero"
+	"gorm.io/gorm"
+)
+
+// setupRouterDB creates database with the read-only guard and one book titled with its role
+// setupRouterDB 创建带只读守卫和一本以角色命名的书的数据库
+func setupRouterDB(t *testing.T, db *gorm.DB, role string) *gorm.DB {
+	require.NoError(t, db.Use(gormkratos.NewReadOnlyGuardPlugin()))
+	require.NoError(t, db.Create(&Book{Title: role}).Error)
+	return db
+}
+
+// readRole reads the title of the first book, telling which database served the read
+// readRole 读取第一本书的标题, 用以区分哪个数据库执行了读取
+func readRole(t *testing.T, ctx context.Context, router *gormkratos.Router) string {
+	var book Book
+	erk, err := router.ReadOnlyTransaction(ctx, func(db *gorm.DB) *errors.Error {
+		require.NoError(t, db.First(&book).Error)
+		return nil
+	})
+	gormkratostest.RequireCommitted(t, erk, err)
+	return book.Title
+}
+
+// TestRouterReadWrite tests reads go to the replica and writes go to the primary
+// TestRouterReadWrite 测试读取走从库, 写入走主库
+func TestRouterReadWrite(t *testing.T) {
+	primary := setupRouterDB(t, gormkratostest.NewDB(t, &Book{}), "primary")
+	replica := setupRouterDB(t, gormkratostest.NewDB(t, &Book{}), "replica")
+	router := gormkratos.NewRouter(primary, []*gorm.DB{replica}, gormkratos.NewRouterConfig())
+
+	require.Equal(t, "replica", readRole(t, context.Background(), router))
+
+	erk, err := router.Transaction(context.Background(), func(db *gorm.DB) *errors.Error {
+		require.NoError(t, db.Create(&Book{Title: "written"}).Error)
+		return nil
+	})
+	gormkratostest.RequireCommitted(t, erk, err)
+
+	var count int64
+	require.NoError(t, primary.Model(&Book{}).Count(&count).Error)
+	require.Equal(t, int64(2), count)
+	require.NoError(t, replica.Model(&Book{}).Count(&count).Error)
+	require.Equal(t, int64(1), count)
+
+	// ReadOnly options route to the replica too
+	// ReadOnly 选项同样路由到从库
+	var book Book
+	erk, err = router.Transaction(context.Background(), func(db *gorm.DB) *errors.Error {
+		require.NoError(t, db.First(&book).Error)
+		return nil
+	}, &sql.TxOptions{ReadOnly: true})
+	gormkratostest.RequireCommitted(t, erk, err)
+	require.Equal(t, "replica", book.Title)
+}
+
+// TestRouterFallback tests failed replicas fall back to the primary until health checks pass
+// TestRouterFallback 测试失败的从库回退到主库, 直到健康检查通过
+func TestRouterFallback(t *testing.T) {
+	primary := setupRouterDB(t, gormkratostest.NewDB(t, &Book{}), "primary")
+	replicaDB, faults := gormkratostest.NewFaultDB(t, &Book{})
+	replica := setupRouterDB(t, replicaDB, "replica")
+	router := gormkratos.NewRouter(primary, []*gorm.DB{replica}, gormkratos.NewRouterConfig())
+
+	faults.FailBegin(driver.ErrBadConn)
+	require.Equal(t, "primary", readRole(t, context.Background(), router))
+
+	// Marked unhealthy, reads stay on the primary
+	// 已标记为不健康, 读取继续走主库
+	require.Equal(t, "primary", readRole(t, context.Background(), router))
+
+	require.Equal(t, 1, router.CheckHealth(context.Background()))
+	require.Equal(t, "replica", readRole(t, context.Background(), router))
+}
+
+// TestRouterNoFallback tests errors other than broken connections are returned without falling back to the primary
+// TestRouterNoFallback 测试连接断开以外的错误原样返回, 不回退到主库
+func TestRouterNoFallback(t *testing.T) {
+	primary := setupRouterDB(t, gormkratostest.NewDB(t, &Book{}), "primary")
+
+	// Read-only guard not registered on the replica
+	// 从库未注册只读守卫
+	unguarded := gormkratostest.NewDB(t, &Book{})
+	router := gormkratos.NewRouter(primary, []*gorm.DB{unguarded}, gormkratos.NewRouterConfig())
+	erk, err := router.ReadOnlyTransaction(context.Background(), func(db *gorm.DB) *errors.Error {
+		return nil
+	})
+	require.Nil(t, erk)
+	require.ErrorContains(t, err, "read-only guard not registered")
+
+	// Definite COMMIT failure on the replica
+	// 从库上确定的提交失败
+	replicaDB, faults := gormkratostest.NewFaultDB(t, &Book{})
+	replica := setupRouterDB(t, replicaDB, "replica")
+	router = gormkratos.NewRouter(primary, []*gorm.DB{replica}, gormkratos.NewRouterConfig())
+	cause := erero.New("commit rejected")
+	faults.FailCommit(cause)
+	var runs int
+	erk, err = router.ReadOnlyTransaction(context.Background(), func(db *gorm.DB) *errors.Error {
+		runs++
+		return nil
+	})
+	require.Nil(t, erk)
+	require.ErrorIs(t, err, cause)
+	require.Equal(t, 1, runs)
+
+	// The replica stays healthy
+	// 从库保持健康
+	require.Equal(t, "replica", readRole(t, context.Background(), router))
+}
+
+// TestRouterCheckHealth tests replicas failing the ping are skipped
+// TestRouterCheckHealth 测试 ping 失败的从库被跳过
+func TestRouterCheckHealth(t *testing.T) {
+	primary := setupRouterDB(t, gormkratostest.NewDB(t, &Book{}), "primary")
+	closed := setupRouterDB(t, gormkratostest.NewDB(t, &Book{}), "closed")
+	replica := setupRouterDB(t, gormkratostest.NewDB(t, &Book{}), "replica")
+	router := gormkratos.NewRouter(primary, []*gorm.DB{closed, replica}, gormkratos.NewRouterConfig())
+
+	sqlDB, err := closed.DB()
+	require.NoError(t, err)
+	require.NoError(t, sqlDB.Close())
+
+	require.Equal(t, 1, router.CheckHealth(context.Background()))
+	for range 3 {
+		require.Equal(t, "replica", readRole(t, context.Background(), router))
+	}
+}
+
+// TestRouterReadYourWrites tests reads go to the primary within the sticky window after a write
+// TestRouterReadYourWrites 测试写入后的粘滞窗口内读取走主库
+func TestRouterReadYourWrites(t *testing.T) {
+	primary := setupRouterDB(t, gormkratostest.NewDB(t, &Book{}), "primary")
+	replica := setupRouterDB(t, gormkratostest.NewDB(t, &Book{}), "replica")
+	router := gormkratos.NewRouter(primary, []*gorm.DB{replica}, gormkratos.NewRouterConfig().WithStickyWindow(100*time.Millisecond))
+
+	ctx := gormkratos.WithReadYourWrites(context.Background())
+	require.Equal(t, "replica", readRole(t, ctx, router))
+
+	erk, err := router.Transaction(ctx, func(db *gorm.DB) *errors.Error {
+		return nil
+	})
+	gormkratostest.RequireCommitted(t, erk, err)
+	require.Equal(t, "primary", readRole(t, ctx, router))
+
+	// Other requests are not sticky
+	// 其他请求不受粘滞影响
+	require.Equal(t, "replica", readRole(t, context.Background(), router))
+
+	time.Sleep(150 * time.Millisecond)
+	require.Equal(t, "replica", readRole(t, ctx, router))
+
+	// Rolled back writes are not sticky
+	// 回滚的写入不会开启粘滞窗口
+	erk, err = router.Transaction(ctx, func(db *gorm.DB) *errors.Error {
+		return errorspb.ErrorBadRequest("validation failed")
+	})
+	gormkratostest.RequireRolledBack(t, erk, err)
+	require.Equal(t, "replica", readRole(t, ctx, router))
+}
@@ -0,0 +1,149 @@
+package gormkratos
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/orzkratos/gormkratos/api/dberrors/v1"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LockStrength is the strength of row locks
+//
+// LockStrength 是行锁的强度
+type LockStrength string
+
+const (
+	LockForUpdate LockStrength = clause.LockingStrengthUpdate // SELECT ... FOR UPDATE, exclusive // 排他锁
+	LockForShare  LockStrength = clause.LockingStrengthShare  // SELECT ... FOR SHARE, shared // 共享锁
+)
+
+// LockWait is the behavior when rows are locked by others
+//
+// LockWait 是行已被他人锁定时的行为
+type LockWait string
+
+const (
+	LockWaitDefault LockWait = ""                              // Wait up to the lock timeout // 最多等待锁超时时间
+	LockNoWait      LockWait = clause.LockingOptionsNoWait     // Fail at once with SERVER_DB_LOCK_TIMEOUT // 立即以 SERVER_DB_LOCK_TIMEOUT 失败
+	LockSkipLocked  LockWait = clause.LockingOptionsSkipLocked // Skip rows locked by others // 跳过被他人锁定的行
+)
+
+// LockConfig configures row locks
+//
+// LockConfig 配置行锁
+type LockConfig struct {
+	Strength LockStrength  // Lock strength // 锁强度
+	Wait     LockWait      // Behavior when rows are locked by others // 行已被他人锁定时的行为
+	Timeout  time.Duration // Lock wait timeout, 0 uses the database default // 锁等待超时时间, 0 使用数据库默认值
+}
+
+// NewLockConfig creates lock config of FOR UPDATE, waiting up to the database default timeout
+//
+// NewLockConfig 创建 FOR UPDATE 的锁配置, 最多等待数据库默认的超时时间
+func NewLockConfig() *LockConfig {
+	return &LockConfig{Strength: LockForUpdate, Wait: LockWaitDefault}
+}
+
+// WithShare uses FOR SHARE instead of FOR UPDATE
+// WithShare 使用 FOR SHARE 代替 FOR UPDATE
+func (c *LockConfig) WithShare() *LockConfig {
+	c.Strength = LockForShare
+	return c
+}
+
+// WithNoWait fails at once when rows are locked by others
+// WithNoWait 行已被他人锁定时立即失败
+func (c *LockConfig) WithNoWait() *LockConfig {
+	c.Wait = LockNoWait
+	return c
+}
+
+// WithSkipLocked skips rows locked by others
+// WithSkipLocked 跳过被他人锁定的行
+func (c *LockConfig) WithSkipLocked() *LockConfig {
+	c.Wait = LockSkipLocked
+	return c
+}
+
+// WithTimeout sets the lock wait timeout, MySQL rounds it up to seconds
+// WithTimeout 设置锁等待超时时间, MySQL 向上取整到秒
+func (c *LockConfig) WithTimeout(timeout time.Duration) *LockConfig {
+	c.Timeout = timeout
+	return c
+}
+
+// LockRows returns db whose queries lock the selected rows until the transaction ends, use it inside run with the tx
+// Postgres: FOR UPDATE / FOR SHARE with NOWAIT or SKIP LOCKED, the timeout runs SET LOCAL lock_timeout
+// SET LOCAL lasts until the transaction ends, so the timeout applies to every later statement in the transaction
+// MySQL: the same clauses, the timeout adds the SET_VAR(innodb_lock_wait_timeout) hint to the query
+// SQLite: no-op, SQLite locks the whole database on write, busy errors classify as lock timeout
+// Lock timeouts and NOWAIT failures translate into SERVER_DB_LOCK_TIMEOUT (503) with TranslateDbError, retry them with RetryConfig.WithRetryErk
+// Returns SERVER_DB_TRANSACTION_MANDATORY outside transactions, the locks would be released at once
+//
+// LockRows 返回查询时锁定所选行直到事务结束的 db, 在 run 中使用 tx 调用
+// Postgres: FOR UPDATE / FOR SHARE 以及 NOWAIT 或 SKIP LOCKED, 超时通过 SET LOCAL lock_timeout 设置
+// SET LOCAL 持续到事务结束, 因此超时作用于事务中之后的每条语句
+// MySQL: 相同的子句, 超时通过在查询中添加 SET_VAR(innodb_lock_wait_timeout) 提示设置
+// SQLite: 不做处理, SQLite 写入时锁定整个数据库, 忙错误归类为锁超时
+// 锁超时和 NOWAIT 失败通过 TranslateDbError 转换为 SERVER_DB_LOCK_TIMEOUT (503), 通过 RetryConfig.WithRetryErk 重试
+// 在事务之外返回 SERVER_DB_TRANSACTION_MANDATORY, 否则锁会立即释放
+func LockRows(db *gorm.DB, config *LockConfig) (*gorm.DB, *errors.Error) {
+	if _, ok := db.Statement.ConnPool.(gorm.TxCommitter); !ok {
+		return nil, dberrors.ErrorServerDbTransactionMandatory("row locks require a transaction")
+	}
+	switch db.Dialector.Name() {
+	case "sqlite":
+		return db, nil
+	case "postgres":
+		if config.Timeout > 0 && config.Wait == LockWaitDefault {
+			// SET does not take bind parameters, the value is an integer
+			// Runs on a new session, so the conditions of db are kept and its statement stays untouched
+			// SET 不支持绑定参数, 该值为整数
+			// 在新会话中执行, 保留 db 的条件且不改动其语句
+			if err := db.Session(&gorm.Session{NewDB: true}).Exec(fmt.Sprintf("SET LOCAL lock_timeout = %d", config.Timeout.Milliseconds())).Error; err != nil {
+				return nil, TranslateDbError(err)
+			}
+		}
+	case "mysql":
+		if config.Timeout > 0 && config.Wait == LockWaitDefault {
+			seconds := int64((config.Timeout + time.Second - 1) / time.Second)
+			db = db.Clauses(mysqlLockTimeoutHint{seconds: seconds})
+		}
+	}
+	return db.Clauses(clause.Locking{Strength: string(config.Strength), Options: string(config.Wait)}), nil
+}
+
+// FindLocked locks and loads the rows matching conds into dest, see LockRows
+// Database errors are converted with TranslateDbError, lock timeouts become SERVER_DB_LOCK_TIMEOUT
+//
+// FindLocked 锁定并加载符合 conds 的行到 dest, 参见 LockRows
+// 数据库错误通过 TranslateDbError 转换, 锁超时转换为 SERVER_DB_LOCK_TIMEOUT
+func FindLocked(db *gorm.DB, config *LockConfig, dest any, conds ...any) *errors.Error {
+	locked, erk := LockRows(db, config)
+	if erk != nil {
+		return erk
+	}
+	if err := locked.Find(dest, conds...).Error; err != nil {
+		return TranslateDbError(err)
+	}
+	return nil
+}
+
+// mysqlLockTimeoutHint adds the SET_VAR optimizer hint, the timeout applies to this query only
+// mysqlLockTimeoutHint 添加 SET_VAR 优化器提示, 超时只作用于本次查询
+type mysqlLockTimeoutHint struct {
+	seconds int64
+}
+
+var _ gorm.StatementModifier = mysqlLockTimeoutHint{}
+
+func (h mysqlLockTimeoutHint) ModifyStatement(stmt *gorm.Statement) {
+	selectClause := stmt.Clauses["SELECT"]
+	selectClause.AfterNameExpression = clause.Expr{SQL: fmt.Sprintf("/*+ SET_VAR(innodb_lock_wait_timeout=%d) */", h.seconds)}
+	stmt.Clauses["SELECT"] = selectClause
+}
+
+func (h mysqlLockTimeoutHint) Build(clause.Builder) {}
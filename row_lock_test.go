@@ -0,0 +1,235 @@
+package gormkratos_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/google/uuid"
+	"github.com/orzkratos/gormkratos"
+	"github.com/orzkratos/gormkratos/api/dberrors/v1"
+	"github.com/orzkratos/gormkratos/gormkratostest"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/erero"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// namedDialector is SQLite with another dialect name, rendering the lock clauses of that dialect without its server
+// namedDialector 是使用其他方言名称的 SQLite, 无需对应的服务即可生成该方言的锁子句
+type namedDialector struct {
+	gorm.Dialector
+	name string
+}
+
+func (d namedDialector) Name() string {
+	return d.name
+}
+
+func (d namedDialector) Initialize(db *gorm.DB) error {
+	if err := d.Dialector.Initialize(db); err != nil {
+		return err
+	}
+	// Render FOR clauses, the SQLite dialect drops them
+	// 生成 FOR 子句, SQLite 方言会丢弃它们
+	delete(db.ClauseBuilders, "FOR")
+	return nil
+}
+
+// sqlRecorder records the SQL of each statement, dry runs included
+// sqlRecorder 记录每条语句的 SQL, 包括试运行
+type sqlRecorder struct {
+	logger.Interface
+	statements []string
+}
+
+func (r *sqlRecorder) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	sql, _ := fc()
+	r.statements = append(r.statements, sql)
+}
+
+// setupNamedDB creates isolated in-memory SQLite database named as the dialect, recording the SQL
+// setupNamedDB 创建以该方言命名的独立内存 SQLite 数据库, 记录 SQL
+func setupNamedDB(t *testing.T, name string) (*gorm.DB, *sqlRecorder) {
+	dsn := fmt.Sprintf("file:db-%s?mode=memory&cache=shared", uuid.New().String())
+	recorder := &sqlRecorder{Interface: logger.Default}
+	db, err := gorm.Open(namedDialector{Dialector: sqlite.Open(dsn), name: name}, &gorm.Config{Logger: recorder})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, sqlDB.Close())
+	})
+	require.NoError(t, db.AutoMigrate(&Book{}))
+	return db, recorder
+}
+
+// lockedSQL returns the SQL of FindLocked with the config inside a transaction, without running it
+// lockedSQL 返回事务中使用该配置的 FindLocked 的 SQL, 不实际执行
+func lockedSQL(t *testing.T, db *gorm.DB, config *gormkratos.LockConfig) string {
+	var stmt string
+	erk, err := gormkratos.Transaction(context.Background(), db, func(db *gorm.DB) *errors.Error {
+		dry := db.Session(&gorm.Session{DryRun: true})
+		locked, erk := gormkratos.LockRows(dry, config)
+		require.Nil(t, erk)
+		var books []*Book
+		stmt = locked.Find(&books, 1).Statement.SQL.String()
+		return nil
+	})
+	gormkratostest.RequireCommitted(t, erk, err)
+	return stmt
+}
+
+// TestFindLocked tests SQLite locks are a no-op and the rows still load inside transactions
+// TestFindLocked 测试 SQLite 上的锁不做处理, 事务中依然可以加载行
+func TestFindLocked(t *testing.T) {
+	db := gormkratostest.NewDB(t, &Book{})
+	require.NoError(t, db.Create(&Book{Title: "go"}).Error)
+
+	erk, err := gormkratos.Transaction(context.Background(), db, func(db *gorm.DB) *errors.Error {
+		var books []*Book
+		if erk := gormkratos.FindLocked(db, gormkratos.NewLockConfig().WithNoWait(), &books, "title = ?", "go"); erk != nil {
+			return erk
+		}
+		require.Len(t, books, 1)
+		require.NoError(t, db.Model(books[0]).Update("title", "rust").Error)
+		return nil
+	})
+	gormkratostest.RequireCommitted(t, erk, err)
+
+	var book Book
+	require.NoError(t, db.First(&book).Error)
+	require.Equal(t, "rust", book.Title)
+}
+
+// TestFindLockedOutsideTransaction tests row locks outside transactions return SERVER_DB_TRANSACTION_MANDATORY
+// TestFindLockedOutsideTransaction 测试在事务之外加行锁返回 SERVER_DB_TRANSACTION_MANDATORY
+func TestFindLockedOutsideTransaction(t *testing.T) {
+	db := gormkratostest.NewDB(t, &Book{})
+
+	var books []*Book
+	erk := gormkratos.FindLocked(db, gormkratos.NewLockConfig(), &books)
+	require.True(t, dberrors.IsServerDbTransactionMandatory(erk))
+}
+
+// TestFindLockedTimeout tests lock wait timeouts return retryable SERVER_DB_LOCK_TIMEOUT
+// TestFindLockedTimeout 测试锁等待超时返回可重试的 SERVER_DB_LOCK_TIMEOUT
+func TestFindLockedTimeout(t *testing.T) {
+	db, faults := gormkratostest.NewFaultDB(t, &Book{})
+	faults.FailStatement("SELECT", erero.New("Error 1205 (HY000): Lock wait timeout exceeded; try restarting transaction"))
+
+	erk, err := gormkratos.Transaction(context.Background(), db, func(db *gorm.DB) *errors.Error {
+		var books []*Book
+		return gormkratos.FindLocked(db, gormkratos.NewLockConfig().WithTimeout(time.Second), &books)
+	})
+	gormkratostest.RequireRolledBack(t, erk, err)
+	require.True(t, dberrors.IsServerDbLockTimeout(erk))
+	require.Equal(t, int32(503), erk.Code)
+	require.True(t, gormkratos.IsRetryableError(err))
+}
+
+// TestLockTimeoutSQLite tests SQLite busy errors return SERVER_DB_LOCK_TIMEOUT
+// TestLockTimeoutSQLite 测试 SQLite 忙错误返回 SERVER_DB_LOCK_TIMEOUT
+func TestLockTimeoutSQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "books.db")
+	holder, err := gorm.Open(sqlite.Open(path), &gorm.Config{})
+	require.NoError(t, err)
+	waiter, err := gorm.Open(sqlite.Open(path+"?_busy_timeout=0"), &gorm.Config{})
+	require.NoError(t, err)
+	for _, db := range []*gorm.DB{holder, waiter} {
+		sqlDB, err := db.DB()
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			require.NoError(t, sqlDB.Close())
+		})
+	}
+	require.NoError(t, holder.AutoMigrate(&Book{}))
+	require.NoError(t, holder.Create(&Book{Title: "go"}).Error)
+
+	// Hold the write lock until the test ends
+	// 持有写锁直到测试结束
+	tx := holder.Begin()
+	require.NoError(t, tx.Error)
+	t.Cleanup(func() {
+		require.NoError(t, tx.Rollback().Error)
+	})
+	require.NoError(t, tx.Model(&Book{}).Where("title = ?", "go").Update("title", "rust").Error)
+
+	erk, err := gormkratos.Transaction(context.Background(), waiter, func(db *gorm.DB) *errors.Error {
+		var books []*Book
+		if erk := gormkratos.FindLocked(db, gormkratos.NewLockConfig(), &books); erk != nil {
+			return erk
+		}
+		return gormkratos.TranslateDbError(db.Model(books[0]).Update("title", "zig").Error)
+	})
+	gormkratostest.RequireRolledBack(t, erk, err)
+	require.True(t, dberrors.IsServerDbLockTimeout(erk), erk)
+	require.Equal(t, gormkratos.DbErrorLockTimeout, gormkratos.ClassifyDbError(err))
+}
+
+// TestLockRowsMySQL tests the MySQL lock clauses and the lock timeout hint
+// TestLockRowsMySQL 测试 MySQL 的锁子句和锁超时提示
+func TestLockRowsMySQL(t *testing.T) {
+	db, _ := setupNamedDB(t, "mysql")
+
+	require.Equal(t,
+		"SELECT /*+ SET_VAR(innodb_lock_wait_timeout=2) */ * FROM `books` WHERE `books`.`id` = ? FOR UPDATE",
+		lockedSQL(t, db, gormkratos.NewLockConfig().WithTimeout(1500*time.Millisecond)),
+	)
+	require.Equal(t,
+		"SELECT * FROM `books` WHERE `books`.`id` = ? FOR SHARE NOWAIT",
+		lockedSQL(t, db, gormkratos.NewLockConfig().WithShare().WithNoWait().WithTimeout(time.Second)),
+	)
+	require.Equal(t,
+		"SELECT * FROM `books` WHERE `books`.`id` = ? FOR UPDATE SKIP LOCKED",
+		lockedSQL(t, db, gormkratos.NewLockConfig().WithSkipLocked()),
+	)
+}
+
+// TestLockRowsPostgres tests the Postgres lock clauses and SET LOCAL lock_timeout
+// TestLockRowsPostgres 测试 Postgres 的锁子句和 SET LOCAL lock_timeout
+func TestLockRowsPostgres(t *testing.T) {
+	db, recorder := setupNamedDB(t, "postgres")
+
+	recorder.statements = nil
+	require.Equal(t,
+		"SELECT * FROM `books` WHERE `books`.`id` = ? FOR UPDATE",
+		lockedSQL(t, db, gormkratos.NewLockConfig().WithTimeout(1500*time.Millisecond)),
+	)
+	require.Contains(t, recorder.statements, "SET LOCAL lock_timeout = 1500")
+
+	// NOWAIT needs no timeout
+	// NOWAIT 不需要超时
+	recorder.statements = nil
+	require.Equal(t,
+		"SELECT * FROM `books` WHERE `books`.`id` = ? FOR SHARE NOWAIT",
+		lockedSQL(t, db, gormkratos.NewLockConfig().WithShare().WithNoWait().WithTimeout(time.Second)),
+	)
+	for _, statement := range recorder.statements {
+		require.NotContains(t, statement, "lock_timeout")
+	}
+}
+
+// TestFindLockedPostgresConditions tests the lock timeout keeps the conditions of the passed handle
+// TestFindLockedPostgresConditions 测试锁超时保留传入句柄的条件
+func TestFindLockedPostgresConditions(t *testing.T) {
+	db, recorder := setupNamedDB(t, "postgres")
+	require.NoError(t, db.Create(&Book{Title: "go"}).Error)
+	require.NoError(t, db.Create(&Book{Title: "rust"}).Error)
+
+	recorder.statements = nil
+	var books []*Book
+	erk, err := gormkratos.Transaction(context.Background(), db, func(db *gorm.DB) *errors.Error {
+		dry := db.Session(&gorm.Session{DryRun: true})
+		return gormkratos.FindLocked(dry.Where("title = ?", "go"), gormkratos.NewLockConfig().WithTimeout(time.Second), &books)
+	})
+	gormkratostest.RequireCommitted(t, erk, err)
+	require.Equal(t, []string{
+		"SET LOCAL lock_timeout = 1000",
+		"SELECT * FROM `books` WHERE title = \"go\" FOR UPDATE",
+	}, recorder.statements)
+}
@@ -0,0 +1,341 @@
+package saga
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/google/uuid"
+	"github.com/orzkratos/gormkratos"
+	"github.com/orzkratos/gormkratos/api/dberrors/v1"
+	"github.com/yyle88/erero"
+	"github.com/yyle88/zaplog"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// OrchestratorConfig configures the saga orchestrator
+//
+// OrchestratorConfig 配置 Saga 编排器
+type OrchestratorConfig struct {
+	PollInterval time.Duration // Wait time between resuming polls in Run // Run 中恢复轮询的间隔
+	LeaseTimeout time.Duration // Executing sagas become resumable after this time, also the timeout of one step // 执行中的 Saga 超过该时间后可被恢复, 也是单个步骤的超时时间
+	RetryDelay   time.Duration // Delay before retrying a failed compensation // 重试失败补偿前的等待时间
+	MaxAttempts  int           // Failed compensation attempts before the saga fails // Saga 失败前的补偿失败次数
+}
+
+// NewOrchestratorConfig creates orchestrator config with defaults
+// Default: 1s poll interval, 1m lease, 5s retry delay, 10 attempts
+//
+// NewOrchestratorConfig 创建带默认值的编排器配置
+// 默认: 1s 轮询间隔, 1m 租约, 5s 重试等待, 10 次尝试
+func NewOrchestratorConfig() *OrchestratorConfig {
+	return &OrchestratorConfig{
+		PollInterval: time.Second,
+		LeaseTimeout: time.Minute,
+		RetryDelay:   5 * time.Second,
+		MaxAttempts:  10,
+	}
+}
+
+// WithPollInterval sets the wait time between resuming polls
+// WithPollInterval 设置恢复轮询的间隔
+func (c *OrchestratorConfig) WithPollInterval(pollInterval time.Duration) *OrchestratorConfig {
+	c.PollInterval = pollInterval
+	return c
+}
+
+// WithLeaseTimeout sets the lease of executing sagas
+// WithLeaseTimeout 设置执行中 Saga 的租约时间
+func (c *OrchestratorConfig) WithLeaseTimeout(leaseTimeout time.Duration) *OrchestratorConfig {
+	c.LeaseTimeout = leaseTimeout
+	return c
+}
+
+// WithRetry sets the delay and max attempts of failed compensations
+// WithRetry 设置失败补偿的重试等待和最大尝试次数
+func (c *OrchestratorConfig) WithRetry(retryDelay time.Duration, maxAttempts int) *OrchestratorConfig {
+	c.RetryDelay = retryDelay
+	c.MaxAttempts = maxAttempts
+	return c
+}
+
+// Orchestrator starts sagas and drives them to completion or compensation
+// Every step commits together with the saga progress, so resumed sagas continue after the last committed step
+// Failed steps (erk or err) start compensating, failed compensations are retried until MaxAttempts
+//
+// Orchestrator 启动 Saga 并将其推进到完成或补偿完成
+// 每个步骤与 Saga 进度一起提交, 使恢复的 Saga 从最后提交的步骤之后继续
+// 失败的步骤 (erk 或 err) 开始补偿, 失败的补偿会重试直到 MaxAttempts
+type Orchestrator struct {
+	db          *gorm.DB
+	config      *OrchestratorConfig
+	definitions map[string]*Definition
+}
+
+// NewOrchestrator creates orchestrator of the database, register definitions with Register before use
+//
+// NewOrchestrator 创建该数据库的编排器, 使用前通过 Register 注册定义
+func NewOrchestrator(db *gorm.DB, config *OrchestratorConfig) *Orchestrator {
+	return &Orchestrator{db: db, config: config, definitions: map[string]*Definition{}}
+}
+
+// Register registers the saga definition, sagas of unregistered names are not resumed
+// Register 注册 Saga 定义, 未注册名称的 Saga 不会被恢复
+func (o *Orchestrator) Register(definition *Definition) *Orchestrator {
+	o.definitions[definition.name] = definition
+	return o
+}
+
+// Start creates the saga and executes it until completed, compensated or waiting for a compensation retry
+// The outcome is in the status of the returned saga, the error reports database failures only
+//
+// Start 创建 Saga 并执行, 直到完成, 补偿完成或等待补偿重试
+// 结果在返回 Saga 的状态中, 错误仅表示数据库故障
+func (o *Orchestrator) Start(ctx context.Context, name string, payload []byte) (*Saga, error) {
+	definition, ok := o.definitions[name]
+	if !ok {
+		return nil, erero.Errorf("saga %s is not registered", name)
+	}
+	now := time.Now().UTC()
+	saga := &Saga{
+		Name:       name,
+		Payload:    payload,
+		Status:     StatusRunning,
+		RunAt:      now.Add(o.config.LeaseTimeout),
+		LeaseToken: uuid.NewString(),
+		CreatedAt:  now,
+	}
+	if err := o.db.WithContext(ctx).Create(saga).Error; err != nil {
+		return nil, erero.Wro(err)
+	}
+	return saga, o.execute(ctx, definition, saga)
+}
+
+// Resume claims sagas left in flight or due for compensation retries and executes them, returns the count resumed
+// Call it at process start, Run calls it at the poll interval
+//
+// Resume 认领中断的或到期重试补偿的 Saga 并执行, 返回恢复的数量
+// 在进程启动时调用, Run 会按轮询间隔调用
+func (o *Orchestrator) Resume(ctx context.Context) (int, error) {
+	db := o.db.WithContext(ctx)
+	now := time.Now().UTC()
+
+	var candidates []*Saga
+	if err := due(db, now).Where("name IN ?", slices.Sorted(maps.Keys(o.definitions))).Order("run_at, id").Find(&candidates).Error; err != nil {
+		return 0, erero.Wro(err)
+	}
+
+	var resumed int
+	for _, saga := range candidates {
+		token := uuid.NewString()
+		until := now.Add(o.config.LeaseTimeout)
+		result := due(db.Model(&Saga{}), now).Where("id = ?", saga.ID).Updates(map[string]any{
+			"run_at":      until,
+			"lease_token": token,
+		})
+		if result.Error != nil {
+			return resumed, erero.Wro(result.Error)
+		}
+		if result.RowsAffected != 1 {
+			continue // Claimed by another orchestrator // 已被其它编排器认领
+		}
+		saga.RunAt = until
+		saga.LeaseToken = token
+		if err := o.execute(ctx, o.definitions[saga.Name], saga); err != nil {
+			return resumed, err
+		}
+		resumed++
+	}
+	return resumed, nil
+}
+
+// Run resumes sagas at the poll interval until ctx is done
+//
+// Run 按轮询间隔恢复 Saga, 直到 ctx 结束
+func (o *Orchestrator) Run(ctx context.Context) error {
+	for {
+		if _, err := o.Resume(ctx); err != nil && ctx.Err() == nil {
+			zaplog.LOG.Error("saga orchestrator failed", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(o.config.PollInterval):
+		}
+	}
+}
+
+// Get returns the saga by ID
+//
+// Get 按 ID 返回 Saga
+func (o *Orchestrator) Get(ctx context.Context, id uint64) (*Saga, error) {
+	var saga Saga
+	if err := o.db.WithContext(ctx).First(&saga, id).Error; err != nil {
+		return nil, erero.Wro(err)
+	}
+	return &saga, nil
+}
+
+// due filters executing sagas with expired leases and compensations due for retry
+// due 筛选租约已过期的执行中 Saga 和到期重试的补偿
+func due(db *gorm.DB, now time.Time) *gorm.DB {
+	return db.Where("status IN ? AND run_at <= ?", []Status{StatusRunning, StatusCompensating}, now)
+}
+
+// execute drives the leased saga forward and then through compensation, stops when the lease is lost
+// execute 推进已租用的 Saga 正向执行和补偿, 丢失租约时停止
+func (o *Orchestrator) execute(ctx context.Context, definition *Definition, saga *Saga) error {
+	for {
+		switch {
+		case saga.Status == StatusRunning && saga.Step < len(definition.steps):
+			current := definition.steps[saga.Step]
+			lost, err := o.runStep(ctx, saga, current.action, saga.Step+1)
+			if lost {
+				return nil
+			}
+			if err != nil {
+				if lost, err := o.startCompensating(ctx, saga, erero.Errorf("step %s failed: %s", current.name, err.Error())); lost || err != nil {
+					return err
+				}
+			}
+		case saga.Status == StatusRunning:
+			return o.finish(ctx, saga, StatusCompleted)
+		case saga.Status == StatusCompensating && saga.Step > len(definition.steps):
+			return erero.Errorf("saga %d is at step %d beyond the %d steps of %s", saga.ID, saga.Step, len(definition.steps), definition.name)
+		case saga.Status == StatusCompensating && saga.Step > 0:
+			current := definition.steps[saga.Step-1]
+			lost, err := o.runStep(ctx, saga, current.compensate, saga.Step-1)
+			if lost {
+				return nil
+			}
+			if err != nil {
+				return o.retryCompensation(ctx, saga, erero.Errorf("compensation of step %s failed: %s", current.name, err.Error()))
+			}
+		case saga.Status == StatusCompensating:
+			return o.finish(ctx, saga, StatusCompensated)
+		default:
+			return nil
+		}
+	}
+}
+
+// runStep runs the step function and saves the next step and state in one transaction, returns whether the lease was lost
+// runStep 在一个事务中执行步骤函数并保存下一步骤和状态, 返回是否丢失租约
+func (o *Orchestrator) runStep(ctx context.Context, saga *Saga, run StepFunc, next int) (bool, error) {
+	stepCtx, cancel := context.WithTimeout(ctx, o.config.LeaseTimeout)
+	defer cancel()
+
+	var lost bool
+	until := time.Now().UTC().Add(o.config.LeaseTimeout)
+	_, err := gormkratos.Transaction(stepCtx, o.db, func(db *gorm.DB) *errors.Error {
+		if run != nil {
+			if erk := run(db, saga); erk != nil {
+				return erk
+			}
+		}
+		result := db.Model(&Saga{}).Where("id = ? AND lease_token = ?", saga.ID, saga.LeaseToken).Updates(map[string]any{
+			"step":   next,
+			"state":  saga.State,
+			"run_at": until,
+		})
+		if result.Error != nil {
+			return gormkratos.TranslateDbError(result.Error)
+		}
+		if result.RowsAffected != 1 {
+			lost = true
+			return dberrors.ErrorDbConflict("lease of saga %d was lost", saga.ID)
+		}
+		return nil
+	})
+	if lost {
+		return true, nil
+	}
+	if err != nil {
+		// The step function may have changed the state before failing, take the saved one
+		// 步骤函数可能在失败前修改了状态, 取已保存的状态
+		return false, erero.Join(err, o.reload(ctx, saga))
+	}
+	saga.Step = next
+	saga.RunAt = until
+	return false, nil
+}
+
+// startCompensating switches the saga to compensating, returns whether the lease was lost
+// The saga is reloaded, as the failed commit may have saved the step progress
+//
+// startCompensating 将 Saga 切换为补偿中, 返回是否丢失租约
+// Saga 会被重新加载, 因为失败的提交可能已经保存了步骤进度
+func (o *Orchestrator) startCompensating(ctx context.Context, saga *Saga, cause error) (bool, error) {
+	result := o.db.WithContext(ctx).Model(&Saga{}).Where("id = ? AND lease_token = ?", saga.ID, saga.LeaseToken).Updates(map[string]any{
+		"status":     StatusCompensating,
+		"last_error": cause.Error(),
+	})
+	if result.Error != nil {
+		return false, erero.Wro(result.Error)
+	}
+	if result.RowsAffected != 1 {
+		return true, nil
+	}
+	return false, o.reload(ctx, saga)
+}
+
+// retryCompensation records the failed compensation, schedules the retry and releases the lease, or fails the saga
+// retryCompensation 记录失败的补偿, 安排重试并释放租约, 或使 Saga 失败
+func (o *Orchestrator) retryCompensation(ctx context.Context, saga *Saga, cause error) error {
+	if saga.Attempts+1 >= o.config.MaxAttempts {
+		saga.Attempts++
+		saga.LastError = cause.Error()
+		return o.finish(ctx, saga, StatusFailed)
+	}
+	runAt := time.Now().UTC().Add(o.config.RetryDelay)
+	result := o.db.WithContext(ctx).Model(&Saga{}).Where("id = ? AND lease_token = ?", saga.ID, saga.LeaseToken).Updates(map[string]any{
+		"attempts":    gorm.Expr("attempts + 1"),
+		"last_error":  cause.Error(),
+		"run_at":      runAt,
+		"lease_token": "",
+	})
+	if result.Error != nil {
+		return erero.Wro(result.Error)
+	}
+	if result.RowsAffected == 1 {
+		saga.Attempts++
+		saga.LastError = cause.Error()
+		saga.RunAt = runAt
+		saga.LeaseToken = ""
+	}
+	return nil
+}
+
+// finish sets the final status and releases the lease, nothing changes when the lease was lost
+// finish 设置最终状态并释放租约, 丢失租约时不做修改
+func (o *Orchestrator) finish(ctx context.Context, saga *Saga, status Status) error {
+	now := time.Now().UTC()
+	result := o.db.WithContext(ctx).Model(&Saga{}).Where("id = ? AND lease_token = ?", saga.ID, saga.LeaseToken).Updates(map[string]any{
+		"status":      status,
+		"attempts":    saga.Attempts,
+		"last_error":  saga.LastError,
+		"finished_at": now,
+		"lease_token": "",
+	})
+	if result.Error != nil {
+		return erero.Wro(result.Error)
+	}
+	if result.RowsAffected == 1 {
+		saga.Status = status
+		saga.FinishedAt = &now
+		saga.LeaseToken = ""
+	}
+	return nil
+}
+
+// reload replaces the saga with the saved one
+// reload 用已保存的 Saga 替换当前 Saga
+func (o *Orchestrator) reload(ctx context.Context, saga *Saga) error {
+	if err := o.db.WithContext(ctx).First(saga, saga.ID).Error; err != nil {
+		return erero.Wro(err)
+	}
+	return nil
+}
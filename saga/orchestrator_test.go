@@ -0,0 +1,185 @@
+package saga_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/orzkratos/gormkratos/internal/errorspb"
+	"github.com/orzkratos/gormkratos/saga"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// newOrderDefinition creates the order saga reserving stock, charging payment and shipping
+// newOrderDefinition 创建预留库存, 扣款和发货的订单 Saga
+func newOrderDefinition(log *[]string, ship saga.StepFunc) *saga.Definition {
+	return saga.NewDefinition("order").
+		Step("stock", reserve("stock"), release("stock", log)).
+		Step("payment", reserve("payment"), release("payment", log)).
+		Step("ship", ship, nil)
+}
+
+// TestStartCompleted tests sagas run every step and complete
+// TestStartCompleted 测试 Saga 执行所有步骤并完成
+func TestStartCompleted(t *testing.T) {
+	db := setupTestDB(t)
+	var log []string
+	orchestrator := saga.NewOrchestrator(db, saga.NewOrchestratorConfig()).Register(newOrderDefinition(&log, reserve("ship")))
+
+	instance, err := orchestrator.Start(context.Background(), "order", nil)
+	require.NoError(t, err)
+	require.Equal(t, saga.StatusCompleted, instance.Status)
+	require.Equal(t, 3, instance.Step)
+	require.Equal(t, "sps", string(instance.State))
+	require.NotNil(t, instance.FinishedAt)
+	require.Empty(t, log)
+	require.Equal(t, int64(3), countReservations(t, db))
+
+	_, err = orchestrator.Start(context.Background(), "unknown", nil)
+	require.Error(t, err)
+}
+
+// TestStartCompensated tests failed steps roll back and compensate the completed steps in reverse order
+// TestStartCompensated 测试失败的步骤回滚, 并按相反顺序补偿已完成的步骤
+func TestStartCompensated(t *testing.T) {
+	db := setupTestDB(t)
+	var log []string
+	orchestrator := saga.NewOrchestrator(db, saga.NewOrchestratorConfig()).Register(newOrderDefinition(&log, func(db *gorm.DB, instance *saga.Saga) *errors.Error {
+		if erk := reserve("ship")(db, instance); erk != nil {
+			return erk
+		}
+		return errorspb.ErrorBadRequest("address invalid")
+	}))
+
+	instance, err := orchestrator.Start(context.Background(), "order", nil)
+	require.NoError(t, err)
+	require.Equal(t, saga.StatusCompensated, instance.Status)
+	require.Equal(t, 0, instance.Step)
+	require.Contains(t, instance.LastError, "step ship failed")
+	require.Contains(t, instance.LastError, "address invalid")
+	require.Equal(t, []string{"payment", "stock"}, log)
+	require.Equal(t, int64(0), countReservations(t, db))
+}
+
+// TestCompensationRetry tests failed compensations wait for the retry delay and resume
+// TestCompensationRetry 测试失败的补偿等待重试间隔后恢复
+func TestCompensationRetry(t *testing.T) {
+	db := setupTestDB(t)
+	var log []string
+	var failures int
+	definition := saga.NewDefinition("order").
+		Step("stock", reserve("stock"), release("stock", &log)).
+		Step("payment", reserve("payment"), func(db *gorm.DB, instance *saga.Saga) *errors.Error {
+			if failures < 1 {
+				failures++
+				return errorspb.ErrorServerDbError("payment service unavailable")
+			}
+			return release("payment", &log)(db, instance)
+		}).
+		Step("ship", func(db *gorm.DB, instance *saga.Saga) *errors.Error {
+			return errorspb.ErrorBadRequest("address invalid")
+		}, nil)
+	config := saga.NewOrchestratorConfig().WithRetry(50*time.Millisecond, 3)
+	orchestrator := saga.NewOrchestrator(db, config).Register(definition)
+
+	instance, err := orchestrator.Start(context.Background(), "order", nil)
+	require.NoError(t, err)
+	require.Equal(t, saga.StatusCompensating, instance.Status)
+	require.Equal(t, 2, instance.Step)
+	require.Equal(t, 1, instance.Attempts)
+	require.Contains(t, instance.LastError, "compensation of step payment failed")
+
+	// Not due before the retry delay
+	// 重试间隔结束前不会到期
+	resumed, err := orchestrator.Resume(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 0, resumed)
+
+	time.Sleep(100 * time.Millisecond)
+	resumed, err = orchestrator.Resume(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, resumed)
+
+	instance, err = orchestrator.Get(context.Background(), instance.ID)
+	require.NoError(t, err)
+	require.Equal(t, saga.StatusCompensated, instance.Status)
+	require.Equal(t, []string{"payment", "stock"}, log)
+	require.Equal(t, int64(0), countReservations(t, db))
+}
+
+// TestCompensationFailed tests compensations exhausting attempts fail the saga
+// TestCompensationFailed 测试耗尽尝试次数的补偿使 Saga 失败
+func TestCompensationFailed(t *testing.T) {
+	db := setupTestDB(t)
+	definition := saga.NewDefinition("order").
+		Step("stock", reserve("stock"), func(db *gorm.DB, instance *saga.Saga) *errors.Error {
+			return errorspb.ErrorServerDbError("stock service unavailable")
+		}).
+		Step("ship", func(db *gorm.DB, instance *saga.Saga) *errors.Error {
+			return errorspb.ErrorBadRequest("address invalid")
+		}, nil)
+	orchestrator := saga.NewOrchestrator(db, saga.NewOrchestratorConfig().WithRetry(0, 2)).Register(definition)
+
+	instance, err := orchestrator.Start(context.Background(), "order", nil)
+	require.NoError(t, err)
+	require.Equal(t, saga.StatusCompensating, instance.Status)
+
+	resumed, err := orchestrator.Resume(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, resumed)
+
+	instance, err = orchestrator.Get(context.Background(), instance.ID)
+	require.NoError(t, err)
+	require.Equal(t, saga.StatusFailed, instance.Status)
+	require.Equal(t, 2, instance.Attempts)
+	require.Equal(t, 1, instance.Step)
+	require.NotNil(t, instance.FinishedAt)
+	require.Equal(t, int64(1), countReservations(t, db))
+}
+
+// TestResume tests sagas left in flight by crashed processes continue after the last committed step
+// TestResume 测试因进程崩溃而中断的 Saga 从最后提交的步骤之后继续
+func TestResume(t *testing.T) {
+	db := setupTestDB(t)
+
+	// Crashed after committing the first step, the lease expired
+	// 提交第一个步骤后崩溃, 租约已过期
+	require.NoError(t, db.Create(&saga.Saga{
+		Name:       "order",
+		State:      []byte("s"),
+		Status:     saga.StatusRunning,
+		Step:       1,
+		RunAt:      time.Now().UTC().Add(-time.Second),
+		LeaseToken: "crashed",
+		CreatedAt:  time.Now().UTC(),
+	}).Error)
+
+	var log []string
+	definition := newOrderDefinition(&log, reserve("ship"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	orchestrator := saga.NewOrchestrator(db, saga.NewOrchestratorConfig().WithPollInterval(10*time.Millisecond)).Register(definition)
+	go func() {
+		done <- orchestrator.Run(ctx)
+	}()
+
+	require.Eventually(t, func() bool {
+		instance, err := orchestrator.Get(context.Background(), 1)
+		require.NoError(t, err)
+		return instance.Status == saga.StatusCompleted
+	}, time.Second, 10*time.Millisecond)
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+
+	instance, err := orchestrator.Get(context.Background(), 1)
+	require.NoError(t, err)
+	require.Equal(t, 3, instance.Step)
+
+	// The first step does not run again
+	// 第一个步骤不会再次执行
+	require.Equal(t, "sps", string(instance.State))
+	require.Equal(t, int64(2), countReservations(t, db))
+}
@@ -0,0 +1,107 @@
+// Package saga: Saga orchestration built on gormkratos.Transaction
+// Runs each step of a workflow in its own transaction together with the saga progress,
+// compensates the completed steps in reverse order when a step fails,
+// and resumes sagas left in flight by crashed processes
+//
+// saga: 基于 gormkratos.Transaction 的 Saga 编排
+// 每个工作流步骤与 Saga 进度在独立的事务中一起执行,
+// 某个步骤失败时按相反顺序补偿已完成的步骤,
+// 并恢复因进程崩溃而中断的 Saga
+package saga
+
+import (
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"gorm.io/gorm"
+)
+
+// Status of sagas
+// Status Saga 的状态
+type Status string
+
+const (
+	StatusRunning      Status = "running"      // Running the steps forward // 正向执行步骤中
+	StatusCompensating Status = "compensating" // Compensating the completed steps in reverse order // 按相反顺序补偿已完成的步骤中
+	StatusCompleted    Status = "completed"    // All steps completed // 所有步骤已完成
+	StatusCompensated  Status = "compensated"  // All completed steps compensated // 所有已完成的步骤已补偿
+	StatusFailed       Status = "failed"       // Compensation exhausted attempts, needs manual handling // 补偿耗尽尝试次数, 需要人工处理
+)
+
+// Saga represents one saga instance in the saga table
+// Saga 表示 Saga 表中的一个 Saga 实例
+type Saga struct {
+	ID         uint64     `gorm:"primarykey"`                                                   // Auto-increment ID // 自增主键
+	Name       string     `gorm:"column:name;size:255;not null;index"`                          // Definition name // 定义名称
+	Payload    []byte     `gorm:"column:payload"`                                               // Input of the saga // Saga 的输入
+	State      []byte     `gorm:"column:state"`                                                 // State set by steps, saved with the step progress // 步骤设置的状态, 随步骤进度保存
+	Status     Status     `gorm:"column:status;size:16;not null;index:idx_saga_due,priority:1"` // Saga status // Saga 状态
+	Step       int        `gorm:"column:step;not null"`                                         // Count of completed steps not compensated // 已完成且未补偿的步骤数
+	RunAt      time.Time  `gorm:"column:run_at;not null;index:idx_saga_due,priority:2"`         // Lease end while executing, or time of the next compensation retry // 执行中时为租约结束时间, 或下次补偿重试的时间
+	LeaseToken string     `gorm:"column:lease_token;size:64"`                                   // Token of the current lease // 当前租约的令牌
+	Attempts   int        `gorm:"column:attempts;not null"`                                     // Failed compensation attempts // 失败的补偿次数
+	LastError  string     `gorm:"column:last_error"`                                            // Error of the last failed step or compensation // 最近一次失败的步骤或补偿的错误
+	CreatedAt  time.Time  `gorm:"column:created_at"`                                            // Time started // 开始时间
+	FinishedAt *time.Time `gorm:"column:finished_at"`                                           // Time completed, compensated or failed // 完成, 补偿完成或失败的时间
+}
+
+// TableName returns the saga table name
+// TableName 返回 Saga 表名
+func (*Saga) TableName() string {
+	return "saga_instances"
+}
+
+// Migrate creates or updates the saga table
+//
+// Migrate 创建或更新 Saga 表
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(&Saga{})
+}
+
+// StepFunc runs one step or compensation inside its own transaction, db is the tx
+// Setting saga.State saves it with the step progress, returning erk rolls back both
+//
+// StepFunc 在独立的事务中执行一个步骤或补偿, db 即 tx
+// 设置 saga.State 时随步骤进度一起保存, 返回 erk 时两者一起回滚
+type StepFunc func(db *gorm.DB, saga *Saga) *errors.Error
+
+// step is one step of the definition
+// step 是定义中的一个步骤
+type step struct {
+	name       string
+	action     StepFunc
+	compensate StepFunc
+}
+
+// Definition is the ordered steps of one kind of saga
+//
+// Definition 是一类 Saga 的有序步骤
+type Definition struct {
+	name  string
+	steps []*step
+}
+
+// NewDefinition creates saga definition with the name, add steps with Step
+//
+// NewDefinition 创建该名称的 Saga 定义, 通过 Step 添加步骤
+func NewDefinition(name string) *Definition {
+	return &Definition{name: name}
+}
+
+// Step appends a step with its action and compensation, nil compensation means nothing to undo
+// The failing step rolls back in its own transaction, only the completed steps are compensated
+// Calls to other services in actions and compensations should be idempotent, they may run again after crashes
+//
+// Step 追加一个带动作和补偿的步骤, 补偿为 nil 表示无需撤销
+// 失败的步骤在其事务中回滚, 只有已完成的步骤会被补偿
+// 动作和补偿中对其它服务的调用应当是幂等的, 崩溃后可能再次执行
+func (d *Definition) Step(name string, action StepFunc, compensate StepFunc) *Definition {
+	d.steps = append(d.steps, &step{name: name, action: action, compensate: compensate})
+	return d
+}
+
+// Name returns the definition name
+// Name 返回定义名称
+func (d *Definition) Name() string {
+	return d.name
+}
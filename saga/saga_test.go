@@ -0,0 +1,87 @@
+package saga_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/orzkratos/gormkratos/gormkratostest"
+	"github.com/orzkratos/gormkratos/internal/errorspb"
+	"github.com/orzkratos/gormkratos/saga"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// Reservation is the local change of each step in saga tests
+// Reservation 是 Saga 测试中每个步骤的本地修改
+type Reservation struct {
+	ID   uint   `gorm:"primaryKey"`
+	Kind string `gorm:"not null"`
+}
+
+// setupTestDB creates isolated in-memory SQLite database with the saga table
+// setupTestDB 创建带 Saga 表的独立内存 SQLite 数据库
+func setupTestDB(t *testing.T) *gorm.DB {
+	db := gormkratostest.NewDB(t, &Reservation{})
+	require.NoError(t, saga.Migrate(db))
+	return db
+}
+
+// countReservations counts the committed reservations
+// countReservations 统计已提交的预留数量
+func countReservations(t *testing.T, db *gorm.DB) int64 {
+	var count int64
+	require.NoError(t, db.Model(&Reservation{}).Count(&count).Error)
+	return count
+}
+
+// reserve returns the step creating a reservation of the kind and appending the kind to the state
+// reserve 返回创建该类型预留并将类型追加到状态的步骤
+func reserve(kind string) saga.StepFunc {
+	return func(db *gorm.DB, instance *saga.Saga) *errors.Error {
+		if err := db.Create(&Reservation{Kind: kind}).Error; err != nil {
+			return errorspb.ErrorServerDbError("reserve failed: %v", err)
+		}
+		instance.State = append(instance.State, kind[0])
+		return nil
+	}
+}
+
+// release returns the compensation deleting the reservation of the kind, recording it in the log
+// release 返回删除该类型预留的补偿, 并记录到日志中
+func release(kind string, log *[]string) saga.StepFunc {
+	return func(db *gorm.DB, instance *saga.Saga) *errors.Error {
+		if err := db.Where("kind = ?", kind).Delete(&Reservation{}).Error; err != nil {
+			return errorspb.ErrorServerDbError("release failed: %v", err)
+		}
+		*log = append(*log, kind)
+		return nil
+	}
+}
+
+// TestStepState tests the state set by steps is saved with the step progress and dropped on failure
+// TestStepState 测试步骤设置的状态随步骤进度保存, 失败时丢弃
+func TestStepState(t *testing.T) {
+	db := setupTestDB(t)
+	var log []string
+	definition := saga.NewDefinition("order").
+		Step("stock", reserve("stock"), release("stock", &log)).
+		Step("payment", func(db *gorm.DB, instance *saga.Saga) *errors.Error {
+			instance.State = []byte("dirty")
+			return errorspb.ErrorBadRequest("card declined")
+		}, nil)
+	require.Equal(t, "order", definition.Name())
+
+	orchestrator := saga.NewOrchestrator(db, saga.NewOrchestratorConfig()).Register(definition)
+	instance, err := orchestrator.Start(context.Background(), "order", []byte(`{"id":1}`))
+	require.NoError(t, err)
+	require.Equal(t, saga.StatusCompensated, instance.Status)
+	require.Equal(t, "s", string(instance.State))
+	require.Equal(t, []string{"stock"}, log)
+
+	stored, err := orchestrator.Get(context.Background(), instance.ID)
+	require.NoError(t, err)
+	require.Equal(t, "s", string(stored.State))
+	require.Equal(t, []byte(`{"id":1}`), stored.Payload)
+	require.Equal(t, 0, stored.Step)
+}
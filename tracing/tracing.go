@@ -0,0 +1,127 @@
+// Package tracing: OpenTelemetry tracing of gormkratos transactions
+// Starts one span per transaction as child of the span in ctx, registered on the database as GORM plugin
+//
+// tracing: gormkratos 事务的 OpenTelemetry 链路追踪
+// 每个事务开启一个 span, 作为 ctx 中 span 的子 span, 以 GORM 插件方式注册到数据库上
+package tracing
+
+import (
+	"context"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/orzkratos/gormkratos"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// PluginName is the GORM plugin name of the tracing plugin
+// PluginName 是链路追踪插件的 GORM 插件名
+const PluginName = "gormkratos:tracing"
+
+// SpanName is the name of transaction spans
+// SpanName 是事务 span 的名称
+const SpanName = "gormkratos.Transaction"
+
+// Span attribute keys
+// Span 属性键
+const (
+	AttrName           = attribute.Key("db.transaction.name")            // Transaction name set with gormkratos.WithTxName // 通过 gormkratos.WithTxName 设置的事务名称
+	AttrIsolationLevel = attribute.Key("db.transaction.isolation_level") // Isolation level from sql.TxOptions // sql.TxOptions 中的隔离级别
+	AttrReadOnly       = attribute.Key("db.transaction.read_only")       // Read-only flag from sql.TxOptions // sql.TxOptions 中的只读标志
+	AttrAttempt        = attribute.Key("db.transaction.attempt")         // Attempt number, above 1 when retried // 尝试次数, 重试时大于 1
+	AttrDepth          = attribute.Key("db.transaction.depth")           // Nesting depth, above 0 means savepoint // 嵌套深度, 大于 0 表示保存点
+	AttrOutcome        = attribute.Key("db.transaction.outcome")         // Transaction outcome // 事务结果
+	AttrErkReason      = attribute.Key("kratos.error.reason")            // Reason of the business error // 业务错误的原因
+	AttrErkCode        = attribute.Key("kratos.error.code")              // Code of the business error // 业务错误的错误码
+)
+
+// Config configures the tracing plugin
+//
+// Config 配置链路追踪插件
+type Config struct {
+	TracerProvider trace.TracerProvider // Provider of the tracer, default is the global provider // tracer 的提供者, 默认为全局提供者
+}
+
+// NewConfig creates tracing config using the global tracer provider
+//
+// NewConfig 创建使用全局 tracer 提供者的链路追踪配置
+func NewConfig() *Config {
+	return &Config{TracerProvider: otel.GetTracerProvider()}
+}
+
+// WithTracerProvider sets the tracer provider
+// WithTracerProvider 设置 tracer 提供者
+func (c *Config) WithTracerProvider(tracerProvider trace.TracerProvider) *Config {
+	c.TracerProvider = tracerProvider
+	return c
+}
+
+// Plugin traces transactions, register it with db.Use(tracing.NewPlugin(config))
+//
+// Plugin 追踪事务, 通过 db.Use(tracing.NewPlugin(config)) 注册
+type Plugin struct {
+	tracer trace.Tracer
+}
+
+var _ gormkratos.TxObserver = &Plugin{}
+
+// NewPlugin creates tracing plugin
+//
+// NewPlugin 创建链路追踪插件
+func NewPlugin(config *Config) *Plugin {
+	return &Plugin{tracer: config.TracerProvider.Tracer("github.com/orzkratos/gormkratos")}
+}
+
+// Name returns the GORM plugin name
+// Name 返回 GORM 插件名
+func (p *Plugin) Name() string {
+	return PluginName
+}
+
+// Initialize does nothing, the plugin only observes gormkratos transactions
+// Initialize 不做任何事, 该插件只观察 gormkratos 事务
+func (p *Plugin) Initialize(db *gorm.DB) error {
+	return nil
+}
+
+// ObserveTx starts the transaction span and returns the function ending it with the outcome
+//
+// ObserveTx 开启事务 span, 并返回以事务结果结束该 span 的函数
+func (p *Plugin) ObserveTx(ctx context.Context, info *gormkratos.TxInfo) (context.Context, func(erk *errors.Error, err error)) {
+	attributes := []attribute.KeyValue{
+		AttrAttempt.Int(info.Attempt),
+		AttrDepth.Int(info.Depth),
+	}
+	if info.Name != "" {
+		attributes = append(attributes, AttrName.String(info.Name))
+	}
+	if info.Options != nil {
+		attributes = append(attributes,
+			AttrIsolationLevel.String(info.Options.Isolation.String()),
+			AttrReadOnly.Bool(info.Options.ReadOnly),
+		)
+	}
+	spanCtx, span := p.tracer.Start(ctx, SpanName, trace.WithSpanKind(trace.SpanKindInternal), trace.WithAttributes(attributes...))
+
+	return spanCtx, func(erk *errors.Error, err error) {
+		defer span.End()
+
+		outcome := gormkratos.ClassifyTxOutcome(spanCtx, erk, err)
+		span.SetAttributes(AttrOutcome.String(string(outcome)))
+		switch outcome {
+		case gormkratos.TxOutcomeCommitted:
+			span.SetStatus(codes.Ok, "")
+		case gormkratos.TxOutcomeBusinessRollback:
+			span.SetAttributes(AttrErkReason.String(erk.Reason), AttrErkCode.Int(int(erk.Code)))
+			if erk.Code >= 500 {
+				span.SetStatus(codes.Error, erk.Reason)
+			}
+		default:
+			span.RecordError(err)
+			span.SetStatus(codes.Error, string(outcome))
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package tracing_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/google/uuid"
+	"github.com/orzkratos/gormkratos"
+	"github.com/orzkratos/gormkratos/internal/errorspb"
+	"github.com/orzkratos/gormkratos/tracing"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"github.com/yyle88/rese"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// setupTracedDB creates isolated in-memory SQLite database with the tracing plugin recording spans in memory
+// setupTracedDB 创建带链路追踪插件的独立内存 SQLite 数据库, span 记录在内存中
+func setupTracedDB(t *testing.T) (*gorm.DB, *tracetest.SpanRecorder, *sdktrace.TracerProvider) {
+	dsn := fmt.Sprintf("file:db-%s?mode=memory&cache=shared", uuid.New().String())
+	db := rese.P1(gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Info),
+	}))
+	t.Cleanup(func() {
+		must.Done(rese.P1(db.DB()).Close())
+	})
+
+	recorder := tracetest.NewSpanRecorder()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	require.NoError(t, db.Use(tracing.NewPlugin(tracing.NewConfig().WithTracerProvider(tracerProvider))))
+	return db, recorder, tracerProvider
+}
+
+// attributesOf returns span attributes as map
+// attributesOf 以 map 形式返回 span 属性
+func attributesOf(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	res := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		res[kv.Key] = kv.Value
+	}
+	return res
+}
+
+// TestTracingCommit tests committed transactions produce child spans with tx options
+// TestTracingCommit 测试提交的事务产生带事务选项的子 span
+func TestTracingCommit(t *testing.T) {
+	db, recorder, tracerProvider := setupTracedDB(t)
+
+	ctx, parent := tracerProvider.Tracer("test").Start(gormkratos.WithTxName(context.Background(), "create-order"), "parent")
+	erk, err := gormkratos.Transaction(ctx, db, func(db *gorm.DB) *errors.Error {
+		return nil
+	}, &sql.TxOptions{Isolation: sql.LevelSerializable, ReadOnly: true})
+	parent.End()
+	require.NoError(t, err)
+	require.Nil(t, erk)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	span := spans[0]
+	require.Equal(t, tracing.SpanName, span.Name())
+	require.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+	require.Equal(t, codes.Ok, span.Status().Code)
+
+	attributes := attributesOf(span)
+	require.Equal(t, "create-order", attributes[tracing.AttrName].AsString())
+	require.Equal(t, "Serializable", attributes[tracing.AttrIsolationLevel].AsString())
+	require.True(t, attributes[tracing.AttrReadOnly].AsBool())
+	require.Equal(t, int64(1), attributes[tracing.AttrAttempt].AsInt64())
+	require.Equal(t, int64(0), attributes[tracing.AttrDepth].AsInt64())
+	require.Equal(t, string(gormkratos.TxOutcomeCommitted), attributes[tracing.AttrOutcome].AsString())
+}
+
+// TestTracingBusinessRollback tests business rollbacks record the erk reason and code
+// TestTracingBusinessRollback 测试业务回滚记录 erk 的原因和错误码
+func TestTracingBusinessRollback(t *testing.T) {
+	db, recorder, _ := setupTracedDB(t)
+
+	erk, err := gormkratos.Transaction(context.Background(), db, func(db *gorm.DB) *errors.Error {
+		return errorspb.ErrorBadRequest("validation failed")
+	})
+	require.Error(t, err)
+	require.True(t, errorspb.IsBadRequest(erk))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	attributes := attributesOf(spans[0])
+	require.Equal(t, string(gormkratos.TxOutcomeBusinessRollback), attributes[tracing.AttrOutcome].AsString())
+	require.Equal(t, "BAD_REQUEST", attributes[tracing.AttrErkReason].AsString())
+	require.Equal(t, int64(400), attributes[tracing.AttrErkCode].AsInt64())
+	require.Equal(t, codes.Unset, spans[0].Status().Code)
+}
+
+// TestTracingNested tests savepoint spans are children of the outer transaction span with depth
+// TestTracingNested 测试保存点 span 是外层事务 span 的子 span, 并带有嵌套深度
+func TestTracingNested(t *testing.T) {
+	db, recorder, _ := setupTracedDB(t)
+	ctx := context.Background()
+
+	erk, err := gormkratos.Transaction(ctx, db, func(db *gorm.DB) *errors.Error {
+		_, err := gormkratos.Transaction(db.Statement.Context, db, func(db *gorm.DB) *errors.Error {
+			return nil
+		})
+		require.NoError(t, err)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Nil(t, erk)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	inner, outer := spans[0], spans[1]
+	require.Equal(t, outer.SpanContext().SpanID(), inner.Parent().SpanID())
+	require.Equal(t, int64(1), attributesOf(inner)[tracing.AttrDepth].AsInt64())
+	require.Equal(t, int64(0), attributesOf(outer)[tracing.AttrDepth].AsInt64())
+}
+
+// TestTracingCanceled tests database failures record errors on the span
+// TestTracingCanceled 测试数据库失败在 span 上记录错误
+func TestTracingCanceled(t *testing.T) {
+	db, recorder, _ := setupTracedDB(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	erk, err := gormkratos.Transaction(ctx, db, func(db *gorm.DB) *errors.Error {
+		time.Sleep(100 * time.Millisecond) // Exceed timeout // 超过超时时间
+		return nil
+	})
+	require.Error(t, err)
+	require.Nil(t, erk)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	require.Equal(t, string(gormkratos.TxOutcomeCanceled), attributesOf(spans[0])[tracing.AttrOutcome].AsString())
+	require.Equal(t, codes.Error, spans[0].Status().Code)
+	require.NotEmpty(t, spans[0].Events()) // Recorded error event // 记录的错误事件
+}
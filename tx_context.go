@@ -0,0 +1,94 @@
+package gormkratos
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"gorm.io/gorm"
+)
+
+// txContextKey identifies the active transaction of one database in context
+// Keyed by the database connection pool, so transactions of different databases do not mix
+//
+// txContextKey 标识上下文中某个数据库的活动事务
+// 以数据库连接池为键, 不同数据库的事务不会混用
+type txContextKey struct {
+	pool gorm.ConnPool
+}
+
+// newTxContextKey creates context key of the database that db belongs to
+// newTxContextKey 创建 db 所属数据库的上下文键
+func newTxContextKey(db *gorm.DB) txContextKey {
+	return txContextKey{pool: db.Config.ConnPool}
+}
+
+// txScope holds the active transaction and the state shared by calls joining it
+// txScope 保存活动事务以及加入该事务的调用共享的状态
+type txScope struct {
+	tx          *gorm.DB      // Active transaction // 活动事务
+	mutex       sync.Mutex    // Guards rollbackErk // 保护 rollbackErk
+	rollbackErk *errors.Error // First business error of joined calls, marks rollback-only // 加入调用的首个业务错误, 标记只能回滚
+}
+
+// markRollbackOnly records the business error of joined calls, the transaction can only roll back
+// markRollbackOnly 记录加入调用的业务错误, 该事务只能回滚
+func (s *txScope) markRollbackOnly(erk *errors.Error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.rollbackErk == nil {
+		s.rollbackErk = erk
+	}
+}
+
+// getRollbackErk returns the business error that marked the transaction rollback-only
+// getRollbackErk 返回将事务标记为只能回滚的业务错误
+func (s *txScope) getRollbackErk() *errors.Error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.rollbackErk
+}
+
+// contextWithScope returns a copy of ctx carrying the transaction scope
+// contextWithScope 返回携带事务作用域的 ctx 副本
+func contextWithScope(ctx context.Context, scope *txScope) context.Context {
+	return context.WithValue(ctx, newTxContextKey(scope.tx), scope)
+}
+
+// scopeFromContext returns the transaction scope of the database that db belongs to
+// scopeFromContext 返回 db 所属数据库在上下文中的事务作用域
+func scopeFromContext(ctx context.Context, db *gorm.DB) (*txScope, bool) {
+	scope, ok := ctx.Value(newTxContextKey(db)).(*txScope)
+	return scope, ok
+}
+
+// ContextWithTx returns a copy of ctx carrying the active transaction tx
+//
+// ContextWithTx 返回携带活动事务 tx 的 ctx 副本
+func ContextWithTx(ctx context.Context, tx *gorm.DB) context.Context {
+	return contextWithScope(ctx, &txScope{tx: tx})
+}
+
+// TxFromContext returns the active transaction of the database that db belongs to
+//
+// TxFromContext 返回 db 所属数据库在上下文中的活动事务
+func TxFromContext(ctx context.Context, db *gorm.DB) (*gorm.DB, bool) {
+	if scope, ok := scopeFromContext(ctx, db); ok {
+		return scope.tx, true
+	}
+	return nil, false
+}
+
+// DB returns the active transaction in ctx when one exists, else the fallback database
+// Repository methods use it to join the ambient transaction without threading tx through calls
+// The returned db is bound to ctx
+//
+// DB 当上下文中存在活动事务时返回该事务, 否则返回 fallback 数据库
+// 仓储方法使用它加入当前事务, 无需层层传递 tx
+// 返回的 db 绑定了 ctx
+func DB(ctx context.Context, fallback *gorm.DB) *gorm.DB {
+	if tx, ok := TxFromContext(ctx, fallback); ok {
+		return tx.WithContext(ctx)
+	}
+	return fallback.WithContext(ctx)
+}
@@ -0,0 +1,135 @@
+package gormkratos
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"gorm.io/gorm"
+)
+
+// txHooksKey identifies the hooks of the innermost transaction in context
+// txHooksKey 标识上下文中最内层事务的钩子
+type txHooksKey struct{}
+
+// txHooks holds the callbacks registered inside one transaction
+// Hooks of nested (savepoint) transactions move to the parent when the savepoint succeeds
+//
+// txHooks 保存在一个事务中注册的回调
+// 嵌套 (保存点) 事务成功时, 其钩子移交给父事务
+type txHooks struct {
+	parent        *txHooks                                                  // Hooks of the parent transaction, nil when outermost // 父事务的钩子, 最外层时为 nil
+	depth         int                                                       // Nesting depth, 0 means outermost // 嵌套深度, 0 表示最外层
+	mutex         sync.Mutex                                                // Guards the hook lists // 保护钩子列表
+	afterCommit   []func(ctx context.Context)                               // Run after the outermost commit // 在最外层提交后执行
+	afterRollback []func(ctx context.Context, erk *errors.Error, err error) // Run after rollback // 在回滚后执行
+}
+
+// newTxHooks creates hooks of a transaction on db, linked to the parent when db is already in transaction
+// newTxHooks 创建 db 上事务的钩子, 当 db 已在事务中时关联到父事务
+func newTxHooks(db *gorm.DB) *txHooks {
+	hooks := &txHooks{}
+	if _, ok := db.Statement.ConnPool.(gorm.TxCommitter); ok {
+		if parent, ok := db.Statement.Context.Value(txHooksKey{}).(*txHooks); ok {
+			hooks.parent = parent
+			hooks.depth = parent.depth + 1
+		}
+	}
+	return hooks
+}
+
+// bind returns a copy of ctx carrying the hooks
+// bind 返回携带钩子的 ctx 副本
+func (h *txHooks) bind(ctx context.Context) context.Context {
+	return context.WithValue(ctx, txHooksKey{}, h)
+}
+
+// takeHooks removes and returns the registered hooks
+// takeHooks 取出并返回已注册的钩子
+func (h *txHooks) takeHooks() ([]func(ctx context.Context), []func(ctx context.Context, erk *errors.Error, err error)) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	afterCommit, afterRollback := h.afterCommit, h.afterRollback
+	h.afterCommit, h.afterRollback = nil, nil
+	return afterCommit, afterRollback
+}
+
+// committed runs commit hooks, or defers all hooks to the parent when the transaction is nested
+// committed 执行提交钩子, 当事务是嵌套事务时将所有钩子延迟到父事务
+func (h *txHooks) committed(ctx context.Context) {
+	afterCommit, afterRollback := h.takeHooks()
+	if h.parent != nil {
+		h.parent.mutex.Lock()
+		defer h.parent.mutex.Unlock()
+		h.parent.afterCommit = append(h.parent.afterCommit, afterCommit...)
+		h.parent.afterRollback = append(h.parent.afterRollback, afterRollback...)
+		return
+	}
+	for _, hook := range afterCommit {
+		hook(ctx)
+	}
+}
+
+// rolledBack runs rollback hooks and drops commit hooks
+// Unknown commit outcomes drop both, the transaction may have committed or rolled back
+// rolledBack 执行回滚钩子并丢弃提交钩子
+// 提交结果未知时两者都丢弃, 事务可能已提交也可能已回滚
+func (h *txHooks) rolledBack(ctx context.Context, erk *errors.Error, err error) {
+	_, afterRollback := h.takeHooks()
+	if IsCommitOutcomeUnknown(err) {
+		return
+	}
+	for _, hook := range afterRollback {
+		hook(ctx, erk, err)
+	}
+}
+
+// contextWithHooksOf returns a copy of ctx carrying the hooks of the transaction that tx belongs to
+// contextWithHooksOf 返回携带 tx 所属事务钩子的 ctx 副本
+func contextWithHooksOf(ctx context.Context, tx *gorm.DB) context.Context {
+	if hooks, ok := tx.Statement.Context.Value(txHooksKey{}).(*txHooks); ok {
+		return hooks.bind(ctx)
+	}
+	return ctx
+}
+
+// AfterCommit registers hook to run once the outermost transaction has committed
+// Hooks run in registration order with the ctx passed to the outermost Transaction
+// Inside Transaction use db.Statement.Context, inside TxManager use the ctx passed to run
+// Outside transaction the hook runs at once
+// Unknown commit outcomes run neither AfterCommit nor AfterRollback hooks, see IsCommitOutcomeUnknown
+//
+// AfterCommit 注册在最外层事务提交后执行的钩子
+// 钩子按注册顺序执行, 参数是传给最外层 Transaction 的 ctx
+// 在 Transaction 中使用 db.Statement.Context, 在 TxManager 中使用传给 run 的 ctx
+// 不在事务中时钩子立即执行
+// 提交结果未知时 AfterCommit 和 AfterRollback 的钩子都不执行, 参见 IsCommitOutcomeUnknown
+func AfterCommit(ctx context.Context, hook func(ctx context.Context)) {
+	hooks, ok := ctx.Value(txHooksKey{}).(*txHooks)
+	if !ok {
+		hook(ctx)
+		return
+	}
+	hooks.mutex.Lock()
+	defer hooks.mutex.Unlock()
+	hooks.afterCommit = append(hooks.afterCommit, hook)
+}
+
+// AfterRollback registers hook to run once the transaction has rolled back
+// Receives the two errors of the transaction that rolled back, savepoint rollbacks run the hook at once
+// Outside transaction the hook never runs
+// Unknown commit outcomes drop the hook, the transaction may have committed
+//
+// AfterRollback 注册在事务回滚后执行的钩子
+// 接收回滚事务的两个错误, 保存点回滚时钩子立即执行
+// 不在事务中时钩子不会执行
+// 提交结果未知时丢弃钩子, 事务可能已提交
+func AfterRollback(ctx context.Context, hook func(ctx context.Context, erk *errors.Error, err error)) {
+	hooks, ok := ctx.Value(txHooksKey{}).(*txHooks)
+	if !ok {
+		return
+	}
+	hooks.mutex.Lock()
+	defer hooks.mutex.Unlock()
+	hooks.afterRollback = append(hooks.afterRollback, hook)
+}
@@ -0,0 +1,198 @@
+package gormkratos_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/orzkratos/errkratos/must/erkrequire"
+	"github.com/orzkratos/gormkratos"
+	"github.com/orzkratos/gormkratos/gormkratostest"
+	"github.com/orzkratos/gormkratos/internal/errorspb"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// TestAfterCommit tests commit hooks run in registration order once the data is committed
+// TestAfterCommit 测试提交钩子在数据提交后按注册顺序执行
+func TestAfterCommit(t *testing.T) {
+	db, repo := setupOrderRepo(t)
+
+	var events []string
+	erk, err := gormkratos.Transaction(context.Background(), db, func(db *gorm.DB) *errors.Error {
+		require.NoError(t, db.Create(&Order{Name: "a"}).Error)
+		gormkratos.AfterCommit(db.Statement.Context, func(ctx context.Context) {
+			events = append(events, "commit-1")
+			require.Equal(t, int64(1), repo.Count(ctx)) // Committed data is visible // 已提交的数据可见
+		})
+		gormkratos.AfterCommit(db.Statement.Context, func(ctx context.Context) {
+			events = append(events, "commit-2")
+		})
+		gormkratos.AfterRollback(db.Statement.Context, func(ctx context.Context, erk *errors.Error, err error) {
+			events = append(events, "rollback")
+		})
+		require.Empty(t, events)
+		return nil
+	})
+	require.NoError(t, err)
+	erkrequire.NoError(t, erk)
+	require.Equal(t, []string{"commit-1", "commit-2"}, events)
+}
+
+// TestAfterRollback tests rollback hooks receive the two errors and commit hooks are dropped
+// TestAfterRollback 测试回滚钩子接收两个错误且提交钩子被丢弃
+func TestAfterRollback(t *testing.T) {
+	db := setupTestDB(t)
+
+	var events []string
+	erk, err := gormkratos.Transaction(context.Background(), db, func(db *gorm.DB) *errors.Error {
+		gormkratos.AfterCommit(db.Statement.Context, func(ctx context.Context) {
+			events = append(events, "commit")
+		})
+		gormkratos.AfterRollback(db.Statement.Context, func(ctx context.Context, erk *errors.Error, err error) {
+			require.True(t, errorspb.IsBadRequest(erk))
+			require.Error(t, err)
+			events = append(events, "rollback")
+		})
+		return errorspb.ErrorBadRequest("validation failed")
+	})
+	require.Error(t, err)
+	require.True(t, errorspb.IsBadRequest(erk))
+	require.Equal(t, []string{"rollback"}, events)
+}
+
+// TestAfterCommitOutcomeUnknown tests neither hook runs when the COMMIT outcome is unknown
+// TestAfterCommitOutcomeUnknown 测试提交结果未知时两类钩子都不执行
+func TestAfterCommitOutcomeUnknown(t *testing.T) {
+	db, faults := gormkratostest.NewFaultDB(t, &Transfer{})
+	faults.FailCommitApplied(driver.ErrBadConn)
+
+	var events []string
+	erk, err := gormkratos.Transaction(context.Background(), db, func(db *gorm.DB) *errors.Error {
+		gormkratos.AfterCommit(db.Statement.Context, func(ctx context.Context) {
+			events = append(events, "commit")
+		})
+		gormkratos.AfterRollback(db.Statement.Context, func(ctx context.Context, erk *errors.Error, err error) {
+			events = append(events, "rollback")
+		})
+		return createTransfer(db)
+	})
+	require.Nil(t, erk)
+	require.True(t, gormkratos.IsCommitOutcomeUnknown(err))
+	require.Empty(t, events)
+	require.Equal(t, int64(1), countTransfers(t, db))
+}
+
+// TestAfterCommitNested tests savepoint hooks are deferred to the outermost outcome
+// TestAfterCommitNested 测试保存点的钩子延迟到最外层事务的结果
+func TestAfterCommitNested(t *testing.T) {
+	t.Run("outer-commit", func(t *testing.T) {
+		db := setupTestDB(t)
+		ctx := context.Background()
+
+		var events []string
+		erk, err := gormkratos.Transaction(ctx, db, func(db *gorm.DB) *errors.Error {
+			erk, err := gormkratos.Transaction(ctx, db, func(db *gorm.DB) *errors.Error {
+				gormkratos.AfterCommit(db.Statement.Context, func(ctx context.Context) {
+					events = append(events, "inner-commit")
+				})
+				return nil
+			})
+			require.NoError(t, err)
+			erkrequire.NoError(t, erk)
+			require.Empty(t, events) // Deferred to the outermost commit // 延迟到最外层提交
+			gormkratos.AfterCommit(db.Statement.Context, func(ctx context.Context) {
+				events = append(events, "outer-commit")
+			})
+			return nil
+		})
+		require.NoError(t, err)
+		erkrequire.NoError(t, erk)
+		require.Equal(t, []string{"inner-commit", "outer-commit"}, events)
+	})
+
+	t.Run("outer-rollback", func(t *testing.T) {
+		db := setupTestDB(t)
+		ctx := context.Background()
+
+		var events []string
+		erk, err := gormkratos.Transaction(ctx, db, func(db *gorm.DB) *errors.Error {
+			erk, err := gormkratos.Transaction(ctx, db, func(db *gorm.DB) *errors.Error {
+				gormkratos.AfterCommit(db.Statement.Context, func(ctx context.Context) {
+					events = append(events, "inner-commit")
+				})
+				gormkratos.AfterRollback(db.Statement.Context, func(ctx context.Context, erk *errors.Error, err error) {
+					require.True(t, errorspb.IsBadRequest(erk))
+					events = append(events, "inner-rollback")
+				})
+				return nil
+			})
+			require.NoError(t, err)
+			erkrequire.NoError(t, erk)
+			return errorspb.ErrorBadRequest("outer failed")
+		})
+		require.Error(t, err)
+		require.True(t, errorspb.IsBadRequest(erk))
+		require.Equal(t, []string{"inner-rollback"}, events)
+	})
+
+	t.Run("savepoint-rollback", func(t *testing.T) {
+		db := setupTestDB(t)
+		ctx := context.Background()
+
+		var events []string
+		erk, err := gormkratos.Transaction(ctx, db, func(db *gorm.DB) *errors.Error {
+			erk, err := gormkratos.Transaction(ctx, db, func(db *gorm.DB) *errors.Error {
+				gormkratos.AfterCommit(db.Statement.Context, func(ctx context.Context) {
+					events = append(events, "inner-commit")
+				})
+				gormkratos.AfterRollback(db.Statement.Context, func(ctx context.Context, erk *errors.Error, err error) {
+					events = append(events, "inner-rollback")
+				})
+				return errorspb.ErrorBadRequest("inner failed")
+			})
+			require.Error(t, err)
+			require.True(t, errorspb.IsBadRequest(erk))
+			require.Equal(t, []string{"inner-rollback"}, events) // Savepoint rolled back at once // 保存点立即回滚
+			return nil
+		})
+		require.NoError(t, err)
+		erkrequire.NoError(t, erk)
+		require.Equal(t, []string{"inner-rollback"}, events)
+	})
+}
+
+// TestTxManagerAfterCommit tests repositories register hooks through the ctx passed to run
+// TestTxManagerAfterCommit 测试仓储通过传给 run 的 ctx 注册钩子
+func TestTxManagerAfterCommit(t *testing.T) {
+	db, repo := setupOrderRepo(t)
+	txm := gormkratos.NewTxManager(db)
+
+	var events []string
+	createAndNotify := func(ctx context.Context, name string) *errors.Error {
+		if erk := repo.Create(ctx, name); erk != nil {
+			return erk
+		}
+		gormkratos.AfterCommit(ctx, func(ctx context.Context) {
+			events = append(events, "notify-"+name)
+		})
+		return nil
+	}
+
+	erk := txm.TransactionErk(context.Background(), func(ctx context.Context) *errors.Error {
+		if erk := createAndNotify(ctx, "a"); erk != nil {
+			return erk
+		}
+		return txm.TransactionErk(ctx, func(ctx context.Context) *errors.Error {
+			return createAndNotify(ctx, "b")
+		})
+	})
+	erkrequire.NoError(t, erk)
+	require.Equal(t, []string{"notify-a", "notify-b"}, events)
+
+	// Outside transaction the hook runs at once
+	// 不在事务中时钩子立即执行
+	erkrequire.NoError(t, createAndNotify(context.Background(), "c"))
+	require.Equal(t, []string{"notify-a", "notify-b", "notify-c"}, events)
+}
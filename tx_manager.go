@@ -0,0 +1,186 @@
+package gormkratos
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/orzkratos/gormkratos/api/dberrors/v1"
+	"github.com/yyle88/erero"
+	"gorm.io/gorm"
+)
+
+// TxManager executes transactions and stores the active tx in context
+// Repository methods call DB(ctx) to join the ambient transaction when one exists
+// The With* methods return configured copies, the original manager is not changed
+//
+// TxManager 执行事务并将活动事务存入上下文
+// 仓储方法调用 DB(ctx) 在存在活动事务时自动加入该事务
+// With* 方法返回配置后的副本, 不修改原管理器
+type TxManager struct {
+	db          *gorm.DB     // Plain database // 普通数据库
+	retry       *RetryConfig // Retry config of new transactions, nil means no retry // 新事务的重试配置, nil 表示不重试
+	propagation Propagation  // Behavior when ctx already carries a transaction // ctx 已携带事务时的行为
+	recoverRun  bool         // Recovers panics in run into Kratos errors // 将 run 中的 panic 捕获为 Kratos 错误
+}
+
+// NewTxManager creates transaction manager on the database, using PropagationRequired
+//
+// NewTxManager 基于数据库创建事务管理器, 使用 PropagationRequired
+func NewTxManager(db *gorm.DB) *TxManager {
+	return &TxManager{db: db, propagation: PropagationRequired}
+}
+
+// clone returns a shallow copy of the manager
+// clone 返回管理器的浅拷贝
+func (m *TxManager) clone() *TxManager {
+	res := *m
+	return &res
+}
+
+// WithRetry returns a copy retrying new transactions with the retry config
+// Joined and nested transactions are never retried, the transaction that began retries as a whole
+//
+// WithRetry 返回使用该重试配置重试新事务的副本
+// 加入的和嵌套的事务不会单独重试, 由开启事务的一方整体重试
+func (m *TxManager) WithRetry(retry *RetryConfig) *TxManager {
+	res := m.clone()
+	res.retry = retry
+	return res
+}
+
+// WithPropagation returns a copy using the propagation mode
+//
+// WithPropagation 返回使用该传播方式的副本
+func (m *TxManager) WithPropagation(propagation Propagation) *TxManager {
+	res := m.clone()
+	res.propagation = propagation
+	return res
+}
+
+// WithRecoverPanic returns a copy recovering panics in run into Kratos errors, see RecoverPanic
+//
+// WithRecoverPanic 返回将 run 中的 panic 捕获为 Kratos 错误的副本, 参见 RecoverPanic
+func (m *TxManager) WithRecoverPanic() *TxManager {
+	res := m.clone()
+	res.recoverRun = true
+	return res
+}
+
+// DB returns the active transaction in ctx when one exists, else the plain database
+//
+// DB 当上下文中存在活动事务时返回该事务, 否则返回普通数据库
+func (m *TxManager) DB(ctx context.Context) *gorm.DB {
+	return DB(ctx, m.db)
+}
+
+// Transaction executes a function in database transaction, passing ctx carrying the tx to run
+// When ctx already carries a transaction, behaves as the propagation mode says
+// Returns the same two errors as the package-level Transaction
+//
+// Transaction 在数据库事务中执行函数, 传给 run 的 ctx 携带该事务
+// 当 ctx 已携带事务时, 按传播方式执行
+// 返回与包级别 Transaction 相同的两个错误
+func (m *TxManager) Transaction(
+	ctx context.Context,
+	run func(ctx context.Context) *errors.Error,
+	options ...*sql.TxOptions,
+) (erk *errors.Error, err error) {
+	if m.recoverRun {
+		run = RecoverPanic(run)
+	}
+	scope, exists := scopeFromContext(ctx, m.db)
+	switch m.propagation {
+	case PropagationRequiresNew:
+		return m.begin(ctx, run, options...)
+	case PropagationNested:
+		if exists {
+			// GORM runs nested transactions as savepoints
+			// GORM 以保存点方式执行嵌套事务
+			return Transaction(ctx, scope.tx, newScopeRun(ctx, run), options...)
+		}
+		return m.begin(ctx, run, options...)
+	case PropagationMandatory:
+		if !exists {
+			erk = dberrors.ErrorServerDbTransactionMandatory("propagation %s requires an existing transaction", m.propagation)
+			return erk, erero.Wro(erk)
+		}
+		return joinScope(ctx, scope, run)
+	case PropagationNever:
+		if exists {
+			erk = dberrors.ErrorServerDbTransactionNever("propagation %s does not allow an existing transaction", m.propagation)
+			return erk, erero.Wro(erk)
+		}
+		return runWithoutTx(ctx, run)
+	case PropagationSupports:
+		if exists {
+			return joinScope(ctx, scope, run)
+		}
+		return runWithoutTx(ctx, run)
+	default:
+		if exists {
+			return joinScope(ctx, scope, run)
+		}
+		return m.begin(ctx, run, options...)
+	}
+}
+
+// TransactionErk executes a function in database transaction and returns a single Kratos error
+// Database errors are converted with the ErkTranslator
+//
+// TransactionErk 在数据库事务中执行函数并返回单个 Kratos 错误
+// 数据库错误通过 ErkTranslator 转换
+func (m *TxManager) TransactionErk(
+	ctx context.Context,
+	run func(ctx context.Context) *errors.Error,
+	options ...*sql.TxOptions,
+) *errors.Error {
+	return mergeErk(m.Transaction(ctx, run, options...))
+}
+
+// begin begins a new transaction on the plain database, retrying when configured
+// begin 在普通数据库上开启新事务, 配置了重试时进行重试
+func (m *TxManager) begin(
+	ctx context.Context,
+	run func(ctx context.Context) *errors.Error,
+	options ...*sql.TxOptions,
+) (erk *errors.Error, err error) {
+	if m.retry != nil {
+		return TransactionRetry(ctx, m.db, m.retry, newScopeRun(ctx, run), options...)
+	}
+	return Transaction(ctx, m.db, newScopeRun(ctx, run), options...)
+}
+
+// newScopeRun adapts run to GORM transaction function, putting the tx into a fresh scope in ctx
+// When joined calls marked the scope rollback-only, returns their business error to roll back
+//
+// newScopeRun 将 run 适配为 GORM 事务函数, 把 tx 放入 ctx 中新的作用域
+// 当加入的调用将作用域标记为只能回滚时, 返回它们的业务错误以回滚
+func newScopeRun(ctx context.Context, run func(ctx context.Context) *errors.Error) func(db *gorm.DB) *errors.Error {
+	return func(db *gorm.DB) *errors.Error {
+		scope := &txScope{tx: db}
+		if erk := run(contextWithScope(contextWithHooksOf(ctx, db), scope)); erk != nil {
+			return erk
+		}
+		return scope.getRollbackErk()
+	}
+}
+
+// joinScope runs in the existing transaction, business errors mark it rollback-only
+// joinScope 在已有事务中执行, 业务错误将其标记为只能回滚
+func joinScope(ctx context.Context, scope *txScope, run func(ctx context.Context) *errors.Error) (*errors.Error, error) {
+	if erk := run(ctx); erk != nil {
+		scope.markRollbackOnly(erk)
+		return erk, erero.Wro(erk)
+	}
+	return nil, nil
+}
+
+// runWithoutTx runs without transaction, keeping the two-error-return contract
+// runWithoutTx 不使用事务执行, 保持双错误返回约定
+func runWithoutTx(ctx context.Context, run func(ctx context.Context) *errors.Error) (*errors.Error, error) {
+	if erk := run(ctx); erk != nil {
+		return erk, erero.Wro(erk)
+	}
+	return nil, nil
+}
@@ -0,0 +1,136 @@
+package gormkratos_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/orzkratos/errkratos/must/erkrequire"
+	"github.com/orzkratos/gormkratos"
+	"github.com/orzkratos/gormkratos/internal/errorspb"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/must"
+	"gorm.io/gorm"
+)
+
+// Order represents test data written through repository
+// Order 表示通过仓储写入的测试数据
+type Order struct {
+	ID   uint   `gorm:"primarykey"`           // Auto-increment PK // 自增PK
+	Name string `gorm:"column:name;not null"` // Order name // 订单名称
+}
+
+// orderRepo simulates Kratos data layer repository joining the ambient transaction
+// orderRepo 模拟加入当前事务的 Kratos 数据层仓储
+type orderRepo struct {
+	db *gorm.DB
+}
+
+func (r *orderRepo) Create(ctx context.Context, name string) *errors.Error {
+	if err := gormkratos.DB(ctx, r.db).Create(&Order{Name: name}).Error; err != nil {
+		return errorspb.ErrorServerDbError("failed to create order: %v", err)
+	}
+	return nil
+}
+
+func (r *orderRepo) Count(ctx context.Context) int64 {
+	var count int64
+	must.Done(gormkratos.DB(ctx, r.db).Model(&Order{}).Count(&count).Error)
+	return count
+}
+
+// setupOrderRepo creates database with orders table and the repository on it
+// setupOrderRepo 创建带订单表的数据库及其仓储
+func setupOrderRepo(t *testing.T) (*gorm.DB, *orderRepo) {
+	db := setupTestDB(t)
+	require.NoError(t, db.AutoMigrate(&Order{}))
+	return db, &orderRepo{db: db}
+}
+
+// TestTxManagerCommit tests repository writes join the ambient transaction and commit
+// TestTxManagerCommit 测试仓储写入加入当前事务并提交
+func TestTxManagerCommit(t *testing.T) {
+	db, repo := setupOrderRepo(t)
+	txm := gormkratos.NewTxManager(db)
+
+	erk, err := txm.Transaction(context.Background(), func(ctx context.Context) *errors.Error {
+		if erk := repo.Create(ctx, "a"); erk != nil {
+			return erk
+		}
+		if erk := repo.Create(ctx, "b"); erk != nil {
+			return erk
+		}
+		require.Equal(t, int64(2), repo.Count(ctx))
+
+		_, ok := gormkratos.TxFromContext(ctx, db)
+		require.True(t, ok)
+		return nil
+	})
+	require.NoError(t, err)
+	erkrequire.NoError(t, erk)
+	require.Equal(t, int64(2), repo.Count(context.Background()))
+}
+
+// TestTxManagerRollback tests repository writes roll back with business errors
+// TestTxManagerRollback 测试业务错误时仓储写入回滚
+func TestTxManagerRollback(t *testing.T) {
+	db, repo := setupOrderRepo(t)
+	txm := gormkratos.NewTxManager(db)
+
+	erk := txm.TransactionErk(context.Background(), func(ctx context.Context) *errors.Error {
+		if erk := repo.Create(ctx, "a"); erk != nil {
+			return erk
+		}
+		return errorspb.ErrorBadRequest("validation failed")
+	})
+	erkrequire.Error(t, erk)
+	require.True(t, errorspb.IsBadRequest(erk))
+	require.Equal(t, int64(0), repo.Count(context.Background()))
+}
+
+// TestTxManagerNested tests nested manager transactions run as savepoints with PropagationNested
+// TestTxManagerNested 测试使用 PropagationNested 时嵌套的管理器事务以保存点方式执行
+func TestTxManagerNested(t *testing.T) {
+	db, repo := setupOrderRepo(t)
+	txm := gormkratos.NewTxManager(db).WithPropagation(gormkratos.PropagationNested)
+
+	erk, err := txm.Transaction(context.Background(), func(ctx context.Context) *errors.Error {
+		if erk := repo.Create(ctx, "outer"); erk != nil {
+			return erk
+		}
+		erk, err := txm.Transaction(ctx, func(ctx context.Context) *errors.Error {
+			if erk := repo.Create(ctx, "inner"); erk != nil {
+				return erk
+			}
+			return errorspb.ErrorBadRequest("inner failed")
+		})
+		require.Error(t, err)
+		require.True(t, errorspb.IsBadRequest(erk))
+		// Savepoint rolled back, outer writes are kept
+		// 保存点已回滚, 外层写入保留
+		require.Equal(t, int64(1), repo.Count(ctx))
+		return nil
+	})
+	require.NoError(t, err)
+	erkrequire.NoError(t, erk)
+	require.Equal(t, int64(1), repo.Count(context.Background()))
+}
+
+// TestDBFallback tests DB returns the plain database outside transactions and ignores other databases
+// TestDBFallback 测试事务外 DB 返回普通数据库, 并且不会混用其它数据库的事务
+func TestDBFallback(t *testing.T) {
+	db, repo := setupOrderRepo(t)
+	otherDB, otherRepo := setupOrderRepo(t)
+	txm := gormkratos.NewTxManager(db)
+
+	erkrequire.NoError(t, repo.Create(context.Background(), "plain"))
+	require.Equal(t, int64(1), repo.Count(context.Background()))
+
+	erk := txm.TransactionErk(context.Background(), func(ctx context.Context) *errors.Error {
+		_, ok := gormkratos.TxFromContext(ctx, otherDB)
+		require.False(t, ok)
+		return otherRepo.Create(ctx, "other")
+	})
+	erkrequire.NoError(t, erk)
+	require.Equal(t, int64(1), otherRepo.Count(context.Background()))
+}
@@ -0,0 +1,142 @@
+package gormkratos
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/yyle88/erero"
+	"gorm.io/gorm"
+)
+
+// TxInfo describes one transaction run by Transaction
+//
+// TxInfo 描述 Transaction 执行的一个事务
+type TxInfo struct {
+	Name    string         // Caller-supplied transaction name set with WithTxName, empty when not set // 通过 WithTxName 设置的事务名称, 未设置时为空
+	Options *sql.TxOptions // Transaction options, nil when not set // 事务选项, 未设置时为 nil
+	Attempt int            // Attempt number starting from 1, above 1 when retried // 从 1 开始的尝试次数, 重试时大于 1
+	Depth   int            // Nesting depth, 0 means outermost, above 0 means savepoint // 嵌套深度, 0 表示最外层, 大于 0 表示保存点
+}
+
+// TxObserver observes transactions run by Transaction, such as tracing and metrics
+// Register it on the database as GORM plugin with db.Use(observer)
+//
+// TxObserver 观察 Transaction 执行的事务, 例如链路追踪和指标
+// 以 GORM 插件的方式通过 db.Use(observer) 注册到数据库上
+type TxObserver interface {
+	gorm.Plugin
+	// ObserveTx is called before the transaction begins, returns ctx used by the transaction
+	// and the finish function called with the two errors once the outcome is known
+	//
+	// ObserveTx 在事务开始前调用, 返回事务使用的 ctx
+	// 以及在结果确定后以两个错误调用的结束函数
+	ObserveTx(ctx context.Context, info *TxInfo) (context.Context, func(erk *errors.Error, err error))
+}
+
+// TxOutcome is the outcome of one transaction
+//
+// TxOutcome 是一个事务的结果
+type TxOutcome string
+
+const (
+	TxOutcomeCommitted        TxOutcome = "committed"         // Committed // 已提交
+	TxOutcomeBusinessRollback TxOutcome = "business_rollback" // Rolled back by business errors // 业务错误导致回滚
+	TxOutcomeDbError          TxOutcome = "db_error"          // Database transaction failed // 数据库事务失败
+	TxOutcomeCommitUnknown    TxOutcome = "commit_unknown"    // Connection broke during COMMIT, may have committed // 提交时连接断开, 可能已提交
+	TxOutcomeCanceled         TxOutcome = "canceled"          // Context canceled or deadline exceeded // 上下文取消或超时
+)
+
+// ClassifyTxOutcome classifies the outcome from the two errors and the transaction ctx
+//
+// ClassifyTxOutcome 根据两个错误和事务的 ctx 分类事务结果
+func ClassifyTxOutcome(ctx context.Context, erk *errors.Error, err error) TxOutcome {
+	switch {
+	case err == nil:
+		return TxOutcomeCommitted
+	case erk != nil:
+		return TxOutcomeBusinessRollback
+	case IsCommitOutcomeUnknown(err):
+		return TxOutcomeCommitUnknown
+	case ctx.Err() != nil || erero.Is(err, context.Canceled) || erero.Is(err, context.DeadlineExceeded):
+		return TxOutcomeCanceled
+	default:
+		return TxOutcomeDbError
+	}
+}
+
+// txNameKey carries the transaction name set by WithTxName
+// txNameKey 携带 WithTxName 设置的事务名称
+type txNameKey struct{}
+
+// WithTxName returns a copy of ctx naming the transactions run with it, such as "create-order"
+// Observers use the name to tell transactions apart, nested transactions inherit the name unless renamed
+//
+// WithTxName 返回为使用它执行的事务命名的 ctx 副本, 例如 "create-order"
+// 观察者通过名称区分事务, 嵌套事务继承该名称, 除非重新命名
+func WithTxName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, txNameKey{}, name)
+}
+
+// TxNameFromContext returns the transaction name set by WithTxName, empty when not set
+//
+// TxNameFromContext 返回 WithTxName 设置的事务名称, 未设置时为空
+func TxNameFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(txNameKey{}).(string)
+	return name
+}
+
+// txAttemptKey carries the attempt number set by TransactionRetry
+// txAttemptKey 携带 TransactionRetry 设置的尝试次数
+type txAttemptKey struct{}
+
+// contextWithAttempt returns a copy of ctx carrying the attempt number
+// contextWithAttempt 返回携带尝试次数的 ctx 副本
+func contextWithAttempt(ctx context.Context, attempt int) context.Context {
+	return context.WithValue(ctx, txAttemptKey{}, attempt)
+}
+
+// attemptFromContext returns the attempt number, 1 when not retried
+// attemptFromContext 返回尝试次数, 未重试时为 1
+func attemptFromContext(ctx context.Context) int {
+	if attempt, ok := ctx.Value(txAttemptKey{}).(int); ok {
+		return attempt
+	}
+	return 1
+}
+
+// observeTx notifies the observers registered on db, returns ctx and the finish function
+// The finish function runs once, later calls such as panics of hooks after the outcome are ignored
+//
+// observeTx 通知 db 上注册的观察者, 返回 ctx 和结束函数
+// 结束函数只执行一次, 之后的调用会被忽略, 例如结果确定后钩子中的 panic
+func observeTx(ctx context.Context, db *gorm.DB, info *TxInfo) (context.Context, func(erk *errors.Error, err error)) {
+	names := make([]string, 0, len(db.Config.Plugins))
+	for name, plugin := range db.Config.Plugins {
+		if _, ok := plugin.(TxObserver); ok {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return ctx, func(erk *errors.Error, err error) {}
+	}
+	slices.Sort(names)
+
+	finishes := make([]func(erk *errors.Error, err error), 0, len(names))
+	for _, name := range names {
+		var finish func(erk *errors.Error, err error)
+		ctx, finish = db.Config.Plugins[name].(TxObserver).ObserveTx(ctx, info)
+		finishes = append(finishes, finish)
+	}
+	var finished bool
+	return ctx, func(erk *errors.Error, err error) {
+		if finished {
+			return
+		}
+		finished = true
+		for _, finish := range slices.Backward(finishes) {
+			finish(erk, err)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package gormkratos_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/orzkratos/gormkratos"
+	"github.com/orzkratos/gormkratos/internal/errorspb"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/erero"
+)
+
+// TestWithTxName tests the transaction name is carried in ctx
+// TestWithTxName 测试事务名称由 ctx 携带
+func TestWithTxName(t *testing.T) {
+	ctx := context.Background()
+	require.Empty(t, gormkratos.TxNameFromContext(ctx))
+
+	ctx = gormkratos.WithTxName(ctx, "create-order")
+	require.Equal(t, "create-order", gormkratos.TxNameFromContext(ctx))
+	require.Equal(t, "rename", gormkratos.TxNameFromContext(gormkratos.WithTxName(ctx, "rename")))
+}
+
+// TestClassifyTxOutcome tests outcomes classified from the two errors and ctx
+// TestClassifyTxOutcome 测试根据两个错误和 ctx 分类的结果
+func TestClassifyTxOutcome(t *testing.T) {
+	ctx := context.Background()
+	erk := errorspb.ErrorBadRequest("validation failed")
+
+	require.Equal(t, gormkratos.TxOutcomeCommitted, gormkratos.ClassifyTxOutcome(ctx, nil, nil))
+	require.Equal(t, gormkratos.TxOutcomeBusinessRollback, gormkratos.ClassifyTxOutcome(ctx, erk, erero.Wro(erk)))
+	require.Equal(t, gormkratos.TxOutcomeDbError, gormkratos.ClassifyTxOutcome(ctx, nil, erero.New("commit failed")))
+	require.Equal(t, gormkratos.TxOutcomeCanceled, gormkratos.ClassifyTxOutcome(ctx, nil, erero.Wro(context.DeadlineExceeded)))
+
+	canceledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	require.Equal(t, gormkratos.TxOutcomeCanceled, gormkratos.ClassifyTxOutcome(canceledCtx, nil, erero.New("begin failed")))
+}
@@ -0,0 +1,93 @@
+// Package txmiddleware: Kratos server middleware running each request in a gormkratos transaction
+// The handler and the data layer join the transaction through gormkratos.DB(ctx) or TxManager.DB(ctx)
+// Apply it to selected operations with the Kratos selector middleware
+//
+// txmiddleware: 在 gormkratos 事务中执行每个请求的 Kratos 服务端中间件
+// 处理函数和数据层通过 gormkratos.DB(ctx) 或 TxManager.DB(ctx) 加入该事务
+// 通过 Kratos selector 中间件只应用于选定的操作
+package txmiddleware
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/orzkratos/gormkratos"
+)
+
+// Config configures the transaction middleware
+//
+// Config 配置事务中间件
+type Config struct {
+	TxOptions     *sql.TxOptions           // Options of the transactions, nil uses the database defaults // 事务选项, nil 使用数据库默认值
+	ErkTranslator gormkratos.ErkTranslator // Converts commit and other database failures, nil uses gormkratos.GetErkTranslator() // 转换提交及其他数据库失败, nil 使用 gormkratos.GetErkTranslator()
+}
+
+// NewConfig creates middleware config with database default options and the default ErkTranslator
+//
+// NewConfig 创建使用数据库默认选项和默认 ErkTranslator 的中间件配置
+func NewConfig() *Config {
+	return &Config{}
+}
+
+// WithTxOptions sets the options of the transactions
+// WithTxOptions 设置事务选项
+func (c *Config) WithTxOptions(options *sql.TxOptions) *Config {
+	c.TxOptions = options
+	return c
+}
+
+// WithErkTranslator sets the Kratos error returned when the transaction fails to commit
+// WithErkTranslator 设置事务提交失败时返回的 Kratos 错误
+func (c *Config) WithErkTranslator(translator gormkratos.ErkTranslator) *Config {
+	c.ErkTranslator = translator
+	return c
+}
+
+// Server returns middleware running each request in a transaction of the manager
+// Nil reply errors commit, reply errors roll back and are returned unchanged
+// Database failures such as commit failures are converted with the ErkTranslator
+// The manager decides propagation, retry and panic recovery, see gormkratos.TxManager
+//
+// Server 返回在管理器的事务中执行每个请求的中间件
+// 响应错误为 nil 时提交, 响应错误导致回滚并原样返回
+// 提交失败等数据库失败通过 ErkTranslator 转换
+// 传播方式, 重试和 panic 捕获由管理器决定, 参见 gormkratos.TxManager
+func Server(manager *gormkratos.TxManager, config *Config) middleware.Middleware {
+	var options []*sql.TxOptions
+	if config.TxOptions != nil {
+		options = append(options, config.TxOptions)
+	}
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req any) (any, error) {
+			var reply any
+			var replyErr error
+			erk, err := manager.Transaction(ctx, func(ctx context.Context) *errors.Error {
+				if reply, replyErr = handler(ctx, req); replyErr != nil {
+					return errors.FromError(replyErr) // Business errors cause rollback // 业务错误导致回滚
+				}
+				return nil
+			}, options...)
+			switch {
+			case err == nil:
+				return reply, nil
+			case erk != nil && replyErr != nil:
+				return reply, replyErr
+			case erk != nil:
+				return nil, erk // Rolled back by the manager, such as recovered panics // 由管理器回滚, 例如捕获的 panic
+			default:
+				return nil, config.translate(err)
+			}
+		}
+	}
+}
+
+// translate converts database failures into Kratos errors
+// translate 将数据库失败转换为 Kratos 错误
+func (c *Config) translate(err error) *errors.Error {
+	if c.ErkTranslator != nil {
+		return c.ErkTranslator(err)
+	}
+	return gormkratos.GetErkTranslator()(err)
+}
@@ -0,0 +1,165 @@
+package txmiddleware_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/middleware/selector"
+	"github.com/go-kratos/kratos/v2/transport"
+	"github.com/orzkratos/gormkratos"
+	"github.com/orzkratos/gormkratos/api/dberrors/v1"
+	"github.com/orzkratos/gormkratos/gormkratostest"
+	"github.com/orzkratos/gormkratos/internal/errorspb"
+	"github.com/orzkratos/gormkratos/txmiddleware"
+	"github.com/stretchr/testify/require"
+	"github.com/yyle88/erero"
+	"gorm.io/gorm"
+)
+
+// Article is the model written by handlers in middleware tests
+// Article 是中间件测试中处理函数写入的模型
+type Article struct {
+	ID    uint   `gorm:"primaryKey"`
+	Title string `gorm:"not null"`
+}
+
+// headerCarrier is the request header of testTransport
+// headerCarrier 是 testTransport 的请求头
+type headerCarrier http.Header
+
+func (c headerCarrier) Get(key string) string      { return http.Header(c).Get(key) }
+func (c headerCarrier) Set(key, value string)      { http.Header(c).Set(key, value) }
+func (c headerCarrier) Add(key, value string)      { http.Header(c).Add(key, value) }
+func (c headerCarrier) Values(key string) []string { return http.Header(c).Values(key) }
+func (c headerCarrier) Keys() []string             { return nil }
+
+// testTransport is the server transport of requests in tests
+// testTransport 是测试中请求的服务端传输
+type testTransport struct {
+	operation string
+}
+
+func (tr *testTransport) Kind() transport.Kind            { return transport.KindGRPC }
+func (tr *testTransport) Endpoint() string                { return "" }
+func (tr *testTransport) Operation() string               { return tr.operation }
+func (tr *testTransport) RequestHeader() transport.Header { return headerCarrier{} }
+func (tr *testTransport) ReplyHeader() transport.Header   { return headerCarrier{} }
+
+// newCreateHandler returns handler creating one article with the data layer and returning err
+// newCreateHandler 返回通过数据层创建一篇文章并返回 err 的处理函数
+func newCreateHandler(manager *gormkratos.TxManager, err error) middleware.Handler {
+	return func(ctx context.Context, req any) (any, error) {
+		if createErr := manager.DB(ctx).Create(&Article{Title: req.(string)}).Error; createErr != nil {
+			return nil, createErr
+		}
+		if err != nil {
+			return nil, err
+		}
+		_, inTx := gormkratos.TxFromContext(ctx, manager.DB(ctx))
+		return inTx, nil
+	}
+}
+
+// countArticles counts the committed articles
+// countArticles 统计已提交的文章数量
+func countArticles(t *testing.T, db *gorm.DB) int64 {
+	var count int64
+	require.NoError(t, db.Model(&Article{}).Count(&count).Error)
+	return count
+}
+
+// TestServerCommit tests nil reply errors commit and the handler runs in the transaction
+// TestServerCommit 测试响应错误为 nil 时提交且处理函数在事务中执行
+func TestServerCommit(t *testing.T) {
+	db := gormkratostest.NewDB(t, &Article{})
+	manager := gormkratos.NewTxManager(db)
+
+	handler := txmiddleware.Server(manager, txmiddleware.NewConfig())(newCreateHandler(manager, nil))
+	reply, err := handler(context.Background(), "a")
+	require.NoError(t, err)
+	require.Equal(t, true, reply)
+	require.Equal(t, int64(1), countArticles(t, db))
+}
+
+// TestServerRollback tests reply errors roll back and are returned unchanged
+// TestServerRollback 测试响应错误导致回滚并原样返回
+func TestServerRollback(t *testing.T) {
+	db := gormkratostest.NewDB(t, &Article{})
+	manager := gormkratos.NewTxManager(db)
+
+	erk := errorspb.ErrorBadRequest("title taken")
+	handler := txmiddleware.Server(manager, txmiddleware.NewConfig())(newCreateHandler(manager, erk))
+	reply, err := handler(context.Background(), "a")
+	require.Nil(t, reply)
+	require.Same(t, erk, err)
+	require.Equal(t, int64(0), countArticles(t, db))
+
+	// Plain errors roll back too
+	// 普通错误同样导致回滚
+	cause := erero.New("plain failure")
+	handler = txmiddleware.Server(manager, txmiddleware.NewConfig())(newCreateHandler(manager, cause))
+	_, err = handler(context.Background(), "b")
+	require.ErrorIs(t, err, cause)
+	require.Equal(t, int64(0), countArticles(t, db))
+}
+
+// TestServerCommitFailure tests commit failures are converted with the ErkTranslator
+// TestServerCommitFailure 测试提交失败通过 ErkTranslator 转换
+func TestServerCommitFailure(t *testing.T) {
+	db, faults := gormkratostest.NewFaultDB(t, &Article{})
+	manager := gormkratos.NewTxManager(db)
+
+	faults.FailCommit(erero.New("commit failed"))
+	handler := txmiddleware.Server(manager, txmiddleware.NewConfig())(newCreateHandler(manager, nil))
+	_, err := handler(context.Background(), "a")
+	require.True(t, dberrors.IsServerDbCommitFailed(err))
+	require.Equal(t, int64(0), countArticles(t, db))
+
+	config := txmiddleware.NewConfig().WithErkTranslator(func(err error) *errors.Error {
+		return errorspb.ErrorServerDbTransactionError("save failed: %v", err)
+	})
+	faults.FailCommit(erero.New("commit failed"))
+	handler = txmiddleware.Server(manager, config)(newCreateHandler(manager, nil))
+	_, err = handler(context.Background(), "b")
+	require.True(t, errorspb.IsServerDbTransactionError(err))
+	require.Equal(t, int64(0), countArticles(t, db))
+}
+
+// TestServerSelector tests the selector applies the middleware to selected operations only
+// TestServerSelector 测试 selector 只对选定的操作应用中间件
+func TestServerSelector(t *testing.T) {
+	db := gormkratostest.NewDB(t, &Article{})
+	manager := gormkratos.NewTxManager(db)
+
+	tx := selector.Server(txmiddleware.Server(manager, txmiddleware.NewConfig())).Prefix("/blog.v1.Articles/Create").Build()
+	handler := tx(newCreateHandler(manager, nil))
+
+	ctx := transport.NewServerContext(context.Background(), &testTransport{operation: "/blog.v1.Articles/CreateArticle"})
+	reply, err := handler(ctx, "a")
+	require.NoError(t, err)
+	require.Equal(t, true, reply)
+
+	ctx = transport.NewServerContext(context.Background(), &testTransport{operation: "/blog.v1.Articles/ListArticles"})
+	reply, err = handler(ctx, "b")
+	require.NoError(t, err)
+	require.Equal(t, false, reply)
+	require.Equal(t, int64(2), countArticles(t, db))
+}
+
+// TestServerRecoverPanic tests recovered panics roll back with the Kratos error of the manager
+// TestServerRecoverPanic 测试捕获的 panic 以管理器的 Kratos 错误回滚
+func TestServerRecoverPanic(t *testing.T) {
+	db := gormkratostest.NewDB(t, &Article{})
+	manager := gormkratos.NewTxManager(db).WithRecoverPanic()
+
+	handler := txmiddleware.Server(manager, txmiddleware.NewConfig())(func(ctx context.Context, req any) (any, error) {
+		require.NoError(t, manager.DB(ctx).Create(&Article{Title: "a"}).Error)
+		panic("boom")
+	})
+	_, err := handler(context.Background(), "a")
+	require.Error(t, err)
+	require.Equal(t, int64(0), countArticles(t, db))
+}